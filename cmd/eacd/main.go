@@ -17,22 +17,82 @@ func main() {
 	case "deploy":
 		if err := cmd.Deploy(os.Args[2:], os.Stdout, os.Stderr); err != nil {
 			fmt.Fprintf(os.Stderr, "error: %v\n", err)
-			os.Exit(1)
+			os.Exit(cmd.ExitCode(err))
 		}
 	case "rollback":
 		if err := cmd.Rollback(os.Args[2:], os.Stdout, os.Stderr); err != nil {
 			fmt.Fprintf(os.Stderr, "error: %v\n", err)
-			os.Exit(1)
+			os.Exit(cmd.ExitCode(err))
 		}
 	case "init":
 		if err := cmd.Init(os.Args[2:]); err != nil {
 			fmt.Fprintf(os.Stderr, "error: %v\n", err)
-			os.Exit(1)
+			os.Exit(cmd.ExitCode(err))
+		}
+	case "status":
+		if err := cmd.Status(os.Args[2:], os.Stdout, os.Stderr); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(cmd.ExitCode(err))
+		}
+	case "history":
+		if err := cmd.History(os.Args[2:], os.Stdout, os.Stderr); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(cmd.ExitCode(err))
+		}
+	case "logs":
+		if err := cmd.Logs(os.Args[2:], os.Stdout, os.Stderr); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(cmd.ExitCode(err))
+		}
+	case "diff":
+		if err := cmd.Diff(os.Args[2:], os.Stdout, os.Stderr); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(cmd.ExitCode(err))
+		}
+	case "drift":
+		if err := cmd.Drift(os.Args[2:], os.Stdout, os.Stderr); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(cmd.ExitCode(err))
+		}
+	case "audit":
+		if err := cmd.Audit(os.Args[2:], os.Stdout, os.Stderr); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(cmd.ExitCode(err))
+		}
+	case "secrets":
+		if err := cmd.Secrets(os.Args[2:], os.Stdin, os.Stdout, os.Stderr); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(cmd.ExitCode(err))
+		}
+	case "upgrade-daemon":
+		if err := cmd.UpgradeDaemon(os.Args[2:], os.Stdout, os.Stderr); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(cmd.ExitCode(err))
+		}
+	case "keygen":
+		if err := cmd.Keygen(os.Args[2:], os.Stdout, os.Stderr); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(cmd.ExitCode(err))
+		}
+	case "token":
+		if err := cmd.Token(os.Args[2:], os.Stdout, os.Stderr); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(cmd.ExitCode(err))
+		}
+	case "version":
+		if err := cmd.Version(os.Args[2:], os.Stdout, os.Stderr); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(cmd.ExitCode(err))
+		}
+	case "doctor":
+		if err := cmd.Doctor(os.Args[2:], os.Stdout, os.Stderr); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(cmd.ExitCode(err))
 		}
 	case "install-daemon":
 		if err := cmd.InstallDaemon(os.Args[2:], os.Stdout); err != nil {
 			fmt.Fprintf(os.Stderr, "error: %v\n", err)
-			os.Exit(1)
+			os.Exit(cmd.ExitCode(err))
 		}
 	default:
 		fmt.Fprintf(os.Stderr, "unknown command: %s\n", os.Args[1])
@@ -45,8 +105,22 @@ func printUsage() {
 	fmt.Fprintln(os.Stderr, "Usage: eacd <command>")
 	fmt.Fprintln(os.Stderr, "")
 	fmt.Fprintln(os.Stderr, "Commands:")
-	fmt.Fprintln(os.Stderr, "  init [--reinit]                             Initialize (or reinitialize) .eacd/ configuration")
-	fmt.Fprintln(os.Stderr, "  deploy                                      Deploy the project to the configured server")
-	fmt.Fprintln(os.Stderr, "  rollback                                    Restore the previous deployment snapshot")
+	fmt.Fprintln(os.Stderr, "  init [--reinit] [--env <name>]              Initialize .eacd/ configuration, or add an environment")
+	fmt.Fprintln(os.Stderr, "  deploy [--env <name>] [-m <msg>] [--force]  Deploy the project to the configured server")
+	fmt.Fprintln(os.Stderr, "  deploy --dry-run [--env <name>]             Show what a deploy would change, with diffs")
+	fmt.Fprintln(os.Stderr, "  rollback [--env <name>] [-m <msg>]          Restore the previous deployment snapshot")
+	fmt.Fprintln(os.Stderr, "  status [--env <name>]                       Show the current release and service states")
+	fmt.Fprintln(os.Stderr, "  history [--env <name>] [--limit <n>]        List past releases")
+	fmt.Fprintln(os.Stderr, "  history diff <a> <b>                        Show files changed between two releases")
+	fmt.Fprintln(os.Stderr, "  logs [--unit <u>] [-n <n>] [-f]             Show the journal of the project's units")
+	fmt.Fprintln(os.Stderr, "  diff [--env <name>] [path...]               Diff the local build against the deployed files")
+	fmt.Fprintln(os.Stderr, "  drift [--env <name>]                        Compare the server with the last deployed state")
+	fmt.Fprintln(os.Stderr, "  audit [--env <name>] [--limit <n>] [--all]  Show the server's audit log")
+	fmt.Fprintln(os.Stderr, "  secrets <set|get|edit|rotate>              Manage the encrypted .eacd/secrets.enc")
+	fmt.Fprintln(os.Stderr, "  upgrade-daemon --binary <file> [--env <n>]  Replace eacdd on the project's servers")
+	fmt.Fprintln(os.Stderr, "  keygen [--out <file>]                       Create a key for signing deploy manifests")
+	fmt.Fprintln(os.Stderr, "  token <rotate|add|list|revoke>              Manage the tokens the servers accept")
+	fmt.Fprintln(os.Stderr, "  version [--env <name>]                      Show the eacd version and that of the project's daemons")
+	fmt.Fprintln(os.Stderr, "  doctor [--env <name>]                       Check the config and servers and suggest fixes")
 	fmt.Fprintln(os.Stderr, "  install-daemon --host <ip> [--user <user>]  Install eacdd on any Linux host via SSH")
 }
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/flo-mic/eacd/internal/access"
+	"github.com/flo-mic/eacd/internal/config"
+)
+
+// evictInterval is how often idle rate limit entries and expired bans are
+// dropped.
+const evictInterval = time.Minute
+
+// accessSettings applies allow_cidrs, trusted_proxies, rate_limits and
+// auth_failures from cfg to s. Rate limit and ban state is carried over from
+// prev for the settings that did not change.
+func accessSettings(s *settings, cfg *config.ServerConfig, prev *settings) error {
+	var err error
+	if s.allowCIDRs, err = access.ParseCIDRs(cfg.AllowCIDRs); err != nil {
+		return fmt.Errorf("allow_cidrs: %w", err)
+	}
+	if s.trustedProxies, err = access.ParseCIDRs(cfg.TrustedProxies); err != nil {
+		return fmt.Errorf("trusted_proxies: %w", err)
+	}
+	s.limiters = make(map[string]*access.Limiter, len(cfg.RateLimits))
+	for name, l := range cfg.RateLimits {
+		if prev != nil && prev.cfg.RateLimits[name] == l {
+			s.limiters[name] = prev.limiters[name]
+			continue
+		}
+		s.limiters[name] = access.NewLimiter(l.Requests, l.Per)
+	}
+	if prev != nil && prev.cfg.AuthFailures == cfg.AuthFailures {
+		s.bans = prev.bans
+	} else {
+		s.bans = access.NewBans(cfg.AuthFailures.Max, cfg.AuthFailures.Window, cfg.AuthFailures.Ban)
+	}
+	return nil
+}
+
+// evictIdle drops idle rate limit entries and expired bans every
+// evictInterval.
+func evictIdle() {
+	for now := range time.Tick(evictInterval) {
+		s := current()
+		for _, l := range s.limiters {
+			l.Evict(now)
+		}
+		s.bans.Evict(now)
+	}
+}
+
+// clientIP returns the IP of the client that sent r, following
+// X-Forwarded-For from trusted proxies, or "unix" for Unix socket clients.
+func clientIP(r *http.Request) string {
+	if isUnixConn(r.Context()) {
+		return "unix"
+	}
+	return access.ClientIP(r, current().trustedProxies)
+}
+
+// guard rejects clients outside allow_cidrs and banned clients and caps the
+// request body, see bodyLimit. Unix socket clients are only limited by the
+// socket's permissions.
+func guard(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Signed requests are read in full before their handler runs, so
+		// the cap also bounds what is spooled to disk for them.
+		r.Body = http.MaxBytesReader(w, r.Body, bodyLimit(r.URL.Path))
+		if isUnixConn(r.Context()) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		s := current()
+		ip := clientIP(r)
+		if len(s.allowCIDRs) > 0 && !access.Contains(s.allowCIDRs, ip) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if until, ok := s.bans.Banned(ip); ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(time.Until(until).Seconds())+1))
+			http.Error(w, "too many failed authentication attempts, try again later", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// bodyLimit returns the largest request body accepted for path.
+func bodyLimit(path string) int64 {
+	switch path {
+	case "/deploy":
+		return maxDeploySize
+	case "/admin/upgrade":
+		return maxUpgradeSize
+	}
+	return maxManifestSize
+}
+
+// limit applies the rate limit of the rate_limits group to next.
+func limit(group string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !current().limiters[group].Allow(clientIP(r)) {
+			rateLimited.Inc(group)
+			http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authFailed counts a failed authentication, and against the client's IP.
+func authFailed(r *http.Request) {
+	authFailures.Inc()
+	if isUnixConn(r.Context()) {
+		return
+	}
+	ip := clientIP(r)
+	if current().bans.Fail(ip) {
+		slog.Warn("banning client after repeated failed authentication", "ip", ip, "path", r.URL.Path)
+	}
+}
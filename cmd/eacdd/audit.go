@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/flo-mic/eacd/internal/api"
+	"github.com/flo-mic/eacd/internal/audit"
+	"github.com/flo-mic/eacd/internal/auth"
+)
+
+// auditLog records every check, deploy and rollback; auditPath is its file.
+var (
+	auditLog  *audit.Log
+	auditPath string
+)
+
+// recordAudit appends an entry for an authenticated request. Failing to write
+// the audit log is logged but does not fail the request.
+func recordAudit(r *http.Request, action, project string, ok bool, detail string, meta *api.DeployMeta) {
+	if auditLog == nil {
+		return
+	}
+	err := auditLog.Append(audit.Entry{
+		Action:   action,
+		Project:  project,
+		Result:   auditResult(ok),
+		Detail:   detail,
+		Identity: auth.Identity(r),
+		RemoteIP: clientIP(r),
+		Meta:     meta,
+	})
+	if err != nil {
+		slog.Error("writing audit log", "err", err)
+	}
+}
+
+func auditResult(ok bool) string {
+	if ok {
+		return "ok"
+	}
+	return "fail"
+}
+
+// handleAudit returns the audit log, optionally filtered by project and
+// limited to the most recent entries, together with the chain verification result.
+func handleAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	entries, err := audit.Read(auditPath)
+	if err != nil {
+		http.Error(w, "reading audit log: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp := api.AuditResponse{Verified: true}
+	if err := audit.Verify(entries); err != nil {
+		resp.Verified = false
+		resp.VerifyError = err.Error()
+	}
+
+	project := r.URL.Query().Get("project")
+	for _, e := range entries {
+		if project == "" || e.Project == project {
+			resp.Entries = append(resp.Entries, e)
+		}
+	}
+	if limit, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && limit > 0 && len(resp.Entries) > limit {
+		resp.Entries = resp.Entries[len(resp.Entries)-limit:]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func metaCommit(m *api.DeployMeta) string {
+	if m == nil {
+		return ""
+	}
+	return m.GitCommit
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/flo-mic/eacd/internal/api"
+	"github.com/flo-mic/eacd/internal/deploy"
+	"github.com/flo-mic/eacd/internal/inventory"
+)
+
+// handleDrift compares the host with the last deployed state of a project:
+// file contents and modes, then inventory packages, services and drop-ins.
+func handleDrift(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	project := r.URL.Query().Get("project")
+	if project == "" {
+		http.Error(w, "bad request: missing project", http.StatusBadRequest)
+		return
+	}
+	if !validProject(w, project) {
+		return
+	}
+
+	files, err := deploy.LoadDeployedFiles(project)
+	if err != nil {
+		http.Error(w, "reading deployed state: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if files == nil {
+		http.Error(w, "project "+project+" has no deployed state", http.StatusNotFound)
+		return
+	}
+
+	resp := api.DriftResponse{Project: project, Items: deploy.FileDrift(files)}
+	if releases, err := deploy.LoadReleases(project); err == nil {
+		if cur := deploy.CurrentRelease(releases); cur != nil {
+			resp.Release = cur.ID
+		}
+	}
+
+	invItems, err := inventory.Drift(project)
+	if err != nil {
+		http.Error(w, "checking inventory: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resp.Items = append(resp.Items, invItems...)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
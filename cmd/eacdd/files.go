@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/flo-mic/eacd/internal/api"
+	"github.com/flo-mic/eacd/internal/delta"
+	"github.com/flo-mic/eacd/internal/deploy"
+)
+
+// maxDiffContent is the largest file whose content /files returns.
+const maxDiffContent = 1 << 20
+
+// handleFiles returns the current state of destination paths so the client
+// can diff them against its local build. Content is only served for files of
+// the project's last deploy, so the endpoint cannot be used to read arbitrary
+// files on the host.
+func handleFiles(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req api.FilesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name == "" {
+		http.Error(w, "bad request: missing project name", http.StatusBadRequest)
+		return
+	}
+	if !validProject(w, req.Name) {
+		return
+	}
+
+	deployed, err := deploy.LoadDeployedFiles(req.Name)
+	if err != nil {
+		http.Error(w, "reading deployed state: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	managed := make(map[string]bool, len(deployed))
+	for _, f := range deployed {
+		managed[f.Dest] = true
+	}
+
+	resp := api.FilesResponse{Files: make([]api.RemoteFile, 0, len(req.Paths))}
+	for _, dest := range req.Paths {
+		resp.Files = append(resp.Files, remoteFile(dest, managed[dest]))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func remoteFile(dest string, managed bool) api.RemoteFile {
+	rf := api.RemoteFile{Dest: dest, Managed: managed}
+	info, err := os.Stat(dest)
+	if err != nil || !info.Mode().IsRegular() {
+		return rf
+	}
+	rf.Exists = true
+	if !managed {
+		return rf
+	}
+
+	rf.Size = info.Size()
+	rf.Mode = fmt.Sprintf("%04o", info.Mode().Perm())
+	rf.Hash, _ = delta.HashFile(dest)
+	if info.Size() > maxDiffContent {
+		rf.TooLarge = true
+		return rf
+	}
+	data, err := os.ReadFile(dest)
+	if err != nil {
+		return rf
+	}
+	if isBinary(data) {
+		rf.Binary = true
+		return rf
+	}
+	rf.Content = data
+	return rf
+}
+
+// isBinary reports whether data looks binary: a NUL byte in the first 8000
+// bytes, the same heuristic git uses.
+func isBinary(data []byte) bool {
+	if len(data) > 8000 {
+		data = data[:8000]
+	}
+	return bytes.IndexByte(data, 0) >= 0
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/flo-mic/eacd/internal/api"
+	"github.com/flo-mic/eacd/internal/deploy"
+	"github.com/flo-mic/eacd/internal/disk"
+	"github.com/flo-mic/eacd/internal/inventory"
+	"github.com/flo-mic/eacd/internal/version"
+)
+
+// startTime is when the daemon started, for the uptime.
+var startTime = time.Now()
+
+// healthHandler answers /health. Without parameters it is a liveness probe
+// that needs no token. ?ready=1 also checks free disk space and the state
+// files and answers 503 if a deploy would likely fail. ?verbose=1 returns the
+// full report as JSON and is passed to verbose, which authenticates.
+func healthHandler(verbose http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		switch {
+		case queryFlag(r, "verbose"):
+			verbose.ServeHTTP(w, r)
+		case queryFlag(r, "ready"):
+			if problems := cachedReadiness(); len(problems) > 0 {
+				// Details only go to authenticated clients (?verbose=1).
+				http.Error(w, "not ready", http.StatusServiceUnavailable)
+				return
+			}
+			fmt.Fprintln(w, "ready")
+		default:
+			fmt.Fprintln(w, "ok")
+		}
+	})
+}
+
+// handleHealthVerbose reports the daemon's version, uptime, free disk space
+// and host capabilities. With ?ready=1 it answers 503 if the daemon is not
+// ready.
+func handleHealthVerbose(w http.ResponseWriter, r *http.Request) {
+	resp := api.HealthResponse{
+		Version:        version.String(),
+		UptimeSeconds:  int64(time.Since(startTime).Seconds()),
+		StateDir:       deploy.StateDir(),
+		DeployRunning:  deployRunning.Load(),
+		PackageManager: inventory.PackageManager(),
+		Systemd:        systemdAvailable(),
+	}
+	for _, dir := range healthDirs() {
+		st := api.DiskStatus{Path: dir}
+		if u, err := disk.Stat(dir); err != nil {
+			st.Error = err.Error()
+		} else {
+			st.FreeBytes, st.TotalBytes, st.FreeInodes = u.Free, u.Total, u.FreeInodes
+		}
+		resp.Disks = append(resp.Disks, st)
+	}
+	resp.Problems = readinessProblems()
+	resp.Ready = len(resp.Problems) == 0
+
+	w.Header().Set("Content-Type", "application/json")
+	if !resp.Ready && queryFlag(r, "ready") {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// healthDirs are the directories a deploy writes to besides its destinations.
+func healthDirs() []string {
+	return []string{deploy.StateDir(), os.TempDir()}
+}
+
+// readyCacheTTL is how long the unauthenticated ?ready=1 reuses a
+// readiness result, so probes cannot make the daemon read every state file
+// on each request.
+const readyCacheTTL = 5 * time.Second
+
+var readyCache struct {
+	sync.Mutex
+	checked  time.Time
+	problems []string
+}
+
+// cachedReadiness returns readinessProblems, checked at most once every
+// readyCacheTTL.
+func cachedReadiness() []string {
+	readyCache.Lock()
+	defer readyCache.Unlock()
+	if time.Since(readyCache.checked) >= readyCacheTTL {
+		readyCache.problems = readinessProblems()
+		readyCache.checked = time.Now()
+	}
+	return readyCache.problems
+}
+
+// readinessProblems returns why a deploy would likely fail: a state or temp
+// dir with less than min_free_disk free, or state files that cannot be read.
+func readinessProblems() []string {
+	var problems []string
+	minFree := current().cfg.MinFreeDisk
+	for _, dir := range healthDirs() {
+		u, err := disk.Stat(dir)
+		if err != nil {
+			problems = append(problems, err.Error())
+			continue
+		}
+		if u.Free < uint64(minFree) {
+			problems = append(problems, fmt.Sprintf("%s: only %s free (min_free_disk is %s)", dir, disk.FormatBytes(u.Free), minFree))
+		}
+		if u.Inodes > 0 && u.FreeInodes == 0 {
+			problems = append(problems, fmt.Sprintf("%s: no free inodes", dir))
+		}
+	}
+	for _, err := range deploy.CheckState() {
+		problems = append(problems, "state: "+err.Error())
+	}
+	return problems
+}
+
+// systemdAvailable reports whether systemctl exists and systemd is running.
+func systemdAvailable() bool {
+	if _, err := exec.LookPath("systemctl"); err != nil {
+		return false
+	}
+	_, err := os.Stat("/run/systemd/system")
+	return err == nil
+}
+
+// queryFlag reports whether the query parameter name is true, e.g. "1".
+func queryFlag(r *http.Request, name string) bool {
+	v, _ := strconv.ParseBool(r.URL.Query().Get(name))
+	return v
+}
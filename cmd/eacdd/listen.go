@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// unixPrefix marks a Unix socket path in listen:, e.g. unix:///run/eacd.sock.
+const unixPrefix = "unix://"
+
+// listenFDsStart is the first file descriptor passed by systemd socket
+// activation. It is a variable so tests can pass their own.
+var listenFDsStart = 3
+
+// listen returns the listener for addr: the socket passed by systemd socket
+// activation if there is one, otherwise a Unix socket for unix:// addresses
+// or a TCP listener.
+func listen(addr string) (net.Listener, error) {
+	if l, err := activationListener(); l != nil || err != nil {
+		return l, err
+	}
+	if path, ok := strings.CutPrefix(addr, unixPrefix); ok {
+		// A socket left behind by a previous run would make Listen fail.
+		if c, err := net.Dial("unix", path); err == nil {
+			c.Close()
+			return nil, fmt.Errorf("%s is in use by another process", path)
+		}
+		os.Remove(path)
+		l, err := net.Listen("unix", path)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.Chmod(path, 0600); err != nil {
+			l.Close()
+			return nil, err
+		}
+		return l, nil
+	}
+	return net.Listen("tcp", addr)
+}
+
+// activationListener returns the first socket passed via LISTEN_FDS, or nil
+// if eacdd was not socket-activated.
+func activationListener() (net.Listener, error) {
+	if pid, err := strconv.Atoi(os.Getenv("LISTEN_PID")); err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n < 1 {
+		return nil, nil
+	}
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	f := os.NewFile(uintptr(listenFDsStart), "LISTEN_FD_3")
+	defer f.Close()
+	l, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("socket activation: %w", err)
+	}
+	return l, nil
+}
+
+// listenAddr returns the address l serves on in the form of listen:, so it
+// can be probed like one. With socket activation it may differ from the
+// configured address.
+func listenAddr(l net.Listener) string {
+	if l.Addr().Network() == "unix" {
+		return unixPrefix + l.Addr().String()
+	}
+	return l.Addr().String()
+}
+
+// isUnixConn reports whether ctx belongs to a connection on a Unix socket.
+// Such clients are local; access is controlled by the socket's permissions.
+func isUnixConn(ctx context.Context) bool {
+	unix, _ := ctx.Value(unixConnKey{}).(bool)
+	return unix
+}
+
+type unixConnKey struct{}
+
+// connContext marks connections accepted on a Unix socket, see isUnixConn.
+func connContext(ctx context.Context, c net.Conn) context.Context {
+	if c.LocalAddr().Network() == "unix" {
+		return context.WithValue(ctx, unixConnKey{}, true)
+	}
+	return ctx
+}
+
+// connect copies stdin to the Unix socket at path and the socket's output to
+// stdout. eacd runs "eacdd -connect <socket>" over SSH to reach a daemon
+// that only listens on a socket.
+func connect(path string) error {
+	c, err := net.Dial("unix", path)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	go func() {
+		io.Copy(c, os.Stdin)
+		c.(*net.UnixConn).CloseWrite()
+	}()
+	_, err = io.Copy(os.Stdout, c)
+	return err
+}
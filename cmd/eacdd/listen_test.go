@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/flo-mic/eacd/internal/api"
+)
+
+// activate passes l to the next listen call as systemd socket activation
+// would.
+func activate(t *testing.T, l net.Listener) {
+	t.Helper()
+	var f *os.File
+	var err error
+	switch l := l.(type) {
+	case *net.TCPListener:
+		f, err = l.File()
+	case *net.UnixListener:
+		f, err = l.File()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	// listen takes over the descriptor, so it must not belong to f.
+	fd, err := syscall.Dup(int(f.Fd()))
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := listenFDsStart
+	listenFDsStart = fd
+	t.Cleanup(func() { listenFDsStart = start })
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	t.Setenv("LISTEN_FDS", "1")
+}
+
+func serveVersion(l net.Listener, v string) {
+	go http.Serve(l, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(api.VersionResponse{Version: v})
+	}))
+}
+
+func TestProbeActivatedListener(t *testing.T) {
+	for _, network := range []string{"tcp", "unix"} {
+		t.Run(network, func(t *testing.T) {
+			addr := "127.0.0.1:0"
+			if network == "unix" {
+				addr = filepath.Join(t.TempDir(), "eacd.sock")
+			}
+			sock, err := net.Listen(network, addr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer sock.Close()
+			activate(t, sock)
+
+			// listen: names another address; the activated socket wins.
+			l, err := listen("127.0.0.1:1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer l.Close()
+			serveVersion(l, "v2.0.0")
+
+			served := listenAddr(l)
+			if served == "127.0.0.1:1" {
+				t.Fatalf("served address is the configured one")
+			}
+			if err := probeVersion(served, "token", false, "v2.0.0", 5*time.Second); err != nil {
+				t.Errorf("probing %s: %v", served, err)
+			}
+		})
+	}
+}
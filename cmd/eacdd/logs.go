@@ -0,0 +1,99 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/flo-mic/eacd/internal/deploy"
+	"github.com/flo-mic/eacd/internal/inventory"
+)
+
+// maxLogLines caps ?lines= of GET /logs.
+const maxLogLines = 10000
+
+// projectUnits returns the systemd units a project declares: the unit of its
+// current release and its inventory services.
+func projectUnits(project string) ([]string, error) {
+	var units []string
+	releases, err := deploy.LoadReleases(project)
+	if err != nil {
+		return nil, err
+	}
+	if cur := deploy.CurrentRelease(releases); cur != nil && cur.Unit != "" {
+		units = append(units, cur.Unit)
+	}
+	services, err := inventory.ServiceNames(project)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range services {
+		if !containsUnit(units, s) {
+			units = append(units, s)
+		}
+	}
+	return units, nil
+}
+
+func containsUnit(units []string, name string) bool {
+	for _, u := range units {
+		if strings.TrimSuffix(u, ".service") == strings.TrimSuffix(name, ".service") {
+			return true
+		}
+	}
+	return false
+}
+
+// handleLogs streams journalctl output for the units of a project. Only
+// units the project declares can be read.
+func handleLogs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	project := q.Get("project")
+	if project == "" {
+		http.Error(w, "bad request: missing project", http.StatusBadRequest)
+		return
+	}
+	if !validProject(w, project) {
+		return
+	}
+
+	units, err := projectUnits(project)
+	if err != nil {
+		http.Error(w, "reading project state: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(units) == 0 {
+		http.Error(w, "project "+project+" declares no systemd units", http.StatusNotFound)
+		return
+	}
+	if unit := q.Get("unit"); unit != "" {
+		if !containsUnit(units, unit) {
+			http.Error(w, "unit "+unit+" is not declared by project "+project, http.StatusForbidden)
+			return
+		}
+		units = []string{unit}
+	}
+
+	lines := 100
+	if v := q.Get("lines"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 { // journalctl without --lines would send the whole journal
+			http.Error(w, "bad request: invalid lines", http.StatusBadRequest)
+			return
+		}
+		lines = min(n, maxLogLines)
+	}
+	follow, _ := strconv.ParseBool(q.Get("follow"))
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	if err := deploy.StreamJournal(r.Context(), units, q.Get("since"), lines, follow, &flushWriter{w: w}); err != nil {
+		// Headers are sent; the error can only go into the stream.
+		w.Write([]byte("[eacd] ERROR: journalctl: " + err.Error() + "\n"))
+	}
+}
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"context"
+	"crypto/ecdh"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
@@ -11,70 +14,89 @@ import (
 	"os"
 	"path/filepath"
 	"sync"
-	"time"
+	"sync/atomic"
 
 	"github.com/flo-mic/eacd/internal/api"
 	"github.com/flo-mic/eacd/internal/archive"
+	"github.com/flo-mic/eacd/internal/audit"
 	"github.com/flo-mic/eacd/internal/auth"
 	"github.com/flo-mic/eacd/internal/config"
 	"github.com/flo-mic/eacd/internal/delta"
 	"github.com/flo-mic/eacd/internal/deploy"
+	"github.com/flo-mic/eacd/internal/events"
 	"github.com/flo-mic/eacd/internal/inventory"
+	"github.com/flo-mic/eacd/internal/secrets"
+	"github.com/flo-mic/eacd/internal/signing"
+	"github.com/flo-mic/eacd/internal/version"
+	"github.com/flo-mic/eacd/internal/webhook"
 )
 
 var deployMu sync.Mutex
 
-// rateLimiter is a simple sliding-window per-IP rate limiter.
-type rateLimiter struct {
-	mu       sync.Mutex
-	requests map[string][]time.Time
-	limit    int
-	window   time.Duration
-}
+// deployRunning is set while a deploy or rollback holds deployMu.
+var deployRunning atomic.Bool
 
-func newRateLimiter(limit int, window time.Duration) *rateLimiter {
-	return &rateLimiter{requests: make(map[string][]time.Time), limit: limit, window: window}
-}
+// secretsKey decrypts the secrets.enc shipped with a deploy.
+var secretsKey *ecdh.PrivateKey
 
-func (rl *rateLimiter) allow(ip string) bool {
-	rl.mu.Lock()
-	defer rl.mu.Unlock()
-	now := time.Now()
-	cutoff := now.Add(-rl.window)
-	var valid []time.Time
-	for _, t := range rl.requests[ip] {
-		if t.After(cutoff) {
-			valid = append(valid, t)
-		}
-	}
-	if len(valid) >= rl.limit {
-		rl.requests[ip] = valid
-		return false
-	}
-	rl.requests[ip] = append(valid, now)
-	return true
-}
+// maxManifestSize limits the manifest part of a deploy, and the body of
+// requests other than deploys and upgrades.
+const maxManifestSize = 32 << 20
 
-func (rl *rateLimiter) middleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ip, _, _ := net.SplitHostPort(r.RemoteAddr)
-		if !rl.allow(ip) {
-			http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
-			return
-		}
-		next.ServeHTTP(w, r)
-	})
-}
+// maxDeploySize limits the body of a deploy, archive included.
+const maxDeploySize = 4 << 30
 
 func main() {
 	cfgPath := flag.String("config", "/etc/eacd/server.yaml", "Path to server config")
+	showVersion := flag.Bool("version", false, "Print the version and exit")
+	connectSocket := flag.String("connect", "", "Connect stdin and stdout to this Unix socket (used by eacd over SSH)")
+	upgradeWatch := flag.String("upgrade-watch", "", "Internal: restart eacdd and roll back unless it comes up as this version")
+	probeAddr := flag.String("upgrade-probe", "", "Internal: address the upgrade watcher probes (default: listen)")
+	showFingerprint := flag.Bool("secrets-fingerprint", false, "Print the fingerprint of the secrets key and exit")
 	flag.Parse()
 
+	if *showVersion {
+		fmt.Println("eacdd", version.String())
+		return
+	}
+	if *connectSocket != "" {
+		if err := connect(*connectSocket); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	cfg, err := config.LoadServerConfig(*cfgPath)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error: %v\n", err)
 		os.Exit(1)
 	}
+	configPath = *cfgPath
+
+	if *showFingerprint {
+		key, err := secrets.LoadKey(cfg.SecretsKey)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error loading secrets key: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(secrets.Fingerprint(key.PublicKey()))
+		return
+	}
+	if *upgradeWatch != "" {
+		if err := watchUpgrade(cfg, *upgradeWatch, *probeAddr); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	s, err := newSettings(cfg, nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+	active.Store(s)
 
 	if err := os.MkdirAll(cfg.LogDir, 0755); err != nil {
 		fmt.Fprintf(os.Stderr, "error creating log dir: %v\n", err)
@@ -91,23 +113,72 @@ func main() {
 	logger := slog.New(slog.NewTextHandler(io.MultiWriter(os.Stdout, logFile), nil))
 	slog.SetDefault(logger)
 
-	checkRL := newRateLimiter(60, time.Minute)  // 60 checks/min per IP
-	deployRL := newRateLimiter(10, time.Minute) // 10 deploys/min per IP
+	auditPath = cfg.AuditLog
+	auditLog, err = audit.Open(auditPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error opening audit log: %v\n", err)
+		os.Exit(1)
+	}
+
+	secretsKey, err = secrets.LoadOrCreateKey(cfg.SecretsKey)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error loading secrets key: %v\n", err)
+		os.Exit(1)
+	}
+	slog.Info("secrets key loaded", "fingerprint", secrets.Fingerprint(secretsKey.PublicKey()))
+
+	tokens = auth.NewStore(tokensFromConfig(cfg))
+	tokens.RequireSigned.Store(cfg.RequireSignedRequests)
+	tokens.OnFailure = authFailed
+	go evictIdle()
 
 	mux := http.NewServeMux()
-	mux.Handle("/check", checkRL.middleware(auth.Middleware(cfg.Token, http.HandlerFunc(handleCheck))))
-	mux.Handle("/deploy", deployRL.middleware(auth.Middleware(cfg.Token, http.HandlerFunc(handleDeploy))))
-	mux.Handle("/rollback", deployRL.middleware(auth.Middleware(cfg.Token, http.HandlerFunc(handleRollback))))
-	mux.Handle("/health", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		fmt.Fprintln(w, "ok")
-	}))
-
-	slog.Info("eacdd starting", "listen", cfg.Listen)
-	if err := http.ListenAndServe(cfg.Listen, mux); err != nil {
+	mux.Handle("/check", limit("check", tokens.Middleware(auth.ScopeDeploy, http.HandlerFunc(handleCheck))))
+	mux.Handle("/deploy", limit("deploy", tokens.Middleware(auth.ScopeDeploy, http.HandlerFunc(handleDeploy))))
+	mux.Handle("/rollback", limit("rollback", tokens.Middleware(auth.ScopeDeploy, http.HandlerFunc(handleRollback))))
+	mux.Handle("/audit", limit("read", tokens.Middleware(auth.ScopeRead, http.HandlerFunc(handleAudit))))
+	mux.Handle("/files", limit("read", tokens.Middleware(auth.ScopeRead, http.HandlerFunc(handleFiles))))
+	mux.Handle("/logs", limit("read", tokens.Middleware(auth.ScopeRead, http.HandlerFunc(handleLogs))))
+	mux.Handle("/drift", limit("read", tokens.Middleware(auth.ScopeRead, http.HandlerFunc(handleDrift))))
+	mux.Handle("GET /projects/{name}", limit("read", tokens.Middleware(auth.ScopeRead, http.HandlerFunc(handleProject))))
+	mux.Handle("GET /projects/{name}/releases/{id}/log", limit("read", tokens.Middleware(auth.ScopeRead, http.HandlerFunc(handleReleaseLog))))
+	mux.Handle("GET /projects/{name}/releases", limit("read", tokens.Middleware(auth.ScopeRead, http.HandlerFunc(handleReleases))))
+	mux.Handle("/admin/upgrade", limit("admin", tokens.Middleware(auth.ScopeAdmin, http.HandlerFunc(handleUpgrade))))
+	mux.Handle("/admin/tokens", limit("admin", tokens.Middleware(auth.ScopeAdmin, http.HandlerFunc(handleTokens))))
+	mux.Handle("POST /admin/tokens/rotate", limit("admin", tokens.Middleware(auth.ScopeAdmin, http.HandlerFunc(handleRotateToken))))
+	mux.Handle("DELETE /admin/tokens/{id}", limit("admin", tokens.Middleware(auth.ScopeAdmin, http.HandlerFunc(handleRevokeToken))))
+	mux.Handle("/version", limit("read", tokens.Middleware(auth.ScopeRead, http.HandlerFunc(handleVersion))))
+	mux.Handle("/metrics", limit("read", metricsAuth(http.HandlerFunc(handleMetrics))))
+	mux.Handle("/secrets/key", limit("read", tokens.Middleware(auth.ScopeDeploy, http.HandlerFunc(handleSecretsKey))))
+	mux.Handle("/health", healthHandler(limit("read", tokens.Middleware(auth.ScopeRead, http.HandlerFunc(handleHealthVerbose)))))
+
+	l, err := listen(cfg.Listen)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: listen: %v\n", err)
+		os.Exit(1)
+	}
+	servedAddr = listenAddr(l)
+	slog.Info("eacdd starting", "listen", servedAddr, "version", version.String())
+	// Shutdown waits for requests in flight, but a follow (logs -f) never
+	// finishes on its own; its context is cancelled when shutdown starts.
+	base, stopStreams := context.WithCancel(context.Background())
+	srv := &http.Server{
+		Handler:     guard(mux),
+		BaseContext: func(net.Listener) context.Context { return base },
+		ConnContext: connContext,
+	}
+	srv.RegisterOnShutdown(stopStreams)
+	stopped := make(chan struct{})
+	go func() {
+		handleSignals(srv)
+		close(stopped)
+	}()
+	if err := srv.Serve(l); !errors.Is(err, http.ErrServerClosed) {
 		slog.Error("server error", "err", err)
 		os.Exit(1)
 	}
+	<-stopped
+	slog.Info("eacdd stopped")
 }
 
 // handleCheck compares the client's file hashes against what's on disk
@@ -123,6 +194,9 @@ func handleCheck(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "bad request: "+err.Error(), http.StatusBadRequest)
 		return
 	}
+	if !validProject(w, req.Name) {
+		return
+	}
 
 	dests := make([]string, len(req.Files))
 	clientHashes := make(map[string]string, len(req.Files))
@@ -140,10 +214,23 @@ func handleCheck(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	recordAudit(r, "check", req.Name, true, fmt.Sprintf("%d of %d files differ", len(upload), len(req.Files)), nil)
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(api.CheckResponse{Upload: upload})
 }
 
+// handleSecretsKey returns the daemon's public key so clients can add it as a
+// recipient of their secrets.enc.
+func handleSecretsKey(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(api.SecretsKeyResponse{PublicKey: secrets.EncodePublicKey(secretsKey.PublicKey())})
+}
+
 // handleDeploy processes a deployment request.
 func handleDeploy(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -153,76 +240,154 @@ func handleDeploy(w http.ResponseWriter, r *http.Request) {
 
 	// Serialize deployments — one at a time
 	if !deployMu.TryLock() {
+		deploysBusy.Inc()
 		http.Error(w, "deployment in progress, try again later", http.StatusConflict)
 		return
 	}
 	defer deployMu.Unlock()
+	defer startDeploy()()
+
+	body := &countingBody{ReadCloser: r.Body}
+	r.Body = body
 
 	// Set up streaming response
-	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-	w.Header().Set("X-Content-Type-Options", "nosniff")
-	w.WriteHeader(http.StatusOK)
-	log := &flushWriter{w: w}
+	log := newDeployLog(w, r)
 
+	var manifest api.Manifest
+	var projectHooks []api.Webhook // only trusted once the manifest is verified
+	changed := 0
 	success := false
 	defer func() {
+		detail := log.lastError
 		if success {
-			fmt.Fprintf(log, "[eacd] STATUS:OK\n")
-		} else {
-			fmt.Fprintf(log, "[eacd] STATUS:FAIL\n")
+			detail = fmt.Sprintf("%d of %d files changed", changed, len(manifest.Files))
 		}
+		recordAudit(r, "deploy", manifest.Name, success, detail, manifest.Meta)
+		recordDeployMetrics("deploy", manifest.Name, success, changed)
+		receivedBytes.Add(float64(body.n))
+		id := recordRelease(r, manifest.Name, api.Release{
+			Action:       "deploy",
+			Result:       auditResult(success),
+			Detail:       log.lastError,
+			Meta:         manifest.Meta,
+			FilesChanged: changed,
+			FilesTotal:   len(manifest.Files),
+			Files:        releaseFiles(manifest.Files),
+			Unit:         manifestUnit(manifest.Systemd),
+		})
+		notify(r, manifest.Name, projectHooks, resultEvent(api.WebhookDeploySucceeded, api.WebhookDeployFailed, success, id, detail, log, manifest.Meta))
+		log.finish(success, manifest.Name, id)
 	}()
 
 	mr, err := r.MultipartReader()
 	if err != nil {
-		fmt.Fprintf(log, "[eacd] ERROR: reading multipart: %v\n", err)
+		log.fail(api.CodeBadRequest, "reading multipart: %v", err)
 		return
 	}
 
 	// Part 1: manifest
 	manifestPart, err := mr.NextPart()
 	if err != nil || manifestPart.FormName() != "manifest" {
-		fmt.Fprintf(log, "[eacd] ERROR: expected 'manifest' part\n")
+		log.fail(api.CodeBadRequest, "expected 'manifest' part")
 		return
 	}
-	var manifest api.Manifest
-	if err := json.NewDecoder(manifestPart).Decode(&manifest); err != nil {
-		fmt.Fprintf(log, "[eacd] ERROR: parsing manifest: %v\n", err)
+	manifestJSON, err := io.ReadAll(io.LimitReader(manifestPart, maxManifestSize))
+	if err != nil {
+		log.fail(api.CodeBadRequest, "reading manifest: %v", err)
+		return
+	}
+	if err := json.Unmarshal(manifestJSON, &manifest); err != nil {
+		log.fail(api.CodeBadRequest, "parsing manifest: %v", err)
+		return
+	}
+	if err := deploy.CheckProjectName(manifest.Name); err != nil {
+		manifest.Name = "" // keep it out of the release history and metrics
+		log.fail(api.CodeBadRequest, "%v", err)
+		return
+	}
+	if err := manifest.Meta.Check(); err != nil {
+		manifest.Meta = nil // keep it out of the audit log
+		log.fail(api.CodeBadRequest, "%v", err)
+		return
+	}
+	trustedKeys := current().trustedKeys
+	if len(trustedKeys) > 0 {
+		signer, err := verifySigned(trustedKeys, manifestJSON, manifestPart.Header.Get(api.ManifestSignatureHeader), manifest.SignedAt, manifest.Nonce)
+		if err != nil {
+			log.fail(api.CodeSignature, "manifest signature: %v", err)
+			return
+		}
+		fmt.Fprintf(log, "[eacd] Manifest signed by %s\n", signing.KeyID(signer))
+	}
+	projectHooks = manifest.Webhooks
+
+	// Refuse before anything is written if a filesystem is too full.
+	if err := deploy.Preflight(&manifest, os.TempDir()); err != nil {
+		log.fail(api.CodeDiskSpace, "%v", err)
 		return
 	}
 
 	// Part 2: archive
 	archivePart, err := mr.NextPart()
 	if err != nil || archivePart.FormName() != "archive" {
-		fmt.Fprintf(log, "[eacd] ERROR: expected 'archive' part\n")
+		log.fail(api.CodeBadRequest, "expected 'archive' part")
 		return
 	}
 
 	// Extract archive to temp dir
+	end := events.Phase(log, "extract")
 	tmpDir, err := os.MkdirTemp("", "eacd-")
 	if err != nil {
-		fmt.Fprintf(log, "[eacd] ERROR: creating temp dir: %v\n", err)
+		log.fail(api.CodeInternal, "creating temp dir: %v", err)
 		return
 	}
 	defer os.RemoveAll(tmpDir)
 
 	if err := archive.Extract(archivePart, tmpDir, ""); err != nil {
-		fmt.Fprintf(log, "[eacd] ERROR: extracting archive: %v\n", err)
+		log.fail(api.CodeBadRequest, "extracting archive: %v", err)
 		return
 	}
+	if err := deploy.VerifyArchive(tmpDir, &manifest, len(trustedKeys) > 0); err != nil {
+		log.fail(api.CodeBadRequest, "verifying archive: %v", err)
+		return
+	}
+	end()
 
 	fmt.Fprintf(log, "[eacd] Starting deployment of %s\n", manifest.Name)
+	notify(r, manifest.Name, projectHooks, webhook.Event{Event: api.WebhookDeployStarted, Meta: manifest.Meta})
+
+	// Decrypt secrets (values are never written to the log)
+	var secretValues map[string]string
+	if len(manifest.Secrets) > 0 {
+		end := events.Phase(log, "secrets")
+		f, err := secrets.Parse(manifest.Secrets)
+		if err == nil {
+			secretValues, err = f.Open(secretsKey)
+		}
+		if errors.Is(err, secrets.ErrNotRecipient) {
+			log.fail(api.CodeSecrets, "this server is not a recipient of secrets.enc — run 'eacd secrets rotate'")
+			return
+		}
+		if err != nil {
+			log.fail(api.CodeSecrets, "decrypting secrets: %v", err)
+			return
+		}
+		end()
+	}
 
 	// Inventory reconciliation (before file placement)
 	if manifest.Inventory != nil {
+		end := events.Phase(log, "inventory")
 		fmt.Fprintf(log, "[eacd] Reconciling inventory...\n")
-		if err := inventory.Reconcile(manifest.Name, manifest.Inventory, log); err != nil {
-			fmt.Fprintf(log, "[eacd] ERROR: inventory reconciliation: %v\n", err)
+		if err := inventory.Reconcile(manifest.Name, manifest.Inventory, secretValues, log); err != nil {
+			log.fail(api.CodeInventory, "inventory reconciliation: %v", err)
 			return
 		}
+		end()
 	}
 
 	// Backup existing files for rollback
+	end = events.Phase(log, "backup")
 	var destPaths []string
 	for _, f := range manifest.Files {
 		destPaths = append(destPaths, f.Dest)
@@ -230,19 +395,23 @@ func handleDeploy(w http.ResponseWriter, r *http.Request) {
 	if err := deploy.BackupFiles(manifest.Name, destPaths); err != nil {
 		fmt.Fprintf(log, "[eacd] WARNING: backup failed (rollback unavailable): %v\n", err)
 	}
+	end()
 
 	// Server pre-hook
 	if manifest.Hooks != nil && manifest.Hooks.ServerPre != "" {
 		scriptPath := filepath.Join(tmpDir, manifest.Hooks.ServerPre)
 		if err := os.Chmod(scriptPath, 0755); err == nil {
+			end := events.Phase(log, "pre_hook")
 			if err := deploy.RunHook(scriptPath, log); err != nil {
-				fmt.Fprintf(log, "[eacd] ERROR: pre-hook: %v\n", err)
+				log.fail(api.CodeHook, "pre-hook: %v", err)
 				return
 			}
+			end()
 		}
 	}
 
 	// Place files
+	end = events.Phase(log, "files")
 	for _, f := range manifest.Files {
 		if f.ArchivePath == "" {
 			fmt.Fprintf(log, "[eacd] Skipping %s (unchanged)\n", f.Dest)
@@ -250,35 +419,56 @@ func handleDeploy(w http.ResponseWriter, r *http.Request) {
 		}
 		src := filepath.Join(tmpDir, f.ArchivePath)
 		if err := deploy.PlaceFile(src, f.Dest, f.Mode, log); err != nil {
-			fmt.Fprintf(log, "[eacd] ERROR: placing %s: %v\n", f.Dest, err)
+			log.fail(api.CodeFiles, "placing %s: %v", f.Dest, err)
 			return
 		}
+		changed++
 	}
+	end()
 
 	// Systemd unit
 	if manifest.Systemd != nil && manifest.Systemd.UnitArchivePath != "" {
+		end := events.Phase(log, "systemd")
 		src := filepath.Join(tmpDir, manifest.Systemd.UnitArchivePath)
 		if err := deploy.InstallUnit(src, manifest.Systemd.UnitDest, manifest.Systemd.Enable, manifest.Systemd.Restart, log); err != nil {
-			fmt.Fprintf(log, "[eacd] ERROR: systemd: %v\n", err)
+			log.fail(api.CodeSystemd, "systemd: %v", err)
 			return
 		}
+		end()
 	}
 
 	// Server post-hook (failure is non-fatal)
 	if manifest.Hooks != nil && manifest.Hooks.ServerPost != "" {
 		scriptPath := filepath.Join(tmpDir, manifest.Hooks.ServerPost)
 		if err := os.Chmod(scriptPath, 0755); err == nil {
+			end := events.Phase(log, "post_hook")
 			if err := deploy.RunHook(scriptPath, log); err != nil {
 				fmt.Fprintf(log, "[eacd] WARNING: post-hook failed: %v\n", err)
 			}
+			end()
 		}
 	}
 
-	slog.Info("deployment complete", "project", manifest.Name)
+	if err := deploy.SaveDeployedFiles(manifest.Name, manifest.Files); err != nil {
+		fmt.Fprintf(log, "[eacd] WARNING: saving deployed state (drift detection unavailable): %v\n", err)
+	}
+
+	slog.Info("deployment complete", "project", manifest.Name, "commit", metaCommit(manifest.Meta))
 	fmt.Fprintf(log, "[eacd] Deployment complete\n")
 	success = true
 }
 
+// startDeploy marks a deploy or rollback as running until the returned
+// function is called. deployMu must be held.
+func startDeploy() (done func()) {
+	deployRunning.Store(true)
+	deployQueue.Add(1)
+	return func() {
+		deployQueue.Add(-1)
+		deployRunning.Store(false)
+	}
+}
+
 // handleRollback restores the previous deployment snapshot for a project.
 func handleRollback(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -286,44 +476,83 @@ func handleRollback(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var req struct {
-		Name string `json:"name"`
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxManifestSize))
+	if err != nil {
+		http.Error(w, "bad request: "+err.Error(), http.StatusBadRequest)
+		return
 	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name == "" {
+	var req api.RollbackRequest
+	if err := json.Unmarshal(body, &req); err != nil || req.Name == "" {
 		http.Error(w, "bad request: missing project name", http.StatusBadRequest)
 		return
 	}
+	if !validProject(w, req.Name) {
+		return
+	}
+	if err := req.Meta.Check(); err != nil {
+		http.Error(w, "bad request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	if !deployMu.TryLock() {
+		deploysBusy.Inc()
 		http.Error(w, "deployment in progress, try again later", http.StatusConflict)
 		return
 	}
 	defer deployMu.Unlock()
+	defer startDeploy()()
 
-	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-	w.Header().Set("X-Content-Type-Options", "nosniff")
-	w.WriteHeader(http.StatusOK)
-	log := &flushWriter{w: w}
+	log := newDeployLog(w, r)
+
+	// The release a rollback returns to, for the history: the one recorded
+	// with the snapshot, which a failed deploy may have retaken.
+	restoredID := deploy.SnapshotRelease(req.Name)
+	var restored *api.Release
+	if releases, err := deploy.LoadReleases(req.Name); err == nil && restoredID > 0 {
+		restored = deploy.FindRelease(releases, restoredID)
+	}
 
 	success := false
+	var projectHooks []api.Webhook // only trusted once the request is verified
 	defer func() {
-		if success {
-			fmt.Fprintf(log, "[eacd] STATUS:OK\n")
-		} else {
-			fmt.Fprintf(log, "[eacd] STATUS:FAIL\n")
+		recordAudit(r, "rollback", req.Name, success, log.lastError, req.Meta)
+		recordDeployMetrics("rollback", req.Name, success, 0)
+		rel := api.Release{Action: "rollback", Result: auditResult(success), Detail: log.lastError, Meta: req.Meta}
+		if restored != nil {
+			rel.Files = restored.Files
+			rel.FilesTotal = len(restored.Files)
+			rel.Unit = restored.Unit
 		}
+		if success && restoredID > 0 {
+			rel.Detail = fmt.Sprintf("restored release #%d", restoredID)
+		}
+		id := recordRelease(r, req.Name, rel)
+		notify(r, req.Name, projectHooks, resultEvent(api.WebhookRolledBack, api.WebhookRollbackFailed, success, id, rel.Detail, log, req.Meta))
+		log.finish(success, req.Name, id)
 	}()
 
+	if trustedKeys := current().trustedKeys; len(trustedKeys) > 0 {
+		signer, err := verifySigned(trustedKeys, body, r.Header.Get(api.ManifestSignatureHeader), req.SignedAt, req.Nonce)
+		if err != nil {
+			log.fail(api.CodeSignature, "rollback signature: %v", err)
+			return
+		}
+		fmt.Fprintf(log, "[eacd] Rollback signed by %s\n", signing.KeyID(signer))
+	}
+	projectHooks = req.Webhooks
+
 	if !deploy.RollbackAvailable(req.Name) {
-		fmt.Fprintf(log, "[eacd] ERROR: no rollback snapshot available for %q\n", req.Name)
+		log.fail(api.CodeNoSnapshot, "no rollback snapshot available for %q", req.Name)
 		return
 	}
 
+	end := events.Phase(log, "restore")
 	fmt.Fprintf(log, "[eacd] Rolling back %s...\n", req.Name)
 	if err := deploy.RestoreBackup(req.Name, log); err != nil {
-		fmt.Fprintf(log, "[eacd] ERROR: rollback failed: %v\n", err)
+		log.fail(api.CodeRollback, "rollback failed: %v", err)
 		return
 	}
+	end()
 
 	slog.Info("rollback complete", "project", req.Name)
 	fmt.Fprintf(log, "[eacd] Rollback complete\n")
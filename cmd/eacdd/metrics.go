@@ -0,0 +1,84 @@
+package main
+
+import (
+	"crypto/subtle"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/flo-mic/eacd/internal/auth"
+	"github.com/flo-mic/eacd/internal/metrics"
+)
+
+var registry = metrics.NewRegistry()
+
+// phaseBuckets are the upper bounds, in seconds, of the phase durations.
+var phaseBuckets = []float64{0.1, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300}
+
+var (
+	deploysTotal      = registry.Counter("eacdd_deploys_total", "Deploys by project and result (ok or fail).", "project", "result")
+	rollbacksTotal    = registry.Counter("eacdd_rollbacks_total", "Rollbacks by project and result (ok or fail).", "project", "result")
+	phaseDuration     = registry.Histogram("eacdd_phase_duration_seconds", "Duration of the deploy and rollback phases.", phaseBuckets, "phase")
+	receivedBytes     = registry.Counter("eacdd_deploy_received_bytes_total", "Bytes of deploy uploads received.")
+	filesPlaced       = registry.Counter("eacdd_files_placed_total", "Files placed by deploys, by project.", "project")
+	rateLimited       = registry.Counter("eacdd_rate_limited_total", "Requests rejected by a rate limit, by rate_limits group.", "group")
+	authFailures      = registry.Counter("eacdd_auth_failures_total", "Requests that failed authentication.")
+	deployQueue       = registry.Gauge("eacdd_deploy_queue_depth", "Deploys and rollbacks running. eacdd runs one at a time and answers others with 409.")
+	deploysBusy       = registry.Counter("eacdd_deploys_busy_total", "Deploys and rollbacks rejected because another one was running.")
+	lastDeploySuccess = registry.Gauge("eacdd_last_successful_deploy_timestamp_seconds", "Unix time of the last successful deploy, by project.", "project")
+)
+
+// recordDeployMetrics counts a finished deploy or rollback.
+func recordDeployMetrics(action, project string, ok bool, files int) {
+	if project == "" {
+		return
+	}
+	if action == "rollback" {
+		rollbacksTotal.Inc(project, auditResult(ok))
+		return
+	}
+	deploysTotal.Inc(project, auditResult(ok))
+	filesPlaced.Add(float64(files), project)
+	if ok {
+		lastDeploySuccess.Set(float64(time.Now().Unix()), project)
+	}
+}
+
+// handleMetrics serves all metrics in the Prometheus text format.
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", metrics.ContentType)
+	registry.Write(w)
+}
+
+// metricsAuth accepts the metrics_token as a bearer token, even with
+// require_signed_requests, since it grants nothing else. Other requests need
+// a token with the read scope.
+func metricsAuth(next http.Handler) http.Handler {
+	authed := tokens.Middleware(auth.ScopeRead, next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		want := current().cfg.MetricsToken
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if want != "" && ok && subtle.ConstantTimeCompare([]byte(got), []byte(want)) == 1 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		authed.ServeHTTP(w, r)
+	})
+}
+
+// countingBody counts the bytes read from a request body.
+type countingBody struct {
+	io.ReadCloser
+	n int64
+}
+
+func (c *countingBody) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n += int64(n)
+	return n, err
+}
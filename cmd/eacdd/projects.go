@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/flo-mic/eacd/internal/api"
+	"github.com/flo-mic/eacd/internal/auth"
+	"github.com/flo-mic/eacd/internal/deploy"
+	"github.com/flo-mic/eacd/internal/inventory"
+)
+
+// recordRelease adds a deploy or rollback to the project's release history
+// and returns its ID, or 0 if it was not recorded. Like the audit log, a
+// failure to write it does not fail the request.
+func recordRelease(r *http.Request, project string, rel api.Release) int {
+	if project == "" {
+		return 0
+	}
+	rel.Identity = auth.Identity(r)
+	rel, err := deploy.RecordRelease(project, rel)
+	if err != nil {
+		slog.Error("recording release", "project", project, "err", err)
+		return 0
+	}
+	return rel.ID
+}
+
+// newTranscript starts recording the output of a deploy or rollback. It
+// returns nil if that is not possible; the request then goes on unrecorded.
+func newTranscript() *deploy.Transcript {
+	t, err := deploy.NewTranscript(current().logRetention.MaxSize)
+	if err != nil {
+		slog.Error("creating deploy transcript", "err", err)
+		return nil
+	}
+	return t
+}
+
+// saveTranscript stores t as the log of release id, or discards it if no
+// release was recorded.
+func saveTranscript(t *deploy.Transcript, project string, id int) {
+	if t == nil {
+		return
+	}
+	if id == 0 {
+		t.Discard()
+		return
+	}
+	if err := t.Save(project, id, current().logRetention); err != nil {
+		slog.Error("saving deploy transcript", "project", project, "release", id, "err", err)
+	}
+}
+
+// releaseFiles returns the dest → hash map of a manifest.
+func releaseFiles(files []api.FileEntry) map[string]string {
+	out := make(map[string]string, len(files))
+	for _, f := range files {
+		out[f.Dest] = f.Hash
+	}
+	return out
+}
+
+// manifestUnit returns the unit name deployed with a manifest, if any.
+func manifestUnit(s *api.SystemdEntry) string {
+	if s == nil || s.UnitDest == "" {
+		return ""
+	}
+	return filepath.Base(s.UnitDest)
+}
+
+// validProject answers 400 and returns false if name, taken from a request,
+// is not a valid project name.
+func validProject(w http.ResponseWriter, name string) bool {
+	if err := deploy.CheckProjectName(name); err != nil {
+		http.Error(w, "bad request: "+err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// handleProject returns the current release, rollback availability and the
+// state of inventory-managed services of one project.
+func handleProject(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if !validProject(w, name) {
+		return
+	}
+	releases, err := deploy.LoadReleases(name)
+	if err != nil {
+		http.Error(w, "reading releases: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	services, err := inventory.ServiceStates(name)
+	if err != nil {
+		http.Error(w, "reading inventory: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(releases) == 0 && len(services) == 0 {
+		http.Error(w, "project "+name+" has never been deployed", http.StatusNotFound)
+		return
+	}
+
+	status := api.ProjectStatus{
+		Name:              name,
+		Current:           deploy.CurrentRelease(releases),
+		RollbackAvailable: deploy.RollbackAvailable(name),
+		Services:          services,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// handleReleaseLog returns the saved transcript of one release.
+func handleReleaseLog(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "bad request: invalid release id", http.StatusBadRequest)
+		return
+	}
+	name := r.PathValue("name")
+	if !validProject(w, name) {
+		return
+	}
+	f, err := os.Open(deploy.TranscriptPath(name, id))
+	if os.IsNotExist(err) {
+		http.Error(w, fmt.Sprintf("no log for release #%d (it may have been rotated out)", id), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "reading log: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	io.Copy(w, f)
+}
+
+// handleReleases returns the release history of one project, oldest first.
+func handleReleases(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if !validProject(w, name) {
+		return
+	}
+	releases, err := deploy.LoadReleases(name)
+	if err != nil {
+		http.Error(w, "reading releases: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(api.ReleasesResponse{Releases: releases})
+}
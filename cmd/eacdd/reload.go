@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/flo-mic/eacd/internal/access"
+	"github.com/flo-mic/eacd/internal/config"
+	"github.com/flo-mic/eacd/internal/deploy"
+	"github.com/flo-mic/eacd/internal/signing"
+)
+
+// settings are the parts of server.yaml that SIGHUP reloads. Handlers read
+// them through current(); a reload swaps in a new value.
+type settings struct {
+	cfg *config.ServerConfig
+
+	// trustedKeys are the parsed trusted_keys; if any are set, manifests
+	// must be signed by one of them.
+	trustedKeys []ed25519.PublicKey
+	// upgradeKey is the parsed upgrade_public_key, nil if binaries need no
+	// signature.
+	upgradeKey ed25519.PublicKey
+	// logRetention limits the deploy transcripts kept per project.
+	logRetention deploy.LogRetention
+
+	allowCIDRs     []*net.IPNet // empty: all clients allowed
+	trustedProxies []*net.IPNet
+	limiters       map[string]*access.Limiter // by rate_limits group
+	bans           *access.Bans
+}
+
+var active atomic.Pointer[settings]
+
+// current returns the settings in effect.
+func current() *settings { return active.Load() }
+
+// newSettings parses cfg. prev, if not nil, are the settings it replaces.
+func newSettings(cfg *config.ServerConfig, prev *settings) (*settings, error) {
+	s := &settings{
+		cfg: cfg,
+		logRetention: deploy.LogRetention{
+			MaxSize:  int64(cfg.DeployLogs.MaxSize),
+			MaxTotal: int64(cfg.DeployLogs.MaxTotal),
+			Keep:     cfg.DeployLogs.Keep,
+		},
+	}
+	var err error
+	if s.upgradeKey, err = parseUpgradeKey(cfg.UpgradePublicKey); err != nil {
+		return nil, err
+	}
+	for _, k := range cfg.TrustedKeys {
+		pub, err := signing.ParsePublicKey(k)
+		if err != nil {
+			return nil, fmt.Errorf("trusted_keys: %w", err)
+		}
+		s.trustedKeys = append(s.trustedKeys, pub)
+	}
+	if err := accessSettings(s, cfg, prev); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// reload reads server.yaml again and applies tokens, limits and the other
+// settings. If the file is invalid the settings in effect are kept.
+func reload(path string) error {
+	cfg, err := config.LoadServerConfig(path)
+	if err != nil {
+		return err
+	}
+	prev := current()
+	s, err := newSettings(cfg, prev)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	// These are only read at startup.
+	for key, changed := range map[string]bool{
+		"listen":      cfg.Listen != prev.cfg.Listen,
+		"log_dir":     cfg.LogDir != prev.cfg.LogDir,
+		"audit_log":   cfg.AuditLog != prev.cfg.AuditLog,
+		"secrets_key": cfg.SecretsKey != prev.cfg.SecretsKey,
+	} {
+		if changed {
+			slog.Warn("config change takes effect after a restart", "setting", key)
+		}
+	}
+
+	tokensMu.Lock()
+	tokens.Set(tokensFromConfig(cfg))
+	tokens.RequireSigned.Store(cfg.RequireSignedRequests)
+	tokensMu.Unlock()
+	active.Store(s)
+	return nil
+}
+
+// handleSignals reloads server.yaml on SIGHUP. On SIGTERM or SIGINT it stops
+// accepting requests and waits up to shutdown_timeout for the ones in flight,
+// then up to shutdown_timeout for queued webhooks, and returns.
+func handleSignals(srv *http.Server) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGHUP, syscall.SIGTERM, syscall.SIGINT)
+	for s := range sig {
+		if s == syscall.SIGHUP {
+			if err := reload(configPath); err != nil {
+				slog.Error("reloading config failed, keeping the current one", "err", err)
+				continue
+			}
+			slog.Info("config reloaded", "path", configPath)
+			continue
+		}
+
+		signal.Stop(sig)
+		timeout := current().cfg.ShutdownTimeout
+		slog.Info("shutting down, waiting for in-flight requests", "signal", s.String(), "timeout", timeout)
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		if err := srv.Shutdown(ctx); err != nil {
+			slog.Error("in-flight requests did not finish in time, closing", "err", err)
+			srv.Close()
+		}
+		cancel()
+
+		// The deploys that just finished queued their webhooks; give them a
+		// deadline of their own rather than what is left of ctx.
+		ctx, cancel = context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		if err := notifier.Close(ctx); err != nil {
+			slog.Error("webhooks not delivered before shutdown", "err", err)
+		}
+		return
+	}
+}
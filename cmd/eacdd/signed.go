@@ -0,0 +1,51 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/flo-mic/eacd/internal/auth"
+	"github.com/flo-mic/eacd/internal/signing"
+)
+
+// signedNonces are the nonces of accepted signed manifests and rollback
+// requests by signer key, kept until their timestamp is no longer accepted.
+var (
+	signedMu     sync.Mutex
+	signedNonces = map[string]time.Time{}
+)
+
+// verifySigned checks that data, a manifest or rollback request, is signed by
+// one of trusted, was signed within auth.MaxSkew of now and has not been used
+// before. It returns the key that signed it.
+func verifySigned(trusted []ed25519.PublicKey, data []byte, signature string, signedAt int64, nonce string) (ed25519.PublicKey, error) {
+	signer, err := signing.Verify(trusted, data, signature)
+	if err != nil {
+		return nil, err
+	}
+	if signedAt == 0 || nonce == "" {
+		return nil, errors.New("no timestamp or nonce; upgrade eacd")
+	}
+	now := time.Now()
+	signed := time.Unix(signedAt, 0)
+	if signed.Before(now.Add(-auth.MaxSkew)) || signed.After(now.Add(auth.MaxSkew)) {
+		return nil, fmt.Errorf("signed at %s, more than %s off the server clock", signed.UTC().Format(time.RFC3339), auth.MaxSkew)
+	}
+
+	signedMu.Lock()
+	defer signedMu.Unlock()
+	for k, exp := range signedNonces {
+		if now.After(exp) {
+			delete(signedNonces, k)
+		}
+	}
+	key := signing.KeyID(signer) + "/" + nonce
+	if _, seen := signedNonces[key]; seen {
+		return nil, errors.New("already used")
+	}
+	signedNonces[key] = signed.Add(auth.MaxSkew)
+	return signer, nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flo-mic/eacd/internal/api"
+	"github.com/flo-mic/eacd/internal/deploy"
+	"github.com/flo-mic/eacd/internal/events"
+)
+
+// deployLog is the response stream of a deploy or rollback. Clients that
+// accept api.EventsMediaType get one JSON event per line; everyone else gets
+// the plain-text stream ending in "[eacd] STATUS:OK" or "[eacd] STATUS:FAIL".
+//
+// Writes of free text are split into lines: "[eacd] WARNING: " lines become
+// warning events, other "[eacd] " lines log events and the rest output. The
+// transcript always receives the text form.
+type deployLog struct {
+	mu         sync.Mutex
+	out        *flushWriter
+	events     bool
+	start      time.Time
+	partial    string
+	lastError  string
+	code       string
+	transcript *deploy.Transcript
+}
+
+// newDeployLog picks the stream format from the request's Accept header,
+// sets the response headers and writes the status line.
+func newDeployLog(w http.ResponseWriter, r *http.Request) *deployLog {
+	l := &deployLog{out: &flushWriter{w: w}, events: acceptsEvents(r), start: time.Now(), transcript: newTranscript()}
+	if l.events {
+		w.Header().Set("Content-Type", api.EventsMediaType)
+	} else {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	}
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	return l
+}
+
+// acceptsEvents reports whether the Accept header lists the event stream.
+func acceptsEvents(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		if mt, _, err := mime.ParseMediaType(strings.TrimSpace(part)); err == nil && mt == api.EventsMediaType {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *deployLog) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if msg, ok := strings.CutPrefix(string(p), "[eacd] ERROR: "); ok {
+		l.lastError = strings.TrimSpace(msg)
+	}
+	if l.transcript != nil {
+		l.transcript.Write(p)
+	}
+	if !l.events {
+		return l.out.Write(p)
+	}
+	text := l.partial + string(p)
+	lines := strings.Split(text, "\n")
+	l.partial = lines[len(lines)-1]
+	for _, line := range lines[:len(lines)-1] {
+		l.send(lineEvent(line))
+	}
+	return len(p), nil
+}
+
+// Event implements events.Sink.
+func (l *deployLog) Event(e api.Event) {
+	if e.Type == api.EventPhaseEnd {
+		phaseDuration.Observe(float64(e.DurationMS)/1000, e.Phase)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	text := events.Text(e)
+	if l.transcript != nil {
+		l.transcript.Write([]byte(text))
+	}
+	if l.events {
+		l.send(e)
+	} else if text != "" {
+		l.out.Write([]byte(text))
+	}
+}
+
+// send writes e as one JSON line. l.mu must be held.
+func (l *deployLog) send(e api.Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	l.out.Write(append(data, '\n'))
+}
+
+// lineEvent classifies a line of free text.
+func lineEvent(line string) api.Event {
+	if msg, ok := strings.CutPrefix(line, "[eacd] WARNING: "); ok {
+		return api.Event{Type: api.EventWarning, Message: msg}
+	}
+	if msg, ok := strings.CutPrefix(line, "[eacd] "); ok {
+		return api.Event{Type: api.EventLog, Message: msg}
+	}
+	return api.Event{Type: api.EventOutput, Message: line}
+}
+
+// fail writes an error line and remembers code for the result.
+func (l *deployLog) fail(code, format string, args ...any) {
+	l.mu.Lock()
+	l.code = code
+	l.mu.Unlock()
+	fmt.Fprintf(l, "[eacd] ERROR: "+format+"\n", args...)
+}
+
+// finish ends the stream with the result of the request and saves the
+// transcript as the log of the recorded release.
+func (l *deployLog) finish(ok bool, project string, release int) {
+	l.mu.Lock()
+	if l.partial != "" {
+		l.send(lineEvent(l.partial))
+		l.partial = ""
+	}
+	e := api.Event{Type: api.EventResult, OK: ok, DurationMS: time.Since(l.start).Milliseconds(), Release: release}
+	if !ok {
+		e.Code = l.code
+		if e.Code == "" {
+			e.Code = api.CodeInternal
+		}
+		e.Error = l.lastError
+	}
+	l.mu.Unlock()
+	events.Emit(l, e)
+	saveTranscript(l.transcript, project, release)
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/flo-mic/eacd/internal/api"
+	"github.com/flo-mic/eacd/internal/auth"
+	"github.com/flo-mic/eacd/internal/config"
+)
+
+// tokens are the tokens the daemon accepts.
+var tokens *auth.Store
+
+// tokensMu serializes changes to the tokens and server.yaml.
+var tokensMu sync.Mutex
+
+const (
+	defaultGrace   = 24 * time.Hour
+	minTokenLength = 32
+)
+
+// tokensFromConfig returns the primary token and the tokens: list.
+func tokensFromConfig(cfg *config.ServerConfig) []auth.Token {
+	out := []auth.Token{{Name: "primary", Secret: cfg.Token, Primary: true}}
+	for _, t := range cfg.Tokens {
+		out = append(out, auth.Token{Name: t.Name, Secret: t.Token, Scopes: t.Scopes, Expires: t.Expires})
+	}
+	return out
+}
+
+// saveTokens persists ts to server.yaml, dropping expired tokens, and makes
+// them the accepted set. tokensMu must be held.
+func saveTokens(ts []auth.Token) error {
+	now := time.Now()
+	var primary string
+	var list []config.TokenConfig
+	var kept []auth.Token
+	for _, t := range ts {
+		if t.Expired(now) {
+			continue
+		}
+		kept = append(kept, t)
+		if t.Primary {
+			primary = t.Secret
+			continue
+		}
+		list = append(list, config.TokenConfig{Name: t.Name, Token: t.Secret, Scopes: t.Scopes, Expires: t.Expires.UTC()})
+	}
+	if err := config.SaveServerTokens(configPath, primary, list); err != nil {
+		return fmt.Errorf("saving %s: %w", configPath, err)
+	}
+	tokens.Set(kept)
+	return nil
+}
+
+func tokenInfo(t auth.Token) api.TokenInfo {
+	info := api.TokenInfo{ID: t.ID(), Name: t.Name, Scopes: t.Scopes, Primary: t.Primary}
+	if !t.Expires.IsZero() {
+		exp := t.Expires.UTC()
+		info.Expires = &exp
+	}
+	return info
+}
+
+func newTokenSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func validScopes(scopes []string) error {
+	for _, s := range scopes {
+		switch s {
+		case auth.ScopeRead, auth.ScopeDeploy, auth.ScopeAdmin:
+		default:
+			return fmt.Errorf("unknown scope %q (use read, deploy or admin)", s)
+		}
+	}
+	return nil
+}
+
+// handleTokens lists tokens (GET) or adds one (POST).
+func handleTokens(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		var resp api.TokensResponse
+		now := time.Now()
+		for _, t := range tokens.Tokens() {
+			if !t.Expired(now) {
+				resp.Tokens = append(resp.Tokens, tokenInfo(t))
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+
+	case http.MethodPost:
+		var req api.TokenRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name == "" {
+			http.Error(w, "bad request: missing token name", http.StatusBadRequest)
+			return
+		}
+		if err := validScopes(req.Scopes); err != nil {
+			http.Error(w, "bad request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		t := auth.Token{Name: req.Name, Scopes: req.Scopes}
+		if req.TTL != "" {
+			ttl, err := time.ParseDuration(req.TTL)
+			if err != nil || ttl <= 0 {
+				http.Error(w, "bad request: invalid ttl", http.StatusBadRequest)
+				return
+			}
+			t.Expires = time.Now().Add(ttl)
+		}
+		secret, err := newTokenSecret()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		t.Secret = secret
+
+		tokensMu.Lock()
+		err = saveTokens(append(tokens.Tokens(), t))
+		tokensMu.Unlock()
+		if err != nil {
+			recordAudit(r, "token add", "", false, err.Error(), nil)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		recordAudit(r, "token add", "", true, fmt.Sprintf("%s (%s)", t.ID(), t.Name), nil)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(api.TokenResponse{Token: t.Secret, Info: tokenInfo(t)})
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleRotateToken replaces the primary token. The old one stays valid for
+// the grace period.
+func handleRotateToken(w http.ResponseWriter, r *http.Request) {
+	var req api.RotateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "bad request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	grace := defaultGrace
+	if req.Grace != "" {
+		var err error
+		if grace, err = time.ParseDuration(req.Grace); err != nil || grace < 0 {
+			http.Error(w, "bad request: invalid grace period", http.StatusBadRequest)
+			return
+		}
+	}
+	secret := req.Token
+	if secret == "" {
+		var err error
+		if secret, err = newTokenSecret(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	} else if len(secret) < minTokenLength {
+		http.Error(w, fmt.Sprintf("bad request: token must be at least %d characters", minTokenLength), http.StatusBadRequest)
+		return
+	}
+
+	tokensMu.Lock()
+	defer tokensMu.Unlock()
+
+	expires := time.Now().Add(grace).UTC()
+	next := []auth.Token{{Name: "primary", Secret: secret, Primary: true}}
+	for _, t := range tokens.Tokens() {
+		if t.Primary {
+			t.Primary = false
+			t.Name = "previous primary"
+			t.Expires = expires
+		}
+		next = append(next, t)
+	}
+	if err := saveTokens(next); err != nil {
+		recordAudit(r, "token rotate", "", false, err.Error(), nil)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	recordAudit(r, "token rotate", "", true, fmt.Sprintf("new primary %s, previous valid until %s", auth.TokenID(secret), expires.Format(time.RFC3339)), nil)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(api.TokenResponse{Token: secret, Info: tokenInfo(next[0]), PreviousExpires: &expires})
+}
+
+// handleRevokeToken removes a token by ID or name. The primary token can
+// only be replaced through rotation.
+func handleRevokeToken(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("id")
+
+	tokensMu.Lock()
+	defer tokensMu.Unlock()
+
+	var next []auth.Token
+	var revoked []string
+	for _, t := range tokens.Tokens() {
+		if t.ID() == key || t.Name == key {
+			if t.Primary {
+				http.Error(w, "the primary token cannot be revoked; rotate it instead", http.StatusConflict)
+				return
+			}
+			revoked = append(revoked, t.ID())
+			continue
+		}
+		next = append(next, t)
+	}
+	if len(revoked) == 0 {
+		http.Error(w, "no token "+key, http.StatusNotFound)
+		return
+	}
+	if err := saveTokens(next); err != nil {
+		recordAudit(r, "token revoke", "", false, err.Error(), nil)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	recordAudit(r, "token revoke", "", true, fmt.Sprint(revoked), nil)
+	w.WriteHeader(http.StatusNoContent)
+}
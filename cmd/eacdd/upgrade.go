@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/flo-mic/eacd/internal/api"
+	"github.com/flo-mic/eacd/internal/auth"
+	"github.com/flo-mic/eacd/internal/config"
+	"github.com/flo-mic/eacd/internal/upgrade"
+	"github.com/flo-mic/eacd/internal/version"
+)
+
+// upgradeStatusPath holds the state of the last self-upgrade.
+var upgradeStatusPath = "/var/lib/eacd/upgrade.json"
+
+// Self-upgrade limits.
+const (
+	maxUpgradeSize = 256 << 20
+	upgradeProbe   = 30 * time.Second // how long the new binary has to come up
+	daemonUnit     = "eacdd.service"
+)
+
+// configPath is the -config flag, passed on to the upgrade watcher.
+var configPath string
+
+// servedAddr is the address the daemon serves on, see listenAddr. The
+// upgrade watcher probes it instead of listen:, which a socket passed by
+// systemd need not match.
+var servedAddr string
+
+func parseUpgradeKey(s string) (ed25519.PublicKey, error) {
+	if s == "" {
+		return nil, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(s)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("upgrade_public_key must be a base64 ed25519 public key")
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// handleUpgrade installs a new eacdd binary and hands over to a watcher that
+// restarts the service and restores the old binary if the new one does not
+// come up. GET returns the state of the last upgrade.
+func handleUpgrade(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		status, err := upgrade.LoadStatus(upgradeStatusPath)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if status == nil {
+			http.Error(w, "no upgrade recorded", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(status)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// No deploys while the binary is swapped; the restart ends this process.
+	if !deployMu.TryLock() {
+		http.Error(w, "deployment in progress, try again later", http.StatusConflict)
+		return
+	}
+	defer deployMu.Unlock()
+
+	var signature []byte
+	if s := r.Header.Get("X-Eacd-Signature"); s != "" {
+		var err error
+		if signature, err = base64.StdEncoding.DecodeString(s); err != nil {
+			http.Error(w, "bad request: signature is not base64", http.StatusBadRequest)
+			return
+		}
+	}
+
+	from := version.String()
+	exe, err := os.Executable()
+	if err == nil {
+		exe, err = filepath.EvalSymlinks(exe)
+	}
+	if err != nil {
+		http.Error(w, "locating executable: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	to, err := upgrade.Install(exe, r.Body, r.Header.Get("X-Eacd-Sha256"), signature, current().upgradeKey)
+	if err != nil {
+		recordAudit(r, "upgrade", "", false, err.Error(), nil)
+		code := http.StatusBadRequest
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			code = http.StatusRequestEntityTooLarge
+		}
+		http.Error(w, "upgrade rejected: "+err.Error(), code)
+		return
+	}
+	if err := upgrade.SaveStatus(upgradeStatusPath, upgrade.Status{State: upgrade.StatePending, From: from, To: to}); err != nil {
+		slog.Error("saving upgrade status", "err", err)
+	}
+
+	// The watcher runs the previous binary in its own transient unit so the
+	// restart of eacdd does not kill it.
+	watch := exec.Command("systemd-run", "--unit=eacdd-upgrade-"+fmt.Sprint(time.Now().Unix()), "--collect",
+		exe+upgrade.PrevSuffix, "-config", configPath, "-upgrade-watch", to, "-upgrade-probe", servedAddr)
+	if out, err := watch.CombinedOutput(); err != nil {
+		upgrade.Restore(exe)
+		upgrade.SaveStatus(upgradeStatusPath, upgrade.Status{State: upgrade.StateRolledBack, From: from, To: to, Error: "starting upgrade watcher: " + strings.TrimSpace(string(out))})
+		recordAudit(r, "upgrade", "", false, "starting upgrade watcher failed", nil)
+		http.Error(w, fmt.Sprintf("starting upgrade watcher: %v: %s", err, out), http.StatusInternalServerError)
+		return
+	}
+
+	slog.Info("upgrade installed", "from", from, "to", to)
+	recordAudit(r, "upgrade", "", true, from+" → "+to, nil)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(api.UpgradeResponse{From: from, To: to})
+}
+
+// watchUpgrade is the -upgrade-watch mode, run from the previous binary: it
+// restarts eacdd and waits for it to report version want on addr, or on
+// listen: if addr is empty. If it does not, the previous binary is restored
+// and started again.
+func watchUpgrade(cfg *config.ServerConfig, want, addr string) error {
+	if addr == "" {
+		addr = cfg.Listen
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	exe = strings.TrimSuffix(exe, upgrade.PrevSuffix)
+	status := upgrade.Status{State: upgrade.StatePending, From: version.String(), To: want}
+
+	time.Sleep(time.Second) // let the upgrade response reach the client
+	err = exec.Command("systemctl", "restart", daemonUnit).Run()
+	if err == nil {
+		err = probeVersion(addr, cfg.Token, cfg.RequireSignedRequests, want, upgradeProbe)
+	}
+	if err == nil {
+		status.State = upgrade.StateOK
+		return upgrade.SaveStatus(upgradeStatusPath, status)
+	}
+
+	slog.Error("new eacdd failed its health probe, rolling back", "version", want, "err", err)
+	status.State, status.Error = upgrade.StateRolledBack, err.Error()
+	if rerr := upgrade.Restore(exe); rerr != nil {
+		status.Error += "; restoring previous binary: " + rerr.Error()
+	}
+	exec.Command("systemctl", "restart", daemonUnit).Run()
+	return upgrade.SaveStatus(upgradeStatusPath, status)
+}
+
+// probeVersion polls GET /version of the daemon listening on listen until it
+// reports want.
+func probeVersion(listen, token string, signed bool, want string, timeout time.Duration) error {
+	base := localURL(listen)
+	client := &http.Client{Timeout: 2 * time.Second}
+	if path, ok := strings.CutPrefix(listen, unixPrefix); ok {
+		client.Transport = &http.Transport{DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		}}
+		base = "http://eacdd"
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	lastErr := fmt.Errorf("no response")
+	for {
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, base+"/version", nil)
+		if signed {
+			auth.SignRequest(req, token, nil)
+		} else {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		if resp, err := client.Do(req); err != nil {
+			lastErr = err
+		} else {
+			var v api.VersionResponse
+			err := json.NewDecoder(resp.Body).Decode(&v)
+			resp.Body.Close()
+			switch {
+			case err != nil:
+				lastErr = err
+			case v.Version != want:
+				lastErr = fmt.Errorf("daemon reports version %s", v.Version)
+			default:
+				return nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("eacdd %s did not come up within %s: %v", want, timeout, lastErr)
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// localURL returns the loopback URL of a listen address like ":8765".
+func localURL(listen string) string {
+	host, port, err := net.SplitHostPort(listen)
+	if err != nil {
+		return "http://" + listen
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+	return "http://" + net.JoinHostPort(host, port)
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+
+	"github.com/flo-mic/eacd/internal/api"
+	"github.com/flo-mic/eacd/internal/version"
+)
+
+// handleVersion reports the daemon's version, protocol and features so
+// clients can check compatibility before deploying.
+func handleVersion(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(daemonVersion())
+}
+
+func daemonVersion() api.VersionResponse {
+	return api.VersionResponse{
+		Version:     version.String(),
+		Protocol:    api.ProtocolVersion,
+		MinProtocol: api.MinProtocolVersion,
+		Features:    api.Features,
+		OS:          runtime.GOOS,
+		Arch:        runtime.GOARCH,
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/flo-mic/eacd/internal/api"
+	"github.com/flo-mic/eacd/internal/auth"
+	"github.com/flo-mic/eacd/internal/config"
+	"github.com/flo-mic/eacd/internal/webhook"
+)
+
+// notifier delivers webhook events; it is drained on shutdown.
+var notifier = webhook.NewNotifier(&http.Client{}, 100)
+
+// Limits on project webhooks, whose settings come from the client: every
+// delivery to a URL waits for the ones before it.
+const (
+	maxProjectHookRetries = 5
+	maxProjectHookTimeout = 30 * time.Second
+)
+
+// hostname identifies this server in webhook events.
+var hostname, _ = os.Hostname()
+
+// notify sends e for project to the webhooks of server.yaml and those of
+// the project config sent with the request that webhook_allow permits.
+func notify(r *http.Request, project string, projectHooks []api.Webhook, e webhook.Event) {
+	if project == "" {
+		return
+	}
+	var hooks []webhook.Hook
+	for _, h := range current().cfg.Webhooks {
+		if len(h.Projects) > 0 && !slices.Contains(h.Projects, project) {
+			continue
+		}
+		hooks = append(hooks, webhook.Hook{URL: h.URL, Format: h.Format, Secret: h.Secret, Events: h.Events, Timeout: h.Timeout, Retries: h.Retries})
+	}
+	for _, h := range projectHooks {
+		if !config.WebhookAllowed(current().cfg.WebhookAllow, h.URL) {
+			slog.Warn("ignoring project webhook not listed in webhook_allow", "project", project, "url", h.URL)
+			continue
+		}
+		timeout, err := time.ParseDuration(h.Timeout)
+		if h.Timeout != "" && err != nil {
+			slog.Warn("ignoring project webhook with invalid timeout", "project", project, "url", h.URL, "timeout", h.Timeout)
+			continue
+		}
+		hooks = append(hooks, webhook.Hook{URL: h.URL, Format: h.Format, Secret: h.Secret, Events: h.Events,
+			Timeout: min(timeout, maxProjectHookTimeout), Retries: min(h.Retries, maxProjectHookRetries)})
+	}
+	if len(hooks) == 0 {
+		return
+	}
+	e.Project, e.Host, e.Time = project, hostname, time.Now().UTC()
+	e.Identity = auth.Identity(r)
+	notifier.Notify(hooks, e)
+}
+
+// resultEvent returns the webhook event for the end of a deploy or rollback.
+func resultEvent(succeeded, failed string, ok bool, release int, detail string, log *deployLog, meta *api.DeployMeta) webhook.Event {
+	if ok {
+		return webhook.Event{Event: succeeded, Release: release, Detail: detail, Meta: meta}
+	}
+	code := log.code
+	if code == "" {
+		code = api.CodeInternal
+	}
+	return webhook.Event{Event: failed, Release: release, Code: code, Error: log.lastError, Meta: meta}
+}
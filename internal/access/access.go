@@ -0,0 +1,185 @@
+// Package access decides which clients may talk to eacdd: the IP allowlist,
+// the client IP behind trusted proxies, rate limits and temporary bans after
+// repeated failed authentication.
+package access
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limiter is a sliding-window rate limiter keyed by client IP.
+type Limiter struct {
+	mu       sync.Mutex
+	requests map[string][]time.Time
+	limit    int
+	window   time.Duration
+}
+
+// NewLimiter allows limit requests per window and key.
+func NewLimiter(limit int, window time.Duration) *Limiter {
+	return &Limiter{requests: make(map[string][]time.Time), limit: limit, window: window}
+}
+
+// Allow records a request for key and reports whether it is within the limit.
+func (l *Limiter) Allow(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	valid := recent(l.requests[key], now.Add(-l.window))
+	if len(valid) >= l.limit {
+		l.requests[key] = valid
+		return false
+	}
+	l.requests[key] = append(valid, now)
+	return true
+}
+
+// Evict forgets keys without requests in the window before now.
+func (l *Limiter) Evict(now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for key, times := range l.requests {
+		if len(recent(times, now.Add(-l.window))) == 0 {
+			delete(l.requests, key)
+		}
+	}
+}
+
+// Len returns the number of tracked keys.
+func (l *Limiter) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.requests)
+}
+
+func recent(times []time.Time, cutoff time.Time) []time.Time {
+	var valid []time.Time
+	for _, t := range times {
+		if t.After(cutoff) {
+			valid = append(valid, t)
+		}
+	}
+	return valid
+}
+
+// Bans blocks IPs for a while after too many failed authentications.
+type Bans struct {
+	failures *Limiter
+	ban      time.Duration
+
+	mu     sync.Mutex
+	banned map[string]time.Time // IP → end of the ban
+}
+
+// NewBans bans an IP for ban once it fails more than max times within window.
+func NewBans(max int, window, ban time.Duration) *Bans {
+	return &Bans{failures: NewLimiter(max, window), ban: ban, banned: map[string]time.Time{}}
+}
+
+// Fail records a failed authentication from ip and reports whether it got
+// ip banned.
+func (b *Bans) Fail(ip string) bool {
+	if b.failures.Allow(ip) {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.banned[ip] = time.Now().Add(b.ban)
+	return true
+}
+
+// Banned returns when the ban of ip ends, if it is banned.
+func (b *Bans) Banned(ip string) (time.Time, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	until, ok := b.banned[ip]
+	if !ok || time.Now().After(until) {
+		return time.Time{}, false
+	}
+	return until, true
+}
+
+// Evict forgets expired bans and old failures.
+func (b *Bans) Evict(now time.Time) {
+	b.failures.Evict(now)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ip, until := range b.banned {
+		if now.After(until) {
+			delete(b.banned, ip)
+		}
+	}
+}
+
+// ParseCIDRs parses networks such as "192.168.1.0/24". A plain IP stands for
+// itself.
+func ParseCIDRs(list []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, s := range list {
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP or CIDR %q", s)
+			}
+			bits := 8 * len(ip.To16())
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IP or CIDR %q", s)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// Contains reports whether ip is in one of nets.
+func Contains(nets []*net.IPNet, ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, n := range nets {
+		if n.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the IP of the client that sent r. If the peer is one of
+// the trusted proxies, X-Forwarded-For is followed from the right, skipping
+// trusted proxies, to the first address that is not one.
+func ClientIP(r *http.Request, trusted []*net.IPNet) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	if len(trusted) == 0 || !Contains(trusted, ip) {
+		return ip
+	}
+	var hops []string
+	for _, h := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(h, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+		ip = hop
+		if !Contains(trusted, hop) {
+			break
+		}
+	}
+	return ip
+}
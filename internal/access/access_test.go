@@ -0,0 +1,75 @@
+package access
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	l := NewLimiter(2, time.Minute)
+	if !l.Allow("a") || !l.Allow("a") || l.Allow("a") {
+		t.Error("third request within the window allowed")
+	}
+	if !l.Allow("b") {
+		t.Error("limit shared between keys")
+	}
+	l.Evict(time.Now().Add(2 * time.Minute))
+	if l.Len() != 0 {
+		t.Errorf("%d idle keys kept", l.Len())
+	}
+}
+
+func TestBans(t *testing.T) {
+	b := NewBans(2, time.Minute, time.Hour)
+	if b.Fail("1.2.3.4") || b.Fail("1.2.3.4") {
+		t.Error("banned before exceeding max failures")
+	}
+	if !b.Fail("1.2.3.4") {
+		t.Error("not banned after exceeding max failures")
+	}
+	if _, ok := b.Banned("1.2.3.4"); !ok {
+		t.Error("Banned = false")
+	}
+	if _, ok := b.Banned("5.6.7.8"); ok {
+		t.Error("other IP banned")
+	}
+	b.Evict(time.Now().Add(2 * time.Hour))
+	if _, ok := b.Banned("1.2.3.4"); ok {
+		t.Error("ban not lifted")
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	trusted, err := ParseCIDRs([]string{"10.0.0.1", "172.16.0.0/12"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		remote, xff, want string
+	}{
+		{"192.168.1.5:4000", "", "192.168.1.5"},
+		{"192.168.1.5:4000", "6.6.6.6", "192.168.1.5"}, // untrusted peer: header ignored
+		{"10.0.0.1:4000", "192.168.1.9", "192.168.1.9"},
+		{"10.0.0.1:4000", "6.6.6.6, 192.168.1.9, 172.16.3.4", "192.168.1.9"},
+		{"10.0.0.1:4000", "garbage", "10.0.0.1"},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = c.remote
+		if c.xff != "" {
+			r.Header.Set("X-Forwarded-For", c.xff)
+		}
+		if got := ClientIP(r, trusted); got != c.want {
+			t.Errorf("%s via %q: got %s, want %s", c.remote, c.xff, got, c.want)
+		}
+	}
+
+	if _, err := ParseCIDRs([]string{"not-an-ip"}); err == nil {
+		t.Error("invalid CIDR accepted")
+	}
+	allow, _ := ParseCIDRs([]string{"192.168.1.0/24", "::1"})
+	if !Contains(allow, "192.168.1.77") || !Contains(allow, "::1") || Contains(allow, "192.168.2.1") {
+		t.Error("Contains")
+	}
+}
@@ -0,0 +1,56 @@
+package api
+
+import "time"
+
+// EventsMediaType is the versioned media type of the deploy and rollback
+// event stream: one JSON Event per line. Clients ask for it in the Accept
+// header; without it the daemon answers with the plain-text stream.
+const EventsMediaType = "application/vnd.eacd.events.v1+x-ndjson"
+
+// Event types.
+const (
+	EventPhaseStart = "phase_start"
+	EventPhaseEnd   = "phase_end"
+	EventFile       = "file"        // a file was placed
+	EventPackage    = "package"     // packages installed, removed or kept
+	EventHookOutput = "hook_output" // one line of hook output
+	EventLog        = "log"         // progress message
+	EventWarning    = "warning"
+	EventOutput     = "output" // other command output, e.g. apt-get or systemctl
+	EventResult     = "result" // always the last event
+)
+
+// Error codes of a failed result event.
+const (
+	CodeBadRequest = "bad_request"
+	CodeSecrets    = "secrets"
+	CodeInventory  = "inventory"
+	CodeHook       = "hook"
+	CodeFiles      = "files"
+	CodeSystemd    = "systemd"
+	CodeNoSnapshot = "no_snapshot" // rollback without a snapshot
+	CodeRollback   = "rollback"
+	CodeInternal   = "internal"
+	CodeSignature  = "signature"  // manifest or rollback not signed by a trusted key, or replayed
+	CodeDiskSpace  = "disk_space" // not enough free space or inodes for the deploy
+)
+
+// Event is one entry of the event stream. Only the fields of its type are set.
+type Event struct {
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+
+	Phase      string   `json:"phase,omitempty"`       // phase_start, phase_end
+	DurationMS int64    `json:"duration_ms,omitempty"` // phase_end, result
+	Path       string   `json:"path,omitempty"`        // file
+	Mode       string   `json:"mode,omitempty"`        // file
+	Action     string   `json:"action,omitempty"`      // package: "install", "remove" or "keep"
+	Packages   []string `json:"packages,omitempty"`    // package
+	Hook       string   `json:"hook,omitempty"`        // hook_output
+	Message    string   `json:"message,omitempty"`     // log, warning, output, hook_output, package "keep" reason
+
+	OK      bool   `json:"ok,omitempty"`      // result
+	Code    string `json:"code,omitempty"`    // result: one of the Code constants
+	Error   string `json:"error,omitempty"`   // result
+	Release int    `json:"release,omitempty"` // result: recorded release ID
+}
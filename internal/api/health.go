@@ -0,0 +1,23 @@
+package api
+
+// HealthResponse is returned by GET /health?verbose=1.
+type HealthResponse struct {
+	Version        string       `json:"version"`
+	UptimeSeconds  int64        `json:"uptime_seconds"`
+	StateDir       string       `json:"state_dir"`
+	Disks          []DiskStatus `json:"disks"` // state dir and temp dir
+	DeployRunning  bool         `json:"deploy_running"`
+	PackageManager string       `json:"package_manager,omitempty"` // empty: none found
+	Systemd        bool         `json:"systemd"`                   // systemctl found and systemd running
+	Ready          bool         `json:"ready"`
+	Problems       []string     `json:"problems,omitempty"` // why the daemon is not ready
+}
+
+// DiskStatus is the free space of the filesystem holding Path.
+type DiskStatus struct {
+	Path       string `json:"path"`
+	FreeBytes  uint64 `json:"free_bytes"`
+	TotalBytes uint64 `json:"total_bytes"`
+	FreeInodes uint64 `json:"free_inodes"`
+	Error      string `json:"error,omitempty"`
+}
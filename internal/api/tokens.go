@@ -0,0 +1,40 @@
+package api
+
+import "time"
+
+// TokenInfo describes an accepted token without its secret.
+type TokenInfo struct {
+	ID      string     `json:"id"` // fingerprint, e.g. "token:5f2a91c0"
+	Name    string     `json:"name"`
+	Scopes  []string   `json:"scopes,omitempty"` // empty: all scopes
+	Expires *time.Time `json:"expires,omitempty"`
+	Primary bool       `json:"primary,omitempty"`
+}
+
+// TokensResponse is returned by GET /admin/tokens.
+type TokensResponse struct {
+	Tokens []TokenInfo `json:"tokens"`
+}
+
+// TokenRequest is the body of POST /admin/tokens, which adds a token.
+type TokenRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes,omitempty"`
+	TTL    string   `json:"ttl,omitempty"` // Go duration; empty: never expires
+}
+
+// RotateRequest is the body of POST /admin/tokens/rotate, which replaces the
+// primary token.
+type RotateRequest struct {
+	Token string `json:"token,omitempty"` // new token; generated by the daemon if empty
+	Grace string `json:"grace,omitempty"` // how long the old token keeps working, Go duration (default 24h)
+}
+
+// TokenResponse returns a new token. It is the only time the secret is sent.
+type TokenResponse struct {
+	Token string    `json:"token"`
+	Info  TokenInfo `json:"info"`
+
+	// PreviousExpires is when the replaced primary token stops working (rotate only).
+	PreviousExpires *time.Time `json:"previous_expires,omitempty"`
+}
@@ -1,5 +1,11 @@
 package api
 
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
 // CheckRequest is sent by the client to ask which files the server needs.
 type CheckRequest struct {
 	Name  string          `json:"name"`
@@ -12,11 +18,21 @@ type FileHashEntry struct {
 	Hash string `json:"hash"`
 }
 
+// SecretsKeyResponse is returned by GET /secrets/key.
+type SecretsKeyResponse struct {
+	PublicKey string `json:"public_key"` // base64 X25519 public key
+}
+
 // CheckResponse tells the client which destination paths need to be uploaded.
 type CheckResponse struct {
 	Upload []string `json:"upload"`
 }
 
+// ManifestSignatureHeader is the header of the manifest part that carries
+// the base64 ed25519 signature of the part's exact bytes. A signed rollback
+// request carries the signature of its body in the same request header.
+const ManifestSignatureHeader = "X-Eacd-Signature"
+
 // Manifest is the JSON part of the multipart deploy request.
 type Manifest struct {
 	Name      string        `json:"name"`
@@ -24,6 +40,170 @@ type Manifest struct {
 	Systemd   *SystemdEntry `json:"systemd,omitempty"`
 	Hooks     *HooksEntry   `json:"hooks,omitempty"`
 	Inventory *Inventory    `json:"inventory,omitempty"`
+	Meta      *DeployMeta   `json:"meta,omitempty"`
+
+	// Secrets is the encrypted .eacd/secrets.enc, passed through unchanged.
+	// The daemon decrypts it with its own key at deploy time.
+	Secrets json.RawMessage `json:"secrets,omitempty"`
+
+	// Size lets the daemon check for free disk space before it changes
+	// anything. Older clients do not send it.
+	Size *DeploySize `json:"size,omitempty"`
+
+	// Webhooks of the project config, notified of this deploy.
+	Webhooks []Webhook `json:"webhooks,omitempty"`
+
+	// SignedAt (Unix seconds) and Nonce are set on signed manifests so that
+	// each can be used only once.
+	SignedAt int64  `json:"signed_at,omitempty"`
+	Nonce    string `json:"nonce,omitempty"`
+}
+
+// DeploySize is the disk space a deploy needs.
+type DeploySize struct {
+	Uncompressed int64 `json:"uncompressed"` // bytes of all archive entries once extracted
+	Entries      int   `json:"entries"`      // files in the archive
+}
+
+// DeployMeta records who deployed what. It is attached to deploy and rollback
+// requests and stored in the daemon's audit log.
+type DeployMeta struct {
+	GitCommit string `json:"git_commit,omitempty"`
+	GitBranch string `json:"git_branch,omitempty"`
+	GitDirty  bool   `json:"git_dirty,omitempty"`
+	User      string `json:"user,omitempty"`     // local user running eacd
+	Hostname  string `json:"hostname,omitempty"` // machine running eacd
+	Message   string `json:"message,omitempty"`  // eacd deploy -m
+}
+
+// Limits on DeployMeta, which ends up in the audit log and release history.
+const (
+	MaxMetaMessage = 4096 // bytes of Message
+	MaxMetaField   = 256  // bytes of each other field
+)
+
+// Check fails if a field of m exceeds its limit. A nil m is valid.
+func (m *DeployMeta) Check() error {
+	if m == nil {
+		return nil
+	}
+	if len(m.Message) > MaxMetaMessage {
+		return fmt.Errorf("deploy message is %d bytes, at most %d allowed", len(m.Message), MaxMetaMessage)
+	}
+	for _, f := range []struct{ name, value string }{
+		{"git_commit", m.GitCommit}, {"git_branch", m.GitBranch}, {"user", m.User}, {"hostname", m.Hostname},
+	} {
+		if len(f.value) > MaxMetaField {
+			return fmt.Errorf("meta %s is %d bytes, at most %d allowed", f.name, len(f.value), MaxMetaField)
+		}
+	}
+	return nil
+}
+
+// RollbackRequest is the JSON body of POST /rollback.
+type RollbackRequest struct {
+	Name     string      `json:"name"`
+	Meta     *DeployMeta `json:"meta,omitempty"`
+	Webhooks []Webhook   `json:"webhooks,omitempty"`  // of the project config
+	SignedAt int64       `json:"signed_at,omitempty"` // see Manifest
+	Nonce    string      `json:"nonce,omitempty"`
+}
+
+// AuditEntry is one line of the daemon's hash-chained audit log.
+type AuditEntry struct {
+	Time     time.Time   `json:"time"`
+	Action   string      `json:"action"` // "check", "deploy" or "rollback"
+	Project  string      `json:"project"`
+	Result   string      `json:"result"` // "ok" or "fail"
+	Detail   string      `json:"detail,omitempty"`
+	Identity string      `json:"identity"` // token that authenticated the request
+	RemoteIP string      `json:"remote_ip"`
+	Meta     *DeployMeta `json:"meta,omitempty"`
+	PrevHash string      `json:"prev_hash"`
+	Hash     string      `json:"hash"`
+}
+
+// AuditResponse is returned by GET /audit.
+type AuditResponse struct {
+	Entries     []AuditEntry `json:"entries"`
+	Verified    bool         `json:"verified"`
+	VerifyError string       `json:"verify_error,omitempty"`
+}
+
+// Release is one deploy or rollback as recorded by the daemon in
+// /var/lib/eacd/<project>/releases.json.
+type Release struct {
+	ID           int               `json:"id"`
+	Time         time.Time         `json:"time"`
+	Action       string            `json:"action"` // "deploy" or "rollback"
+	Result       string            `json:"result"` // "ok" or "fail"
+	Detail       string            `json:"detail,omitempty"`
+	Identity     string            `json:"identity"`
+	Meta         *DeployMeta       `json:"meta,omitempty"`
+	FilesChanged int               `json:"files_changed"`
+	FilesTotal   int               `json:"files_total"`
+	Unit         string            `json:"unit,omitempty"`  // systemd unit of the project
+	Files        map[string]string `json:"files,omitempty"` // dest → hash after this release
+}
+
+// ServiceStatus is the live state of an inventory-managed service.
+type ServiceStatus struct {
+	Name    string `json:"name"`
+	Desired string `json:"desired"` // "started" or "stopped"
+	Active  bool   `json:"active"`
+	Enabled bool   `json:"enabled"`
+}
+
+// ProjectStatus is returned by GET /projects/{name}.
+type ProjectStatus struct {
+	Name              string          `json:"name"`
+	Current           *Release        `json:"current,omitempty"` // last successful release
+	RollbackAvailable bool            `json:"rollback_available"`
+	Services          []ServiceStatus `json:"services,omitempty"`
+}
+
+// ReleasesResponse is returned by GET /projects/{name}/releases, oldest first.
+type ReleasesResponse struct {
+	Releases []Release `json:"releases"`
+}
+
+// DriftItem is one difference between the last deployed state and the host.
+type DriftItem struct {
+	Kind   string `json:"kind"`   // "file", "mode", "missing", "package", "service" or "dropin"
+	Target string `json:"target"` // path, package or service name
+	Detail string `json:"detail"`
+}
+
+// DriftResponse is returned by GET /drift.
+type DriftResponse struct {
+	Project string      `json:"project"`
+	Release int         `json:"release,omitempty"` // release the host is compared against
+	Items   []DriftItem `json:"items"`
+}
+
+// FilesRequest is the JSON body of POST /files.
+type FilesRequest struct {
+	Name  string   `json:"name"`
+	Paths []string `json:"paths"`
+}
+
+// RemoteFile is the on-disk state of one destination path. Content is only
+// returned for text files the project has deployed before.
+type RemoteFile struct {
+	Dest     string `json:"dest"`
+	Exists   bool   `json:"exists"`
+	Managed  bool   `json:"managed"` // part of the project's last deploy
+	Size     int64  `json:"size,omitempty"`
+	Mode     string `json:"mode,omitempty"`
+	Hash     string `json:"hash,omitempty"`
+	Binary   bool   `json:"binary,omitempty"`
+	TooLarge bool   `json:"too_large,omitempty"`
+	Content  []byte `json:"content,omitempty"`
+}
+
+// FilesResponse is returned by POST /files.
+type FilesResponse struct {
+	Files []RemoteFile `json:"files"`
 }
 
 // FileEntry describes a single file to be placed on the server.
@@ -33,20 +213,24 @@ type FileEntry struct {
 	Dest        string `json:"dest"`
 	Mode        string `json:"mode"`
 	Hash        string `json:"hash"`
+	Size        int64  `json:"size,omitempty"` // bytes of the local file
 }
 
 // SystemdEntry describes an optional systemd unit to install.
 type SystemdEntry struct {
 	UnitArchivePath string `json:"unit_archive_path"`
 	UnitDest        string `json:"unit_dest"`
+	UnitHash        string `json:"unit_hash,omitempty"` // "sha256:<hex>" of the unit file
 	Enable          bool   `json:"enable"`
 	Restart         bool   `json:"restart"`
 }
 
 // HooksEntry holds the resolved script paths on the server (after extraction).
 type HooksEntry struct {
-	ServerPre  string `json:"server_pre,omitempty"`
-	ServerPost string `json:"server_post,omitempty"`
+	ServerPre      string `json:"server_pre,omitempty"`
+	ServerPreHash  string `json:"server_pre_hash,omitempty"` // "sha256:<hex>" of the script
+	ServerPost     string `json:"server_post,omitempty"`
+	ServerPostHash string `json:"server_post_hash,omitempty"`
 }
 
 // Inventory declares the desired system state on the CT.
@@ -60,8 +244,9 @@ type Inventory struct {
 type InventoryService struct {
 	Name    string            `json:"name"              yaml:"name"`
 	Enabled bool              `json:"enabled"           yaml:"enabled"`
-	State   string            `json:"state"             yaml:"state"`    // "started" or "stopped"
+	State   string            `json:"state"             yaml:"state"` // "started" or "stopped"
 	Env     map[string]string `json:"env,omitempty"     yaml:"env,omitempty"`
+	Secrets map[string]string `json:"secrets,omitempty" yaml:"secrets,omitempty"` // env var → secret name
 }
 
 // InventoryUser describes a system user to ensure exists.
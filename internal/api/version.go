@@ -0,0 +1,81 @@
+package api
+
+import "time"
+
+// ProtocolVersion is the version of the client–daemon protocol spoken by
+// this build. It is raised for changes an older peer cannot handle; additive
+// changes are announced as features instead.
+const ProtocolVersion = 1
+
+// MinProtocolVersion is the oldest protocol version this build still speaks.
+const MinProtocolVersion = 1
+
+// Features a daemon can advertise in VersionResponse.
+const (
+	FeatureEvents   = "events"           // NDJSON event stream of /deploy and /rollback
+	FeatureSecrets  = "secrets"          // manifest secrets and /secrets/key
+	FeatureReleases = "releases"         // /projects/{name}, releases and deploy logs
+	FeatureDrift    = "drift"            // /drift
+	FeatureFiles    = "files"            // /files
+	FeatureLogs     = "logs"             // /logs
+	FeatureAudit    = "audit"            // /audit
+	FeatureUpgrade  = "upgrade"          // /admin/upgrade
+	FeatureTokens   = "tokens"           // /admin/tokens and scoped tokens
+	FeatureSigning  = "signing"          // HMAC-signed requests (auth: hmac)
+	FeatureManifest = "signed_manifests" // ed25519-signed manifests and per-file hash checks
+	FeatureHealth   = "health"           // /health?verbose=1 and ?ready=1
+	FeatureWebhooks = "webhooks"         // project webhooks in the manifest and rollback request
+)
+
+// Features lists the features implemented by this build.
+var Features = []string{
+	FeatureEvents,
+	FeatureSecrets,
+	FeatureReleases,
+	FeatureDrift,
+	FeatureFiles,
+	FeatureLogs,
+	FeatureAudit,
+	FeatureUpgrade,
+	FeatureTokens,
+	FeatureSigning,
+	FeatureManifest,
+	FeatureHealth,
+	FeatureWebhooks,
+}
+
+// VersionResponse is returned by GET /version.
+type VersionResponse struct {
+	Version     string   `json:"version"`      // eacdd release, e.g. "v1.4.0"
+	Protocol    int      `json:"protocol"`     // ProtocolVersion of the daemon
+	MinProtocol int      `json:"min_protocol"` // MinProtocolVersion of the daemon
+	Features    []string `json:"features"`
+	OS          string   `json:"os"`
+	Arch        string   `json:"arch"`
+}
+
+// HasFeature reports whether the daemon advertises feature.
+func (v *VersionResponse) HasFeature(feature string) bool {
+	for _, f := range v.Features {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// UpgradeResponse is returned by POST /admin/upgrade once the new binary is
+// installed; the daemon restarts right after.
+type UpgradeResponse struct {
+	From string `json:"from"` // version being replaced
+	To   string `json:"to"`   // version reported by the new binary
+}
+
+// UpgradeStatus is the state of the last upgrade, returned by GET /admin/upgrade.
+type UpgradeStatus struct {
+	State string    `json:"state"` // "pending", "ok" or "rolled_back"
+	From  string    `json:"from"`
+	To    string    `json:"to"`
+	Time  time.Time `json:"time"`
+	Error string    `json:"error,omitempty"` // why the new binary was rolled back
+}
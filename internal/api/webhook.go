@@ -0,0 +1,22 @@
+package api
+
+// Webhook events.
+const (
+	WebhookDeployStarted   = "deploy_started"
+	WebhookDeploySucceeded = "deploy_succeeded"
+	WebhookDeployFailed    = "deploy_failed"
+	WebhookRolledBack      = "rolled_back"
+	WebhookRollbackFailed  = "rollback_failed"
+)
+
+// Webhook is a webhook of the project config, sent with a deploy or
+// rollback. The daemon notifies it in addition to the webhooks of its own
+// server.yaml.
+type Webhook struct {
+	URL     string   `json:"url"`
+	Format  string   `json:"format,omitempty"`  // "json" (default), "slack", "mattermost", "ntfy" or "gotify"
+	Secret  string   `json:"secret,omitempty"`  // HMAC-SHA256 key for the signature header
+	Events  []string `json:"events,omitempty"`  // empty: all events
+	Timeout string   `json:"timeout,omitempty"` // per attempt, Go duration
+	Retries int      `json:"retries,omitempty"`
+}
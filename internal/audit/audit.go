@@ -0,0 +1,145 @@
+// Package audit implements the daemon's append-only audit log.
+//
+// Each entry is one JSON line. Entries are hash-chained: every entry stores
+// the hash of its predecessor and its own hash over its content, so editing
+// or deleting a line in the middle breaks verification of everything after it.
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/flo-mic/eacd/internal/api"
+)
+
+// Entry is one audited request. It is also the wire format of GET /audit.
+type Entry = api.AuditEntry
+
+// Log appends entries to an audit file.
+type Log struct {
+	mu       sync.Mutex
+	path     string
+	lastHash string
+}
+
+// Open opens the audit log at path, creating it if necessary, and reads the
+// hash of the last entry so new entries continue the chain.
+func Open(path string) (*Log, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	entries, err := Read(path)
+	if err != nil {
+		return nil, err
+	}
+	l := &Log{path: path}
+	if len(entries) > 0 {
+		l.lastHash = entries[len(entries)-1].Hash
+	}
+	return l, nil
+}
+
+// Append links e to the chain, fills in its time if unset and writes it.
+func (l *Log) Append(e Entry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	e.PrevHash = l.lastHash
+	e.Hash = ""
+	h, err := entryHash(e)
+	if err != nil {
+		return err
+	}
+	e.Hash = h
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	l.lastHash = e.Hash
+	return nil
+}
+
+// Read returns all entries of the audit file. A missing file has no entries.
+func Read(path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// No limit on the line length: a long entry must not make the log
+	// unreadable, and with it the daemon unable to start.
+	var entries []Entry
+	r := bufio.NewReader(f)
+	for n := 1; ; n++ {
+		line, err := r.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			var e Entry
+			if err := json.Unmarshal(line, &e); err != nil {
+				return nil, fmt.Errorf("%s line %d: %w", path, n, err)
+			}
+			entries = append(entries, e)
+		}
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Verify checks that entries form an unbroken chain starting from the first.
+// The returned error names the first entry that does not match.
+func Verify(entries []Entry) error {
+	prev := ""
+	for i, e := range entries {
+		if e.PrevHash != prev {
+			return fmt.Errorf("entry %d: previous hash does not match (entry removed or reordered)", i+1)
+		}
+		want := e.Hash
+		e.Hash = ""
+		got, err := entryHash(e)
+		if err != nil {
+			return err
+		}
+		if got != want {
+			return fmt.Errorf("entry %d: content hash does not match (entry modified)", i+1)
+		}
+		prev = want
+	}
+	return nil
+}
+
+func entryHash(e Entry) (string, error) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,90 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAppendAndVerify(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	l, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, action := range []string{"check", "deploy", "rollback"} {
+		if err := l.Append(Entry{Action: action, Project: "api", Result: "ok"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Reopening continues the chain.
+	l, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Append(Entry{Action: "deploy", Project: "api", Result: "fail"}); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 4 {
+		t.Fatalf("expected 4 entries, got %d", len(entries))
+	}
+	if err := Verify(entries); err != nil {
+		t.Errorf("unexpected verify error: %v", err)
+	}
+}
+
+func TestVerify_DetectsTampering(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	l, _ := Open(path)
+	l.Append(Entry{Action: "deploy", Project: "api", Result: "fail"})
+	l.Append(Entry{Action: "deploy", Project: "api", Result: "ok"})
+
+	data, _ := os.ReadFile(path)
+	os.WriteFile(path, []byte(strings.Replace(string(data), `"result":"fail"`, `"result":"ok"`, 1)), 0600)
+
+	entries, _ := Read(path)
+	err := Verify(entries)
+	if err == nil || !strings.Contains(err.Error(), "entry 1") {
+		t.Errorf("expected modification of entry 1 to be detected, got %v", err)
+	}
+}
+
+func TestVerify_DetectsRemoval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	l, _ := Open(path)
+	l.Append(Entry{Action: "check", Project: "api", Result: "ok"})
+	l.Append(Entry{Action: "deploy", Project: "api", Result: "ok"})
+	l.Append(Entry{Action: "rollback", Project: "api", Result: "ok"})
+
+	entries, _ := Read(path)
+	entries = append(entries[:1], entries[2:]...)
+	if err := Verify(entries); err == nil {
+		t.Error("expected removed entry to be detected")
+	}
+}
+
+func TestReadLongEntry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	l, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	long := strings.Repeat("x", 2<<20)
+	if err := l.Append(Entry{Action: "deploy", Project: "api", Result: "fail", Detail: long}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(path); err != nil {
+		t.Fatalf("reopening after a long entry: %v", err)
+	}
+	entries, err := Read(path)
+	if err != nil || len(entries) != 1 || entries[0].Detail != long {
+		t.Fatalf("got %d entries, %v", len(entries), err)
+	}
+}
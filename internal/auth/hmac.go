@@ -0,0 +1,229 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SchemeHMAC is the Authorization scheme of signed requests:
+//
+//	Authorization: EACD-HMAC-SHA256 id=token:5f2a91c0, ts=1760796133, nonce=9c1e…, sig=4b7d…
+//	X-Eacd-Content-Sha256: <hex SHA-256 of the body>
+//
+// sig is the hex HMAC-SHA256, keyed by the token, of StringToSign. The token
+// itself is never sent.
+const SchemeHMAC = "EACD-HMAC-SHA256"
+
+// ContentSHA256Header carries the body digest of a signed request.
+const ContentSHA256Header = "X-Eacd-Content-Sha256"
+
+// MaxSkew is how far the timestamp of a signed request may be from the
+// daemon's clock. Nonces are remembered for as long as their timestamp is
+// accepted.
+const MaxSkew = 5 * time.Minute
+
+// maxMemoryBody is the part of a signed request body kept in memory while
+// its digest is checked; larger bodies are spooled to a temporary file.
+const maxMemoryBody = 1 << 20
+
+// StringToSign returns what a signed request's signature covers.
+func StringToSign(method, requestURI, bodySHA256 string, ts int64, nonce string) string {
+	return strings.Join([]string{SchemeHMAC, method, requestURI, bodySHA256, strconv.FormatInt(ts, 10), nonce}, "\n")
+}
+
+func signature(secret, stringToSign string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(stringToSign))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignRequest sets the Authorization and body digest headers of req, whose
+// body is body, signed with secret.
+func SignRequest(req *http.Request, secret string, body []byte) error {
+	return SignRequestURI(req, req.URL.RequestURI(), secret, body)
+}
+
+// SignRequestURI is SignRequest for a request the daemon receives with a
+// different request URI than req.URL has, e.g. when tunnelled over SSH.
+func SignRequestURI(req *http.Request, requestURI, secret string, body []byte) error {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	sum := sha256.Sum256(body)
+	digest := hex.EncodeToString(sum[:])
+	ts := time.Now().Unix()
+	n := hex.EncodeToString(nonce)
+	sig := signature(secret, StringToSign(req.Method, requestURI, digest, ts, n))
+
+	req.Header.Set(ContentSHA256Header, digest)
+	req.Header.Set("Authorization", fmt.Sprintf("%s id=%s, ts=%d, nonce=%s, sig=%s", SchemeHMAC, TokenID(secret), ts, n, sig))
+	return nil
+}
+
+// signedParams are the fields of a signed Authorization header.
+type signedParams struct {
+	id, nonce, sig string
+	ts             int64
+}
+
+func parseSigned(value string) (signedParams, error) {
+	var p signedParams
+	for _, field := range strings.Split(value, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(field), "=")
+		if !ok {
+			return p, errors.New("malformed signature")
+		}
+		switch k {
+		case "id":
+			p.id = v
+		case "ts":
+			ts, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return p, errors.New("malformed timestamp")
+			}
+			p.ts = ts
+		case "nonce":
+			p.nonce = v
+		case "sig":
+			p.sig = v
+		}
+	}
+	if p.id == "" || p.ts == 0 || len(p.nonce) < 16 || p.sig == "" {
+		return p, errors.New("incomplete signature")
+	}
+	return p, nil
+}
+
+// verifySigned checks a signed request and returns its token. On success
+// r.Body is replaced by the verified body; cleanup removes its spool file.
+func (s *Store) verifySigned(r *http.Request, value string) (t Token, cleanup func(), err error) {
+	cleanup = func() {}
+	p, err := parseSigned(value)
+	if err != nil {
+		return t, cleanup, err
+	}
+	now := time.Now()
+	signed := time.Unix(p.ts, 0)
+	if signed.Before(now.Add(-MaxSkew)) || signed.After(now.Add(MaxSkew)) {
+		return t, cleanup, fmt.Errorf("timestamp is more than %s off the server clock", MaxSkew)
+	}
+	candidates := s.lookupID(p.id)
+	if len(candidates) == 0 {
+		return t, cleanup, errors.New("unknown token")
+	}
+	// IDs are short, so two tokens may share one; the signature tells
+	// which of them signed.
+	digest := r.Header.Get(ContentSHA256Header)
+	stringToSign := StringToSign(r.Method, r.RequestURI, digest, p.ts, p.nonce)
+	ok := false
+	for _, c := range candidates {
+		if hmac.Equal([]byte(signature(c.Secret, stringToSign)), []byte(p.sig)) {
+			t, ok = c, true
+			break
+		}
+	}
+	if !ok {
+		return t, cleanup, errors.New("bad signature")
+	}
+	if !s.useNonce(p.id+"/"+p.nonce, signed.Add(MaxSkew)) {
+		return t, cleanup, errors.New("nonce was already used")
+	}
+
+	body, cleanup, err := verifyBody(r.Body, digest)
+	if err != nil {
+		return t, cleanup, err
+	}
+	r.Body = body
+	return t, cleanup, nil
+}
+
+// lookupID returns the unexpired tokens with the given ID.
+func (s *Store) lookupID(id string) []Token {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	now := time.Now()
+	var found []Token
+	for _, t := range s.tokens {
+		if t.Secret != "" && t.ID() == id && !t.Expired(now) {
+			found = append(found, t)
+		}
+	}
+	return found
+}
+
+// useNonce records key until expires and reports whether it was unused.
+// Expired nonces are forgotten.
+func (s *Store) useNonce(key string, expires time.Time) bool {
+	s.nonceMu.Lock()
+	defer s.nonceMu.Unlock()
+	now := time.Now()
+	if s.nonces == nil {
+		s.nonces = map[string]time.Time{}
+	}
+	for k, exp := range s.nonces {
+		if now.After(exp) {
+			delete(s.nonces, k)
+		}
+	}
+	if _, seen := s.nonces[key]; seen {
+		return false
+	}
+	s.nonces[key] = expires
+	return true
+}
+
+// verifyBody reads body completely and checks it against the hex SHA-256
+// digest, so that handlers never act on a body that does not match its
+// signature. It returns a reader of the verified body. body must be capped
+// by the caller, e.g. with http.MaxBytesReader, since anything beyond
+// maxMemoryBody is spooled to a temporary file.
+func verifyBody(body io.ReadCloser, digest string) (io.ReadCloser, func(), error) {
+	noop := func() {}
+	defer body.Close()
+	h := sha256.New()
+	var buf bytes.Buffer
+	n, err := io.Copy(io.MultiWriter(h, &buf), io.LimitReader(body, maxMemoryBody+1))
+	if err != nil {
+		return nil, noop, err
+	}
+	if n <= maxMemoryBody {
+		if hex.EncodeToString(h.Sum(nil)) != digest {
+			return nil, noop, errors.New("body does not match its signed digest")
+		}
+		return io.NopCloser(&buf), noop, nil
+	}
+
+	f, err := os.CreateTemp("", "eacd-body-*")
+	if err != nil {
+		return nil, noop, err
+	}
+	cleanup := func() {
+		f.Close()
+		os.Remove(f.Name())
+	}
+	if _, err := buf.WriteTo(f); err != nil {
+		return nil, cleanup, err
+	}
+	if _, err := io.Copy(io.MultiWriter(h, f), body); err != nil {
+		return nil, cleanup, err
+	}
+	if hex.EncodeToString(h.Sum(nil)) != digest {
+		return nil, cleanup, errors.New("body does not match its signed digest")
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, cleanup, err
+	}
+	return io.NopCloser(f), cleanup, nil
+}
@@ -0,0 +1,144 @@
+package auth
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func signedRequest(t *testing.T, secret, target string, body []byte) *http.Request {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, target, bytes.NewReader(body))
+	if err := SignRequest(req, secret, body); err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
+
+func TestSignedRequests(t *testing.T) {
+	store := NewStore([]Token{{Secret: "s3cret", Primary: true}})
+	var got []byte
+	handler := store.Middleware(ScopeDeploy, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = io.ReadAll(r.Body)
+		if Identity(r) != TokenID("s3cret") {
+			t.Errorf("identity = %q", Identity(r))
+		}
+	}))
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	body := []byte(`{"name":"app"}`)
+	req := signedRequest(t, "s3cret", "/deploy?project=app", body)
+	if strings.Contains(req.Header.Get("Authorization"), "s3cret") {
+		t.Fatal("token sent in the clear")
+	}
+	replay := req.Clone(req.Context())
+	replay.Body = io.NopCloser(bytes.NewReader(body))
+	if w := serve(req); w.Code != http.StatusOK || !bytes.Equal(got, body) {
+		t.Fatalf("signed request: %d %s, body %q", w.Code, w.Body, got)
+	}
+	if w := serve(replay); w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), "nonce") {
+		t.Errorf("replay: %d %s", w.Code, w.Body)
+	}
+
+	tampered := signedRequest(t, "s3cret", "/deploy", body)
+	tampered.Body = io.NopCloser(strings.NewReader(`{"name":"other"}`))
+	if w := serve(tampered); w.Code != http.StatusUnauthorized {
+		t.Errorf("tampered body: %d", w.Code)
+	}
+
+	moved := signedRequest(t, "s3cret", "/deploy", body)
+	moved.RequestURI = "/rollback"
+	if w := serve(moved); w.Code != http.StatusUnauthorized {
+		t.Errorf("other path: %d", w.Code)
+	}
+
+	stale := signedRequest(t, "s3cret", "/deploy", body)
+	ts := time.Now().Add(-2 * MaxSkew).Unix()
+	sig := signature("s3cret", StringToSign(http.MethodPost, "/deploy", stale.Header.Get(ContentSHA256Header), ts, "00112233445566778899aabbccddeeff"))
+	stale.Header.Set("Authorization", fmt.Sprintf("%s id=%s, ts=%d, nonce=00112233445566778899aabbccddeeff, sig=%s", SchemeHMAC, TokenID("s3cret"), ts, sig))
+	if w := serve(stale); w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), "timestamp") {
+		t.Errorf("stale timestamp: %d %s", w.Code, w.Body)
+	}
+
+	wrongKey := signedRequest(t, "guess", "/deploy", body)
+	if w := serve(wrongKey); w.Code != http.StatusUnauthorized {
+		t.Errorf("wrong key: %d", w.Code)
+	}
+}
+
+func TestSignedLargeBody(t *testing.T) {
+	store := NewStore([]Token{{Secret: "s3cret"}})
+	body := bytes.Repeat([]byte("x"), maxMemoryBody+10)
+	var n int
+	handler := store.Middleware("", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		n = len(data)
+	}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, signedRequest(t, "s3cret", "/deploy", body))
+	if w.Code != http.StatusOK || n != len(body) {
+		t.Errorf("got %d, %d bytes", w.Code, n)
+	}
+}
+
+func TestSignedBodyTooLarge(t *testing.T) {
+	store := NewStore([]Token{{Secret: "s3cret"}})
+	called := false
+	handler := store.Middleware("", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	req := signedRequest(t, "s3cret", "/deploy", bytes.Repeat([]byte("x"), maxMemoryBody+10))
+	w := httptest.NewRecorder()
+	req.Body = http.MaxBytesReader(w, req.Body, maxMemoryBody+5)
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusRequestEntityTooLarge || called {
+		t.Errorf("got %d %s, handler called: %v", w.Code, w.Body, called)
+	}
+}
+
+func TestSignedCollidingIDs(t *testing.T) {
+	// Two secrets whose IDs share the same four hash bytes.
+	a, b := "tok-25250", "tok-61579"
+	if TokenID(a) != TokenID(b) {
+		t.Fatal("test secrets do not collide")
+	}
+	store := NewStore([]Token{{Secret: a, Scopes: []string{ScopeRead}}, {Secret: b}})
+	handler := store.Middleware(ScopeDeploy, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	// Each request is matched to the token that signed it, scopes included.
+	for secret, want := range map[string]int{a: http.StatusForbidden, b: http.StatusOK} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, signedRequest(t, secret, "/deploy", nil))
+		if w.Code != want {
+			t.Errorf("%s: got %d %s, want %d", secret, w.Code, w.Body, want)
+		}
+	}
+}
+
+func TestRequireSigned(t *testing.T) {
+	store := NewStore([]Token{{Secret: "s3cret"}})
+	store.RequireSigned.Store(true)
+	handler := store.Middleware("", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest(http.MethodGet, "/version", nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("bearer token accepted: %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, signedRequest(t, "s3cret", "/version", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("signed request: %d %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,158 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Scopes a token can be limited to. A token without scopes may do anything.
+const (
+	ScopeRead   = "read"   // status, history, logs, diff, drift, audit, version
+	ScopeDeploy = "deploy" // check, deploy, rollback, secrets key; implies read
+	ScopeAdmin  = "admin"  // token management and daemon upgrades
+)
+
+// Token is one accepted token.
+type Token struct {
+	Name    string
+	Secret  string
+	Scopes  []string  // empty: all scopes
+	Expires time.Time // zero: never
+	Primary bool      // the token: entry of server.yaml
+}
+
+// ID returns the token's fingerprint, see TokenID.
+func (t Token) ID() string { return TokenID(t.Secret) }
+
+// Allows reports whether the token may be used for scope.
+func (t Token) Allows(scope string) bool {
+	if len(t.Scopes) == 0 || scope == "" {
+		return true
+	}
+	for _, s := range t.Scopes {
+		if s == scope || (s == ScopeDeploy && scope == ScopeRead) {
+			return true
+		}
+	}
+	return false
+}
+
+// Expired reports whether the token is past its expiry at now.
+func (t Token) Expired(now time.Time) bool {
+	return !t.Expires.IsZero() && now.After(t.Expires)
+}
+
+// Store holds the tokens the daemon accepts. It can be changed at runtime.
+type Store struct {
+	mu     sync.RWMutex
+	tokens []Token
+
+	// RequireSigned rejects bearer tokens; only signed requests (see
+	// SchemeHMAC) are accepted.
+	RequireSigned atomic.Bool
+
+	// OnFailure, if set, is called for each request that fails
+	// authentication, e.g. to ban clients guessing tokens.
+	OnFailure func(r *http.Request)
+
+	nonceMu sync.Mutex
+	nonces  map[string]time.Time // used nonces of signed requests, until they expire
+}
+
+// NewStore returns a store accepting tokens.
+func NewStore(tokens []Token) *Store {
+	return &Store{tokens: append([]Token(nil), tokens...)}
+}
+
+// Tokens returns a copy of all tokens, including expired ones.
+func (s *Store) Tokens() []Token {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]Token(nil), s.tokens...)
+}
+
+// Set replaces all tokens.
+func (s *Store) Set(tokens []Token) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens = append([]Token(nil), tokens...)
+}
+
+// Lookup returns the unexpired token with the given secret.
+func (s *Store) Lookup(secret string) (Token, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	now := time.Now()
+	var found Token
+	ok := false
+	for _, t := range s.tokens {
+		if t.Secret != "" && subtle.ConstantTimeCompare([]byte(secret), []byte(t.Secret)) == 1 && !t.Expired(now) {
+			found, ok = t, true
+		}
+	}
+	return found, ok
+}
+
+// Middleware authenticates each request, by Bearer token or signature (see
+// SchemeHMAC), and checks that the token allows scope. The token's identity
+// (see TokenID) is stored in the request context.
+func (s *Store) Middleware(scope string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		parts := strings.SplitN(auth, " ", 2)
+		if len(parts) != 2 {
+			s.fail(w, r, "unauthorized")
+			return
+		}
+		var t Token
+		switch {
+		case strings.EqualFold(parts[0], SchemeHMAC):
+			var cleanup func()
+			var err error
+			t, cleanup, err = s.verifySigned(r, parts[1])
+			defer cleanup()
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+				return
+			}
+			if err != nil {
+				s.fail(w, r, "unauthorized: "+err.Error())
+				return
+			}
+		case strings.EqualFold(parts[0], "Bearer"):
+			if s.RequireSigned.Load() {
+				http.Error(w, "unauthorized: signed requests required", http.StatusUnauthorized)
+				return
+			}
+			var ok bool
+			if t, ok = s.Lookup(parts[1]); !ok {
+				s.fail(w, r, "unauthorized")
+				return
+			}
+		default:
+			s.fail(w, r, "unauthorized")
+			return
+		}
+		if !t.Allows(scope) {
+			http.Error(w, "token is not allowed to "+scope, http.StatusForbidden)
+			return
+		}
+		ctx := context.WithValue(r.Context(), identityKey{}, t.ID())
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// fail rejects r with 401 and reports it to OnFailure.
+func (s *Store) fail(w http.ResponseWriter, r *http.Request, msg string) {
+	if s.OnFailure != nil {
+		s.OnFailure(r)
+	}
+	http.Error(w, msg, http.StatusUnauthorized)
+}
@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestStoreScopes(t *testing.T) {
+	store := NewStore([]Token{
+		{Name: "primary", Secret: "admin-token", Primary: true},
+		{Name: "ci", Secret: "deploy-token", Scopes: []string{ScopeDeploy}},
+		{Name: "monitor", Secret: "read-token", Scopes: []string{ScopeRead}},
+		{Name: "old", Secret: "expired-token", Expires: time.Now().Add(-time.Minute)},
+	})
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	cases := []struct {
+		token, scope string
+		want         int
+	}{
+		{"admin-token", ScopeAdmin, http.StatusOK},
+		{"deploy-token", ScopeDeploy, http.StatusOK},
+		{"deploy-token", ScopeRead, http.StatusOK},
+		{"deploy-token", ScopeAdmin, http.StatusForbidden},
+		{"read-token", ScopeRead, http.StatusOK},
+		{"read-token", ScopeDeploy, http.StatusForbidden},
+		{"expired-token", ScopeRead, http.StatusUnauthorized},
+		{"unknown", ScopeRead, http.StatusUnauthorized},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+c.token)
+		w := httptest.NewRecorder()
+		store.Middleware(c.scope, ok).ServeHTTP(w, req)
+		if w.Code != c.want {
+			t.Errorf("%s for %s: got %d, want %d", c.token, c.scope, w.Code, c.want)
+		}
+	}
+}
+
+func TestStoreSet(t *testing.T) {
+	store := NewStore([]Token{{Secret: "old"}})
+	store.Set([]Token{{Secret: "new"}})
+	if _, ok := store.Lookup("old"); ok {
+		t.Error("replaced token still accepted")
+	}
+	if _, ok := store.Lookup("new"); !ok {
+		t.Error("new token not accepted")
+	}
+}
+
+func TestStoreOnFailure(t *testing.T) {
+	store := NewStore([]Token{{Secret: "good"}})
+	failures := 0
+	store.OnFailure = func(r *http.Request) { failures++ }
+	handler := store.Middleware(ScopeRead, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for _, header := range []string{"Bearer good", "Bearer bad", "", "Basic good"} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", header)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	if failures != 3 {
+		t.Errorf("OnFailure called %d times, want 3", failures)
+	}
+}
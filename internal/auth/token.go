@@ -1,24 +1,28 @@
 package auth
 
 import (
-	"crypto/subtle"
+	"crypto/sha256"
+	"encoding/hex"
 	"net/http"
-	"strings"
 )
 
+type identityKey struct{}
+
 // Middleware returns an HTTP middleware that validates the Bearer token.
+// The token's identity (see TokenID) is stored in the request context.
 func Middleware(token string, next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		auth := r.Header.Get("Authorization")
-		parts := strings.SplitN(auth, " ", 2)
-		if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
-			http.Error(w, "unauthorized", http.StatusUnauthorized)
-			return
-		}
-		if subtle.ConstantTimeCompare([]byte(parts[1]), []byte(token)) != 1 {
-			http.Error(w, "unauthorized", http.StatusUnauthorized)
-			return
-		}
-		next.ServeHTTP(w, r)
-	})
+	return NewStore([]Token{{Secret: token, Primary: true}}).Middleware("", next)
+}
+
+// TokenID returns a short, non-secret fingerprint of a token for logs.
+func TokenID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return "token:" + hex.EncodeToString(sum[:4])
+}
+
+// Identity returns the identity of the token that authenticated r,
+// or "" if the request did not pass through Middleware.
+func Identity(r *http.Request) string {
+	id, _ := r.Context().Value(identityKey{}).(string)
+	return id
 }
@@ -44,3 +44,21 @@ func TestMiddleware(t *testing.T) {
 		})
 	}
 }
+
+func TestMiddleware_SetsIdentity(t *testing.T) {
+	var got string
+	handler := Middleware("my-secret-token", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = Identity(r)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer my-secret-token")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if got != TokenID("my-secret-token") {
+		t.Errorf("Identity = %q, want %q", got, TokenID("my-secret-token"))
+	}
+	if got == "" || got == "my-secret-token" {
+		t.Error("identity must be a non-empty fingerprint, not the token itself")
+	}
+}
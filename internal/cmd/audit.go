@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/flo-mic/eacd/internal/api"
+)
+
+// Audit prints the audit log of the configured server(s).
+func Audit(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("audit", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	dir := fs.String("dir", ".", "Project directory (default: current directory)")
+	env := fs.String("env", "", "Environment from the 'environments:' block")
+	limit := fs.Int("limit", 20, "Number of most recent entries to show (0 = all)")
+	all := fs.Bool("all", false, "Show entries of all projects on the server, not only this one")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	_, cfg, err := loadProject(*dir, *env)
+	if err != nil {
+		return err
+	}
+	creds, err := resolveToken(cfg, stderr)
+	if err != nil {
+		return err
+	}
+
+	q := url.Values{}
+	if !*all {
+		q.Set("project", cfg.Name)
+	}
+	if *limit > 0 {
+		q.Set("limit", strconv.Itoa(*limit))
+	}
+
+	broken := false
+	for i, server := range cfg.Targets() {
+		if i > 0 {
+			fmt.Fprintln(stdout)
+		}
+		if _, err := requireFeatures(server, creds, api.FeatureAudit); err != nil {
+			return err
+		}
+		resp, err := httpGet(server+"/audit?"+q.Encode(), creds)
+		if err != nil {
+			return fmt.Errorf("audit request: %w", err)
+		}
+		var result api.AuditResponse
+		if err := decodeJSONResponse(resp, &result); err != nil {
+			return fmt.Errorf("audit request to %s: %w", server, err)
+		}
+
+		fmt.Fprintf(stdout, "[eacd] Audit log of %s\n", hostLabel(server))
+		printAudit(stdout, result.Entries)
+		if result.Verified {
+			fmt.Fprintf(stdout, "[eacd] Hash chain verified\n")
+		} else {
+			fmt.Fprintf(stdout, "[eacd] WARNING: hash chain broken: %s\n", result.VerifyError)
+			broken = true
+		}
+	}
+	if broken {
+		return fmt.Errorf("audit log has been tampered with")
+	}
+	return nil
+}
+
+func printAudit(w io.Writer, entries []api.AuditEntry) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TIME\tACTION\tPROJECT\tRESULT\tWHO\tIP\tCOMMIT\tMESSAGE")
+	for _, e := range entries {
+		who, commit, message := e.Identity, "", ""
+		if m := e.Meta; m != nil {
+			if m.User != "" {
+				who = m.User + "@" + m.Hostname + " (" + e.Identity + ")"
+			}
+			commit = shortCommit(m.GitCommit)
+			if m.GitDirty {
+				commit += "+dirty"
+			}
+			message = m.Message
+		}
+		if message == "" {
+			message = e.Detail
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			e.Time.Local().Format("2006-01-02 15:04:05"), e.Action, e.Project, e.Result, who, e.RemoteIP, commit, message)
+	}
+	tw.Flush()
+}
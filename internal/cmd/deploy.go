@@ -3,6 +3,7 @@ package cmd
 import (
 	"bufio"
 	"bytes"
+	"crypto/ed25519"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -13,40 +14,105 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/flo-mic/eacd/internal/api"
 	"github.com/flo-mic/eacd/internal/archive"
+	"github.com/flo-mic/eacd/internal/auth"
 	"github.com/flo-mic/eacd/internal/config"
 	"github.com/flo-mic/eacd/internal/delta"
+	"github.com/flo-mic/eacd/internal/render"
+	"github.com/flo-mic/eacd/internal/signing"
 )
 
+// localFile is a file from one of the mappings, ready to be uploaded.
+type localFile struct {
+	relPath     string // source path relative to the project
+	srcPath     string
+	dest        string
+	mode        string
+	archiveName string
+	secrets     *secretMasker // nil unless the rendered template holds secrets
+}
+
+// deployPlan is everything computed locally before talking to any server.
+// It is shared by all targets of a fan-out deploy.
+type deployPlan struct {
+	projectDir  string
+	cfg         *config.ClientConfig
+	files       []localFile
+	hashes      map[string]string // dest → hash
+	meta        *api.DeployMeta
+	webhooks    []api.Webhook
+	refuseDrift bool               // check each server for drift before deploying to it
+	signer      ed25519.PrivateKey // signs the manifest; nil if not configured
+	renderDir   string             // rendered templates; removed by cleanup
+	rendered    int
+}
+
+func (p *deployPlan) cleanup() {
+	if p.renderDir != "" {
+		os.RemoveAll(p.renderDir)
+	}
+}
+
 // Deploy runs the deploy subcommand.
 func Deploy(args []string, stdout, stderr io.Writer) error {
 	fs := flag.NewFlagSet("deploy", flag.ContinueOnError)
 	fs.SetOutput(stderr)
 	dir := fs.String("dir", ".", "Project directory (default: current directory)")
+	env := fs.String("env", "", "Environment from the 'environments:' block to deploy to")
+	message := fs.String("m", "", "Deploy message recorded in the server's audit log")
+	force := fs.Bool("force", false, "Deploy even if refuse_drift is set and a server has drifted")
+	dryRun := fs.Bool("dry-run", false, "Show what would change on each server without deploying")
+	output := outputFlag(fs)
 	if err := fs.Parse(args); err != nil {
 		return err
 	}
-
-	projectDir, err := filepath.Abs(*dir)
-	if err != nil {
-		return fmt.Errorf("resolving project dir: %w", err)
+	if err := checkOutput(*output, OutputText, OutputJSON, OutputGitHub); err != nil {
+		return err
+	}
+	if err := checkMessage(*message); err != nil {
+		return err
+	}
+	if *dryRun && *output != OutputText {
+		return fmt.Errorf("--dry-run only supports text output")
 	}
 
-	cfg, err := config.LoadClientConfig(projectDir)
+	projectDir, cfg, err := loadProject(*dir, *env)
 	if err != nil {
 		return err
 	}
 
-	// Resolve token: env var takes precedence over config file
-	token := os.Getenv("EACD_TOKEN")
-	if token == "" && cfg.Token != "" {
-		fmt.Fprintln(stderr, "warning: token is hardcoded in .eacd/config.yaml — consider using EACD_TOKEN env var instead")
-		token = cfg.Token
+	// With JSON output, stdout only carries the report.
+	progress := stdout
+	if *output == OutputJSON {
+		progress = stderr
+	}
+	rep := newRunReport("deploy", cfg.Name, cfg.Environment, cfg.Targets())
+	began := time.Now()
+	err = runDeploy(projectDir, cfg, *message, *force, *dryRun, progress, stderr, rep)
+	rep.finish(stdout, *output, err, began)
+	return err
+}
+
+// runDeploy deploys to all targets, recording the outcome in rep.
+func runDeploy(projectDir string, cfg *config.ClientConfig, message string, force, dryRun bool, stdout, stderr io.Writer, rep *runReport) error {
+	meta := collectMeta(projectDir, message)
+	if cfg.RequireCleanGit {
+		if meta.GitCommit == "" {
+			return fmt.Errorf("require_clean_git is set but %s is not a git repository", projectDir)
+		}
+		if meta.GitDirty {
+			return fmt.Errorf("require_clean_git is set and the working tree has uncommitted changes")
+		}
 	}
-	if token == "" {
-		return fmt.Errorf("no auth token: set EACD_TOKEN or add 'token:' to .eacd/config.yaml")
+
+	// Resolve token: env var takes precedence over config file
+	creds, err := resolveToken(cfg, stderr)
+	if err != nil {
+		return err
 	}
 
 	// Run local pre-hook
@@ -58,14 +124,56 @@ func Deploy(args []string, stdout, stderr io.Writer) error {
 		}
 	}
 
-	// Collect files from all mappings and compute hashes
-	type localFile struct {
-		srcPath     string
-		dest        string
-		mode        string
-		archiveName string
+	plan, err := buildPlan(projectDir, cfg)
+	if err != nil {
+		return err
+	}
+	defer plan.cleanup()
+	plan.meta = meta
+	if plan.webhooks, err = projectWebhooks(cfg); err != nil {
+		return err
+	}
+	plan.refuseDrift = cfg.RefuseDrift && !force
+	if plan.signer, err = loadSigningKey(projectDir, cfg); err != nil {
+		return fmt.Errorf("loading signing key: %w", err)
 	}
 
+	targets := cfg.Targets()
+	if dryRun {
+		for _, server := range targets {
+			fmt.Fprintf(stdout, "[eacd] Dry run against %s\n", hostLabel(server))
+			if _, err := diffTo(server, plan, plan.files, creds, stdout); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	deployOne := func(server string, out io.Writer) error {
+		began := time.Now()
+		sr := rep.server(server)
+		err := deployTo(server, plan, creds, out, sr)
+		sr.record(err, began)
+		return err
+	}
+	if len(targets) == 1 && cfg.Rollout == nil {
+		return deployOne(targets[0], stdout)
+	}
+	return runRollout(targets, cfg.Rollout, stdout, deployOne)
+}
+
+// buildPlan collects the files from all mappings, renders templates and
+// computes the hashes. Templates are hashed after rendering so delta
+// detection compares what actually lands on the server.
+func buildPlan(projectDir string, cfg *config.ClientConfig) (*deployPlan, error) {
+	plan := &deployPlan{projectDir: projectDir, cfg: cfg}
+	ok := false
+	defer func() {
+		if !ok {
+			plan.cleanup()
+		}
+	}()
+
+	var data *render.Data
 	var allFiles []localFile
 	for mi, m := range cfg.Deploy.Mappings {
 		srcDir := filepath.Join(projectDir, m.Src)
@@ -83,63 +191,202 @@ func Deploy(args []string, stdout, stderr io.Writer) error {
 			if archive.ShouldExclude(rel, false, m.Exclude) {
 				return nil
 			}
+			mode := m.Mode
+			var masker *secretMasker
+			if m.IsTemplate(rel) {
+				if data == nil {
+					if data, err = templateData(projectDir, cfg); err != nil {
+						return err
+					}
+				}
+				if path, masker, err = plan.renderTemplate(path, projectDir, *data); err != nil {
+					return err
+				}
+				// A file holding secrets is only readable by its owner
+				// unless the mapping says otherwise.
+				if masker != nil && mode == "" {
+					mode = "0600"
+				}
+			}
+			if mode == "" {
+				mode = "0644"
+			}
 			allFiles = append(allFiles, localFile{
+				relPath:     filepath.Join(m.Src, rel),
 				srcPath:     path,
 				dest:        filepath.Join(m.Dest, rel),
-				mode:        m.Mode,
+				mode:        mode,
 				archiveName: fmt.Sprintf("files/%d/%s", mi, rel),
+				secrets:     masker,
 			})
 			return nil
 		}); err != nil {
-			return fmt.Errorf("walking %s: %w", srcDir, err)
+			return nil, fmt.Errorf("walking %s: %w", srcDir, err)
 		}
 	}
 
 	// Compute hashes
-	checkFiles := make([]api.FileHashEntry, len(allFiles))
 	hashes := make(map[string]string, len(allFiles))
-	for i, f := range allFiles {
+	for _, f := range allFiles {
 		h, err := delta.HashFile(f.srcPath)
 		if err != nil {
-			return fmt.Errorf("hashing %s: %w", f.srcPath, err)
+			return nil, fmt.Errorf("hashing %s: %w", f.srcPath, err)
 		}
 		hashes[f.dest] = h
-		checkFiles[i] = api.FileHashEntry{Dest: f.dest, Hash: h}
 	}
 
-	// POST /check
-	checkBody, _ := json.Marshal(api.CheckRequest{Name: cfg.Name, Files: checkFiles})
-	checkResp, err := httpPost(cfg.Server+"/check", token, "application/json", checkBody)
+	plan.files, plan.hashes = allFiles, hashes
+	ok = true
+	return plan, nil
+}
+
+// renderTemplate renders the template at path into the plan's render dir and
+// returns the path of the rendered copy and, if it contains secrets, how to
+// mask them.
+func (p *deployPlan) renderTemplate(path, projectDir string, data render.Data) (string, *secretMasker, error) {
+	if p.renderDir == "" {
+		dir, err := os.MkdirTemp("", "eacd-render-")
+		if err != nil {
+			return "", nil, fmt.Errorf("creating render dir: %w", err)
+		}
+		p.renderDir = dir
+	}
+
+	var used []string
+	if secret := data.Secret; secret != nil {
+		data.Secret = func(name string) (string, error) {
+			v, err := secret(name)
+			if err == nil {
+				used = append(used, v)
+			}
+			return v, err
+		}
+	}
+
+	name, _ := filepath.Rel(projectDir, path)
+	out, err := render.File(path, name, data)
 	if err != nil {
-		return fmt.Errorf("check request: %w", err)
+		return "", nil, fmt.Errorf("rendering %s: %w", name, err)
 	}
-	defer checkResp.Body.Close()
-	if checkResp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(checkResp.Body)
-		return fmt.Errorf("check failed (%d): %s", checkResp.StatusCode, body)
+
+	var masker *secretMasker
+	if len(used) > 0 {
+		// Rendered once more with placeholders, so diffs can find the
+		// lines that hold secrets even where the server has older values.
+		data.Secret = func(string) (string, error) { return secretMask, nil }
+		masked, err := render.File(path, name, data)
+		if err != nil {
+			return "", nil, fmt.Errorf("rendering %s: %w", name, err)
+		}
+		masker = newSecretMasker(used, masked)
 	}
 
-	var checkResult api.CheckResponse
-	if err := json.NewDecoder(checkResp.Body).Decode(&checkResult); err != nil {
-		return fmt.Errorf("parsing check response: %w", err)
+	p.rendered++
+	dst := filepath.Join(p.renderDir, fmt.Sprintf("%d", p.rendered))
+	if err := os.WriteFile(dst, out, 0600); err != nil {
+		return "", nil, fmt.Errorf("writing rendered %s: %w", name, err)
 	}
+	return dst, masker, nil
+}
 
-	needed := make(map[string]bool, len(checkResult.Upload))
-	for _, d := range checkResult.Upload {
-		needed[d] = true
+// templateData merges the template vars: inventory vars are overridden by
+// config vars, which already include the environment overrides.
+func templateData(projectDir string, cfg *config.ClientConfig) (*render.Data, error) {
+	invVars, err := loadInventoryVars(filepath.Join(projectDir, cfg.Inventory))
+	if err != nil {
+		return nil, fmt.Errorf("reading vars from %s: %w", cfg.Inventory, err)
+	}
+	vars := make(map[string]string, len(invVars)+len(cfg.Vars))
+	for k, v := range invVars {
+		vars[k] = v
+	}
+	for k, v := range cfg.Vars {
+		vars[k] = v
+	}
+	data := &render.Data{Project: cfg.Name, Environment: cfg.Environment, Vars: vars}
+
+	// Secrets are only decrypted if a template actually uses them.
+	path := secretsPath(projectDir, cfg)
+	if _, err := os.Stat(path); err == nil {
+		var values map[string]string
+		data.Secret = func(name string) (string, error) {
+			if values == nil {
+				v, err := openSecrets(path)
+				if err != nil {
+					return "", err
+				}
+				values = v
+			}
+			v, ok := values[name]
+			if !ok {
+				return "", fmt.Errorf("secret %q not found in %s", name, filepath.Base(path))
+			}
+			return v, nil
+		}
+	}
+	return data, nil
+}
+
+// deployTo runs /check and /deploy against a single server. Counts, phases
+// and warnings are recorded in rep.
+func deployTo(server string, plan *deployPlan, creds credentials, stdout io.Writer, rep *serverReport) error {
+	cfg, projectDir, allFiles, hashes := plan.cfg, plan.projectDir, plan.files, plan.hashes
+
+	var features []string
+	if _, err := os.Stat(secretsPath(projectDir, cfg)); err == nil {
+		features = append(features, api.FeatureSecrets)
+	}
+	if plan.refuseDrift {
+		features = append(features, api.FeatureDrift)
+	}
+	if plan.signer != nil {
+		features = append(features, api.FeatureManifest)
+	}
+	if len(plan.webhooks) > 0 {
+		features = append(features, api.FeatureWebhooks)
+	}
+	if _, err := requireFeatures(server, creds, features...); err != nil {
+		return err
+	}
+
+	if plan.refuseDrift {
+		if err := refuseOnDrift(server, cfg.Name, creds, stdout); err != nil {
+			return err
+		}
+	}
+
+	needed, err := checkFiles(server, cfg.Name, allFiles, hashes, creds)
+	if err != nil {
+		return err
 	}
 	fmt.Fprintf(stdout, "[eacd] Files to upload: %d / %d\n", len(needed), len(allFiles))
+	rep.FilesUploaded, rep.FilesTotal = len(needed), len(allFiles)
 
 	// Build manifest + archive
-	manifest := api.Manifest{Name: cfg.Name}
+	manifest := api.Manifest{Name: cfg.Name, Meta: plan.meta, Size: &api.DeploySize{}, Webhooks: plan.webhooks}
 	var archiveBuf bytes.Buffer
 	tw, gw := archive.NewWriter(&archiveBuf)
 
+	// addFile adds path to the archive and counts it in manifest.Size.
+	addFile := func(path, name string, mode int64) error {
+		if err := archive.AddFile(tw, path, name, mode); err != nil {
+			return err
+		}
+		if fi, err := os.Stat(path); err == nil {
+			manifest.Size.Uncompressed += fi.Size()
+		}
+		manifest.Size.Entries++
+		return nil
+	}
+
 	for _, f := range allFiles {
 		entry := api.FileEntry{Dest: f.dest, Mode: f.mode, Hash: hashes[f.dest]}
+		if fi, err := os.Stat(f.srcPath); err == nil {
+			entry.Size = fi.Size()
+		}
 		if needed[f.dest] {
 			entry.ArchivePath = f.archiveName
-			if err := archive.AddFile(tw, f.srcPath, f.archiveName, 0644); err != nil {
+			if err := addFile(f.srcPath, f.archiveName, 0644); err != nil {
 				return fmt.Errorf("adding %s: %w", f.srcPath, err)
 			}
 		}
@@ -151,18 +398,24 @@ func Deploy(args []string, stdout, stderr io.Writer) error {
 		manifest.Hooks = &api.HooksEntry{}
 	}
 	if cfg.Hooks.ServerPre != "" {
-		name := "scripts/pre-deploy.sh"
-		if err := archive.AddFile(tw, filepath.Join(projectDir, cfg.Hooks.ServerPre), name, 0755); err != nil {
+		name, path := "scripts/pre-deploy.sh", filepath.Join(projectDir, cfg.Hooks.ServerPre)
+		if err := addFile(path, name, 0755); err != nil {
 			return fmt.Errorf("adding pre script: %w", err)
 		}
 		manifest.Hooks.ServerPre = name
+		if manifest.Hooks.ServerPreHash, err = delta.HashFile(path); err != nil {
+			return fmt.Errorf("hashing pre script: %w", err)
+		}
 	}
 	if cfg.Hooks.ServerPost != "" {
-		name := "scripts/post-deploy.sh"
-		if err := archive.AddFile(tw, filepath.Join(projectDir, cfg.Hooks.ServerPost), name, 0755); err != nil {
+		name, path := "scripts/post-deploy.sh", filepath.Join(projectDir, cfg.Hooks.ServerPost)
+		if err := addFile(path, name, 0755); err != nil {
 			return fmt.Errorf("adding post script: %w", err)
 		}
 		manifest.Hooks.ServerPost = name
+		if manifest.Hooks.ServerPostHash, err = delta.HashFile(path); err != nil {
+			return fmt.Errorf("hashing post script: %w", err)
+		}
 	}
 
 	// Systemd unit
@@ -170,63 +423,148 @@ func Deploy(args []string, stdout, stderr io.Writer) error {
 		unitPath := filepath.Join(projectDir, cfg.Deploy.Systemd.Unit)
 		unitName := filepath.Base(unitPath)
 		archiveName := "files/systemd/" + unitName
-		if err := archive.AddFile(tw, unitPath, archiveName, 0644); err != nil {
+		if err := addFile(unitPath, archiveName, 0644); err != nil {
 			return fmt.Errorf("adding unit file: %w", err)
 		}
+		unitHash, err := delta.HashFile(unitPath)
+		if err != nil {
+			return fmt.Errorf("hashing unit file: %w", err)
+		}
 		manifest.Systemd = &api.SystemdEntry{
 			UnitArchivePath: archiveName,
 			UnitDest:        "/etc/systemd/system/" + unitName,
+			UnitHash:        unitHash,
 			Enable:          cfg.Deploy.Systemd.Enable,
 			Restart:         cfg.Deploy.Systemd.Restart,
 		}
 	}
 
 	// Inventory
-	if inv, err := loadInventory(filepath.Join(projectDir, ".eacd", "inventory.yaml")); err == nil && inv != nil {
+	if inv, err := loadInventory(filepath.Join(projectDir, cfg.Inventory)); err == nil && inv != nil {
 		manifest.Inventory = inv
 	}
 
+	// Encrypted secrets are passed through; only the daemon decrypts them.
+	if data, err := os.ReadFile(secretsPath(projectDir, cfg)); err == nil {
+		manifest.Secrets = data
+	}
+
 	tw.Close()
 	gw.Close()
 
 	// POST /deploy
+	var signature string
+	if plan.signer != nil {
+		manifest.SignedAt, manifest.Nonce = signStamp()
+	}
 	manifestJSON, _ := json.Marshal(manifest)
-	body, contentType, err := buildMultipart(manifestJSON, archiveBuf.Bytes())
+	if plan.signer != nil {
+		signature = signing.Sign(plan.signer, manifestJSON)
+	}
+	body, contentType, err := buildMultipart(manifestJSON, signature, archiveBuf.Bytes())
 	if err != nil {
 		return fmt.Errorf("building request body: %w", err)
 	}
 
-	fmt.Fprintf(stdout, "[eacd] Deploying %s → %s\n", cfg.Name, cfg.Server)
-	deployResp, err := httpPost(cfg.Server+"/deploy", token, contentType, body)
+	rep.BytesSent = int64(len(body))
+	fmt.Fprintf(stdout, "[eacd] Deploying %s → %s\n", cfg.Name, server)
+	deployResp, err := httpPostStream(server+"/deploy", creds, contentType, body, nil)
 	if err != nil {
 		return fmt.Errorf("deploy request: %w", err)
 	}
 	defer deployResp.Body.Close()
 
 	if deployResp.StatusCode != http.StatusOK {
-		errBody, _ := io.ReadAll(deployResp.Body)
-		return fmt.Errorf("deployment failed (%d): %s", deployResp.StatusCode, bytes.TrimSpace(errBody))
+		return responseError(deployResp, "deployment")
 	}
-	return streamAndCheck(deployResp.Body, stdout, "deployment failed (see output above)")
+	return readStream(deployResp, stdout, "deployment", rep)
 }
 
-func httpPost(url, token, contentType string, body []byte) (*http.Response, error) {
+// checkFiles asks server which of files differ from what is on disk there
+// and returns their destinations.
+func checkFiles(server, name string, files []localFile, hashes map[string]string, creds credentials) (map[string]bool, error) {
+	entries := make([]api.FileHashEntry, len(files))
+	for i, f := range files {
+		entries[i] = api.FileHashEntry{Dest: f.dest, Hash: hashes[f.dest]}
+	}
+
+	checkBody, _ := json.Marshal(api.CheckRequest{Name: name, Files: entries})
+	checkResp, err := httpPost(server+"/check", creds, "application/json", checkBody)
+	if err != nil {
+		return nil, fmt.Errorf("check request: %w", err)
+	}
+	defer checkResp.Body.Close()
+	if checkResp.StatusCode != http.StatusOK {
+		return nil, responseError(checkResp, "check")
+	}
+
+	var checkResult api.CheckResponse
+	if err := json.NewDecoder(checkResp.Body).Decode(&checkResult); err != nil {
+		return nil, fmt.Errorf("parsing check response: %w", err)
+	}
+
+	needed := make(map[string]bool, len(checkResult.Upload))
+	for _, d := range checkResult.Upload {
+		needed[d] = true
+	}
+	return needed, nil
+}
+
+// authorize authenticates req, whose body is body, with creds.
+func authorize(req *http.Request, creds credentials, body []byte) error {
+	if creds.sign {
+		return auth.SignRequestURI(req, sshAPIRequestURI(req.URL), creds.token, body)
+	}
+	req.Header.Set("Authorization", "Bearer "+creds.token)
+	return nil
+}
+
+func httpPost(url string, creds credentials, contentType string, body []byte) (*http.Response, error) {
 	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("Authorization", "Bearer "+token)
+	if err := authorize(req, creds, body); err != nil {
+		return nil, err
+	}
 	req.Header.Set("Content-Type", contentType)
 	return http.DefaultClient.Do(req)
 }
 
-func buildMultipart(manifestJSON, archiveData []byte) ([]byte, string, error) {
+func httpGet(url string, creds credentials) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := authorize(req, creds, nil); err != nil {
+		return nil, err
+	}
+	return http.DefaultClient.Do(req)
+}
+
+// decodeJSONResponse closes resp and decodes its JSON body into v,
+// turning non-200 responses into errors.
+func decodeJSONResponse(resp *http.Response, v interface{}) error {
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// buildMultipart returns the body of a deploy request. A non-empty
+// signature of manifestJSON is sent as a header of the manifest part.
+func buildMultipart(manifestJSON []byte, signature string, archiveData []byte) ([]byte, string, error) {
 	var buf bytes.Buffer
 	mw := multipart.NewWriter(&buf)
 
 	mh := make(textproto.MIMEHeader)
 	mh.Set("Content-Disposition", `form-data; name="manifest"`)
 	mh.Set("Content-Type", "application/json")
+	if signature != "" {
+		mh.Set(api.ManifestSignatureHeader, signature)
+	}
 	pw, _ := mw.CreatePart(mh)
 	pw.Write(manifestJSON)
 
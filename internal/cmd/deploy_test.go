@@ -0,0 +1,143 @@
+package cmd
+
+import (
+	"crypto/ecdh"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/flo-mic/eacd/internal/config"
+	"github.com/flo-mic/eacd/internal/delta"
+	"github.com/flo-mic/eacd/internal/secrets"
+)
+
+func TestBuildPlan_RendersTemplatesBeforeHashing(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "dist"), 0755)
+	os.MkdirAll(filepath.Join(dir, ".eacd"), 0755)
+	os.WriteFile(filepath.Join(dir, "dist", "app.conf"), []byte("port={{ .Vars.port }} db={{ .Vars.db }}\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "dist", "static.txt"), []byte("{{ not rendered }}\n"), 0644)
+	os.WriteFile(filepath.Join(dir, ".eacd", "inventory.yaml"), []byte("vars:\n  port: 80\n  db: sqlite\n"), 0644)
+
+	cfg := &config.ClientConfig{
+		Name:      "app",
+		Inventory: ".eacd/inventory.yaml",
+		Vars:      map[string]string{"port": "8080"},
+		Deploy: config.DeployConfig{Mappings: []config.Mapping{
+			{Src: "dist", Dest: "/opt/app", Mode: "0644", Templates: []string{"*.conf"}},
+		}},
+	}
+
+	plan, err := buildPlan(dir, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer plan.cleanup()
+
+	var conf localFile
+	for _, f := range plan.files {
+		if f.dest == "/opt/app/app.conf" {
+			conf = f
+		}
+		if f.dest == "/opt/app/static.txt" && !strings.HasPrefix(f.srcPath, dir) {
+			t.Error("non-template file should not be rendered")
+		}
+	}
+	data, err := os.ReadFile(conf.srcPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Config vars override inventory vars.
+	if string(data) != "port=8080 db=sqlite\n" {
+		t.Errorf("rendered content = %q", data)
+	}
+	want, _ := delta.HashFile(conf.srcPath)
+	if plan.hashes[conf.dest] != want {
+		t.Error("hash should be computed from the rendered file")
+	}
+
+	plan.cleanup()
+	if _, err := os.Stat(conf.srcPath); !os.IsNotExist(err) {
+		t.Error("cleanup should remove rendered files")
+	}
+}
+
+func TestBuildPlan_TemplateErrorNamesFile(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "dist"), 0755)
+	os.WriteFile(filepath.Join(dir, "dist", "app.conf"), []byte("ok\n{{ .Vars.missing }}\n"), 0644)
+
+	cfg := &config.ClientConfig{
+		Name:      "app",
+		Inventory: ".eacd/inventory.yaml",
+		Deploy: config.DeployConfig{Mappings: []config.Mapping{
+			{Src: "dist", Dest: "/opt/app", Mode: "0644", Template: true},
+		}},
+	}
+
+	_, err := buildPlan(dir, cfg)
+	if err == nil {
+		t.Fatal("expected rendering error")
+	}
+	if !strings.Contains(err.Error(), filepath.Join("dist", "app.conf")+":2") {
+		t.Errorf("error should point to file and line, got %v", err)
+	}
+}
+
+func TestBuildPlan_SecretTemplatesArePrivate(t *testing.T) {
+	localKey, _ := secrets.GenerateKey()
+	t.Setenv("EACD_SECRETS_KEY", secrets.EncodePrivateKey(localKey))
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "dist"), 0755)
+	os.MkdirAll(filepath.Join(dir, ".eacd"), 0755)
+	os.WriteFile(filepath.Join(dir, "dist", "db.conf"), []byte(`password={{ secret "db_password" }}`+"\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "dist", "app.conf"), []byte("port=80\n"), 0644)
+	f, err := secrets.Seal(map[string]string{"db_password": "hunter2"}, map[string]*ecdh.PublicKey{localRecipient: localKey.PublicKey()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	secrets.WriteFile(filepath.Join(dir, ".eacd", "secrets.enc"), f)
+
+	os.WriteFile(filepath.Join(dir, ".eacd", "inventory.yaml"), []byte("vars: {}\n"), 0644)
+	os.WriteFile(filepath.Join(dir, ".eacd", "config.yaml"), []byte(`name: app
+server: http://host:8765
+deploy:
+  mappings:
+    - src: dist
+      dest: /opt/app
+      templates: ["*.conf"]
+    - src: dist
+      dest: /opt/shared
+      mode: "0640"
+      templates: ["*.conf"]
+`), 0644)
+
+	// Loaded like the real command, so the config defaults apply.
+	cfg, err := config.LoadClientConfig(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := buildPlan(dir, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer plan.cleanup()
+
+	for _, f := range plan.files {
+		switch f.dest {
+		case "/opt/app/db.conf":
+			if f.mode != "0600" || f.secrets == nil {
+				t.Errorf("db.conf: mode %q, masker %v", f.mode, f.secrets)
+			}
+		case "/opt/app/app.conf":
+			if f.mode != "0644" || f.secrets != nil {
+				t.Errorf("app.conf: mode %q, masker %v", f.mode, f.secrets)
+			}
+		case "/opt/shared/db.conf":
+			if f.mode != "0640" {
+				t.Errorf("db.conf with an explicit mode: mode %q", f.mode)
+			}
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/flo-mic/eacd/internal/api"
+	"github.com/flo-mic/eacd/internal/textdiff"
+)
+
+// Diff prints a unified diff between the local build and the deployed files
+// that differ on each server. Paths limit the output to files whose
+// destination or project-relative source lies under one of them.
+func Diff(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	dir := fs.String("dir", ".", "Project directory (default: current directory)")
+	env := fs.String("env", "", "Environment from the 'environments:' block")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	projectDir, cfg, err := loadProject(*dir, *env)
+	if err != nil {
+		return err
+	}
+	creds, err := resolveToken(cfg, stderr)
+	if err != nil {
+		return err
+	}
+
+	plan, err := buildPlan(projectDir, cfg)
+	if err != nil {
+		return err
+	}
+	defer plan.cleanup()
+
+	files := filterFiles(plan.files, fs.Args())
+	if len(files) == 0 {
+		return fmt.Errorf("no deployed files match %s", strings.Join(fs.Args(), ", "))
+	}
+
+	targets := cfg.Targets()
+	for _, server := range targets {
+		if len(targets) > 1 {
+			fmt.Fprintf(stdout, "[eacd] %s\n", hostLabel(server))
+		}
+		if _, err := diffTo(server, plan, files, creds, stdout); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// filterFiles keeps the files whose destination or project-relative source
+// equals or lies under one of paths. No paths keeps all files.
+func filterFiles(files []localFile, paths []string) []localFile {
+	if len(paths) == 0 {
+		return files
+	}
+	var out []localFile
+	for _, f := range files {
+		for _, p := range paths {
+			if underPath(f.dest, p) || underPath(f.relPath, p) {
+				out = append(out, f)
+				break
+			}
+		}
+	}
+	return out
+}
+
+func underPath(path, prefix string) bool {
+	prefix = filepath.Clean(prefix)
+	return prefix == "." || path == prefix || strings.HasPrefix(path, strings.TrimSuffix(prefix, "/")+"/")
+}
+
+// diffTo prints a diff for every file in files that differs on server and
+// returns how many differ. Only the project's declared destinations are
+// ever requested from the server.
+func diffTo(server string, plan *deployPlan, files []localFile, creds credentials, stdout io.Writer) (int, error) {
+	if _, err := requireFeatures(server, creds, api.FeatureFiles); err != nil {
+		return 0, err
+	}
+	needed, err := checkFiles(server, plan.cfg.Name, files, plan.hashes, creds)
+	if err != nil {
+		return 0, err
+	}
+	var changed []localFile
+	for _, f := range files {
+		if needed[f.dest] {
+			changed = append(changed, f)
+		}
+	}
+	sort.Slice(changed, func(i, j int) bool { return changed[i].dest < changed[j].dest })
+
+	fmt.Fprintf(stdout, "[eacd] Files that differ: %d / %d\n", len(changed), len(files))
+	if len(changed) == 0 {
+		return 0, nil
+	}
+
+	remote, err := fetchRemoteFiles(server, plan.cfg.Name, changed, creds)
+	if err != nil {
+		return 0, err
+	}
+	for _, f := range changed {
+		local, err := os.ReadFile(f.srcPath)
+		if err != nil {
+			return 0, fmt.Errorf("reading %s: %w", f.relPath, err)
+		}
+		writeFileDiff(stdout, f, local, plan.hashes[f.dest], remote[f.dest])
+	}
+	return len(changed), nil
+}
+
+func fetchRemoteFiles(server, name string, files []localFile, creds credentials) (map[string]api.RemoteFile, error) {
+	req := api.FilesRequest{Name: name}
+	for _, f := range files {
+		req.Paths = append(req.Paths, f.dest)
+	}
+	body, _ := json.Marshal(req)
+	resp, err := httpPost(server+"/files", creds, "application/json", body)
+	if err != nil {
+		return nil, fmt.Errorf("files request: %w", err)
+	}
+	var result api.FilesResponse
+	if err := decodeJSONResponse(resp, &result); err != nil {
+		return nil, fmt.Errorf("files request to %s: %w", server, err)
+	}
+	out := make(map[string]api.RemoteFile, len(result.Files))
+	for _, rf := range result.Files {
+		out[rf.Dest] = rf
+	}
+	return out, nil
+}
+
+// writeFileDiff prints the diff of one file, or a size and hash summary when
+// either side is binary, the server did not return the content or the files
+// are too large or too different to diff.
+func writeFileDiff(w io.Writer, f localFile, local []byte, localHash string, remote api.RemoteFile) {
+	localName := "local/" + filepath.ToSlash(f.relPath)
+	localBinary := bytes.IndexByte(head(local), 0) >= 0
+	// Diffs end up in CI logs, so secrets are masked on both sides.
+	local, remote.Content = f.secrets.mask(local), f.secrets.mask(remote.Content)
+
+	switch {
+	case !remote.Exists:
+		if localBinary {
+			fmt.Fprintf(w, "New binary file %s (%d bytes, %s)\n", f.dest, len(local), localHash)
+			return
+		}
+		d, err := textdiff.Unified("/dev/null", localName, "", string(local), 3)
+		if err != nil {
+			fmt.Fprintf(w, "New file %s (%d bytes, %s); %v\n", f.dest, len(local), localHash, err)
+			return
+		}
+		fmt.Fprint(w, d)
+	case !remote.Managed:
+		fmt.Fprintf(w, "%s exists on the server but was not deployed by eacd; content not shown\n", f.dest)
+	case remote.Binary || remote.TooLarge || localBinary:
+		fmt.Fprintf(w, "Binary files differ: %s\n", f.dest)
+		fmt.Fprintf(w, "  remote: %d bytes, %s\n", remote.Size, remote.Hash)
+		fmt.Fprintf(w, "  local:  %d bytes, %s\n", len(local), localHash)
+	default:
+		d, err := textdiff.Unified("remote"+f.dest, localName, string(remote.Content), string(local), 3)
+		if err != nil {
+			fmt.Fprintf(w, "Files differ: %s (%v)\n", f.dest, err)
+			fmt.Fprintf(w, "  remote: %d bytes, %s\n", remote.Size, remote.Hash)
+			fmt.Fprintf(w, "  local:  %d bytes, %s\n", len(local), localHash)
+			return
+		}
+		if d == "" {
+			fmt.Fprintf(w, "%s: only secret values differ\n", f.dest)
+			return
+		}
+		fmt.Fprint(w, d)
+	}
+}
+
+// secretMask replaces secret values in diffs.
+const secretMask = "<secret>"
+
+// secretMasker hides the secrets of a rendered template in diffs, which end
+// up in CI logs.
+type secretMasker struct {
+	values []string // secret values, longest first
+	lines  []maskedLine
+}
+
+// maskedLine is a line of the template that holds a secret.
+type maskedLine struct {
+	re     *regexp.Regexp // the line with any text in place of the secrets
+	masked string         // the line with secretMask in place of the secrets
+}
+
+// newSecretMasker returns a masker for the secret values a template was
+// rendered with; masked is the template rendered with secretMask instead.
+func newSecretMasker(values []string, masked []byte) *secretMasker {
+	m := &secretMasker{}
+	for _, v := range values {
+		if v != "" && !slices.Contains(m.values, v) {
+			m.values = append(m.values, v)
+		}
+	}
+	sort.Slice(m.values, func(i, j int) bool { return len(m.values[i]) > len(m.values[j]) })
+	for _, line := range strings.Split(string(masked), "\n") {
+		if !strings.Contains(line, secretMask) {
+			continue
+		}
+		parts := strings.Split(line, secretMask)
+		for i, p := range parts {
+			parts[i] = regexp.QuoteMeta(p)
+		}
+		re := regexp.MustCompile("^" + strings.Join(parts, ".*") + "$")
+		m.lines = append(m.lines, maskedLine{re, line})
+	}
+	return m
+}
+
+// mask returns data with the secret values replaced by secretMask, and
+// lines shaped like a line holding a secret replaced by its masked form, so
+// values the server still has from before a change are hidden as well.
+func (m *secretMasker) mask(data []byte) []byte {
+	if m == nil || len(data) == 0 {
+		return data
+	}
+	for _, v := range m.values {
+		data = bytes.ReplaceAll(data, []byte(v), []byte(secretMask))
+	}
+	lines := strings.Split(string(data), "\n")
+	for i, line := range lines {
+		for _, ml := range m.lines {
+			if ml.re.MatchString(line) {
+				lines[i] = ml.masked
+				break
+			}
+		}
+	}
+	return []byte(strings.Join(lines, "\n"))
+}
+
+// head returns the part of data checked for NUL bytes, as on the server.
+func head(data []byte) []byte {
+	if len(data) > 8000 {
+		return data[:8000]
+	}
+	return data
+}
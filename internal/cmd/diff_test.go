@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/flo-mic/eacd/internal/api"
+)
+
+func TestFilterFiles(t *testing.T) {
+	files := []localFile{
+		{relPath: "dist/index.html", dest: "/var/www/html/index.html"},
+		{relPath: "dist/css/site.css", dest: "/var/www/html/css/site.css"},
+		{relPath: "conf/app.conf", dest: "/etc/app/app.conf"},
+	}
+	cases := []struct {
+		paths []string
+		want  int
+	}{
+		{nil, 3},
+		{[]string{"/var/www/html"}, 2},
+		{[]string{"/var/www/html/css/"}, 1},
+		{[]string{"conf/app.conf"}, 1},
+		{[]string{"dist/index.html", "/etc/app"}, 2},
+		{[]string{"/var/www/htm"}, 0},
+	}
+	for _, c := range cases {
+		if got := filterFiles(files, c.paths); len(got) != c.want {
+			t.Errorf("filterFiles(%v) = %d files, want %d", c.paths, len(got), c.want)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	var requested []string
+	srv := httptest.NewServer(withVersion(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/check":
+			json.NewEncoder(w).Encode(api.CheckResponse{Upload: []string{"/opt/app/app.conf", "/opt/app/logo.png", "/opt/app/new.txt"}})
+		case "/files":
+			var req api.FilesRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			requested = req.Paths
+			json.NewEncoder(w).Encode(api.FilesResponse{Files: []api.RemoteFile{
+				{Dest: "/opt/app/app.conf", Exists: true, Managed: true, Content: []byte("port = 80\nworkers = 2\n")},
+				{Dest: "/opt/app/logo.png", Exists: true, Managed: true, Binary: true, Size: 3, Hash: "sha256:old"},
+				{Dest: "/opt/app/new.txt"},
+			}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, ".eacd"), 0755)
+	os.MkdirAll(filepath.Join(dir, "dist"), 0755)
+	cfg := "name: app\nserver: " + srv.URL + "\ntoken_env: EACD_TEST_TOKEN\ndeploy:\n  mappings:\n    - src: dist\n      dest: /opt/app\n"
+	os.WriteFile(filepath.Join(dir, ".eacd", "config.yaml"), []byte(cfg), 0644)
+	os.WriteFile(filepath.Join(dir, "dist", "app.conf"), []byte("port = 8080\nworkers = 2\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "dist", "logo.png"), []byte{0x89, 0, 1, 2}, 0644)
+	os.WriteFile(filepath.Join(dir, "dist", "new.txt"), []byte("hello\n"), 0644)
+	t.Setenv("EACD_TEST_TOKEN", "secret")
+
+	var out bytes.Buffer
+	if err := Diff([]string{"--dir", dir}, &out, &out); err != nil {
+		t.Fatal(err)
+	}
+	s := out.String()
+	for _, want := range []string{
+		"--- remote/opt/app/app.conf\n+++ local/dist/app.conf\n",
+		"-port = 80\n+port = 8080\n",
+		"Binary files differ: /opt/app/logo.png",
+		"local:  4 bytes, sha256:",
+		"--- /dev/null\n+++ local/dist/new.txt\n",
+	} {
+		if !strings.Contains(s, want) {
+			t.Errorf("output missing %q:\n%s", want, s)
+		}
+	}
+	if len(requested) != 3 {
+		t.Errorf("requested %v from the server", requested)
+	}
+
+	out.Reset()
+	if err := Diff([]string{"--dir", dir, "/opt/app/app.conf"}, &out, &out); err != nil {
+		t.Fatal(err)
+	}
+	if len(requested) != 1 || requested[0] != "/opt/app/app.conf" {
+		t.Errorf("path filter: requested %v", requested)
+	}
+}
+
+func TestWriteFileDiffMasksSecrets(t *testing.T) {
+	masker := newSecretMasker([]string{"hunter2"}, []byte("user=api\npassword=<secret>\n"))
+	f := localFile{relPath: "dist/db.conf", dest: "/opt/app/db.conf", secrets: masker}
+	// The server still has the value from before the secret was changed.
+	remote := api.RemoteFile{Exists: true, Managed: true, Content: []byte("user=app\npassword=hunter1\n")}
+
+	var out bytes.Buffer
+	writeFileDiff(&out, f, []byte("user=api\npassword=hunter2\n"), "sha256:x", remote)
+	if strings.Contains(out.String(), "hunter") {
+		t.Errorf("secret not masked:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), "-user=app\n+user=api\n password=<secret>\n") {
+		t.Errorf("unexpected diff:\n%s", out.String())
+	}
+
+	out.Reset()
+	remote.Content = []byte("user=api\npassword=hunter1\n")
+	writeFileDiff(&out, f, []byte("user=api\npassword=hunter2\n"), "sha256:x", remote)
+	if out.String() != "/opt/app/db.conf: only secret values differ\n" {
+		t.Errorf("got:\n%s", out.String())
+	}
+}
@@ -0,0 +1,529 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/flo-mic/eacd/internal/api"
+	"github.com/flo-mic/eacd/internal/archive"
+	"github.com/flo-mic/eacd/internal/auth"
+	"github.com/flo-mic/eacd/internal/config"
+	"github.com/flo-mic/eacd/internal/version"
+)
+
+// Results of a doctor check.
+const (
+	checkOK   = "ok"
+	checkWarn = "warn" // works, but likely not as intended
+	checkFail = "fail" // a deploy would fail
+)
+
+// doctorTimeout bounds each network check.
+const doctorTimeout = 10 * time.Second
+
+// maxClockDrift is the clock difference doctor warns about even without
+// auth: hmac, as it skews the times in the audit log and release history.
+const maxClockDrift = time.Minute
+
+// finding is the result of one doctor check.
+type finding struct {
+	Server  string `json:"server,omitempty"` // empty for local checks
+	Check   string `json:"check"`
+	Status  string `json:"status"` // ok, warn or fail
+	Message string `json:"message"`
+	Fix     string `json:"fix,omitempty"`
+}
+
+// doctorReport is the --output json document of eacd doctor.
+type doctorReport struct {
+	Version     int       `json:"version"`
+	Project     string    `json:"project,omitempty"`
+	Environment string    `json:"environment,omitempty"`
+	Checks      []finding `json:"checks"`
+	Failed      int       `json:"failed"`
+	Warnings    int       `json:"warnings"`
+}
+
+// doctor runs the checks of one project.
+type doctor struct {
+	projectDir string
+	cfg        *config.ClientConfig
+	creds      credentials
+	inv        *api.Inventory
+	report     *doctorReport
+}
+
+func (d *doctor) add(server, status, check, message, fix string) {
+	d.report.Checks = append(d.report.Checks, finding{Server: server, Check: check, Status: status, Message: message, Fix: fix})
+	switch status {
+	case checkFail:
+		d.report.Failed++
+	case checkWarn:
+		d.report.Warnings++
+	}
+}
+
+// Doctor checks the project config, the local files a deploy needs and
+// every server it deploys to, and suggests a fix for each problem found.
+func Doctor(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	dir := fs.String("dir", ".", "Project directory (default: current directory)")
+	env := fs.String("env", "", "Environment from the 'environments:' block")
+	output := fs.String("output", OutputText, "Output format: text or json")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := checkOutput(*output, OutputText, OutputJSON); err != nil {
+		return err
+	}
+
+	d := &doctor{report: &doctorReport{Version: reportVersion, Checks: []finding{}}}
+	projectDir, cfg, err := loadProject(*dir, *env)
+	if err != nil {
+		fix := "correct .eacd/config.yaml"
+		if errors.Is(err, os.ErrNotExist) {
+			fix = "run eacd init in the project directory, or pass --dir"
+		}
+		d.add("", checkFail, "config", err.Error(), fix)
+	} else {
+		d.projectDir, d.cfg = projectDir, cfg
+		d.report.Project, d.report.Environment = cfg.Name, cfg.Environment
+		d.add("", checkOK, "config", ".eacd/config.yaml is valid", "")
+		d.checkLocal()
+		if d.creds.token != "" {
+			for _, server := range cfg.Targets() {
+				d.checkServer(server)
+			}
+		}
+	}
+
+	if *output == OutputJSON {
+		if err := writeJSON(stdout, d.report); err != nil {
+			return err
+		}
+	} else {
+		printFindings(stdout, d.report)
+	}
+	if d.report.Failed > 0 {
+		return fmt.Errorf("%d of %d checks failed", d.report.Failed, len(d.report.Checks))
+	}
+	return nil
+}
+
+// printFindings prints the checks grouped by server, each problem followed
+// by its fix.
+func printFindings(w io.Writer, rep *doctorReport) {
+	server := "-"
+	for _, f := range rep.Checks {
+		if f.Server != server {
+			server = f.Server
+			if server == "" {
+				label := rep.Project
+				if label == "" {
+					label = "project"
+				}
+				if rep.Environment != "" {
+					label += " (environment " + rep.Environment + ")"
+				}
+				fmt.Fprintf(w, "[eacd] Checking %s\n", label)
+			} else {
+				fmt.Fprintf(w, "[eacd] Checking %s\n", hostLabel(server))
+			}
+		}
+		fmt.Fprintf(w, "  %-4s  %-9s %s\n", strings.ToUpper(f.Status), f.Check, f.Message)
+		if f.Fix != "" {
+			fmt.Fprintf(w, "  %-4s  %-9s fix: %s\n", "", "", f.Fix)
+		}
+	}
+	if rep.Failed == 0 && rep.Warnings == 0 {
+		fmt.Fprintf(w, "[eacd] All %d checks passed\n", len(rep.Checks))
+		return
+	}
+	fmt.Fprintf(w, "[eacd] %d failed, %d warnings\n", rep.Failed, rep.Warnings)
+}
+
+// checkLocal checks the token and the files referenced by the config.
+func (d *doctor) checkLocal() {
+	cfg := d.cfg
+	creds, err := resolveToken(cfg, io.Discard)
+	switch {
+	case err != nil:
+		d.add("", checkFail, "token", err.Error(), fmt.Sprintf("export %s=<token>", cfg.TokenEnv))
+	case os.Getenv(cfg.TokenEnv) == "":
+		d.add("", checkWarn, "token", "token is hardcoded in .eacd/config.yaml",
+			fmt.Sprintf("move it to the %s env var and remove token: from the config", cfg.TokenEnv))
+	default:
+		d.add("", checkOK, "token", "read from "+cfg.TokenEnv, "")
+	}
+	d.creds = creds
+
+	for _, hook := range []struct{ key, path string }{
+		{"hooks.local_pre", cfg.Hooks.LocalPre},
+		{"hooks.server_pre", cfg.Hooks.ServerPre},
+		{"hooks.server_post", cfg.Hooks.ServerPost},
+	} {
+		if hook.path == "" {
+			continue
+		}
+		fi, err := os.Stat(filepath.Join(d.projectDir, hook.path))
+		switch {
+		case os.IsNotExist(err):
+			d.add("", checkFail, "hooks", fmt.Sprintf("%s: %s does not exist", hook.key, hook.path),
+				fmt.Sprintf("create it or remove %s from .eacd/config.yaml", hook.key))
+		case err != nil:
+			d.add("", checkFail, "hooks", err.Error(), "")
+		case !fi.Mode().IsRegular():
+			d.add("", checkFail, "hooks", fmt.Sprintf("%s: %s is not a file", hook.key, hook.path), "")
+		case fi.Mode().Perm()&0111 == 0:
+			d.add("", checkWarn, "hooks", fmt.Sprintf("%s: %s is not executable", hook.key, hook.path), "chmod +x "+hook.path)
+		default:
+			d.add("", checkOK, "hooks", fmt.Sprintf("%s: %s", hook.key, hook.path), "")
+		}
+	}
+
+	if s := cfg.Deploy.Systemd; s != nil {
+		if _, err := os.Stat(filepath.Join(d.projectDir, s.Unit)); err != nil {
+			d.add("", checkFail, "systemd", fmt.Sprintf("unit %s does not exist", s.Unit),
+				"create it or remove deploy.systemd from .eacd/config.yaml")
+		} else {
+			d.add("", checkOK, "systemd", "unit "+s.Unit, "")
+		}
+	}
+
+	for _, m := range cfg.Deploy.Mappings {
+		n, err := countFiles(filepath.Join(d.projectDir, m.Src), m.Exclude)
+		switch {
+		case os.IsNotExist(err):
+			d.add("", checkFail, "mappings", fmt.Sprintf("src %s does not exist", m.Src),
+				"build the project first, or correct src in .eacd/config.yaml")
+		case err != nil:
+			d.add("", checkFail, "mappings", fmt.Sprintf("src %s: %v", m.Src, err), "")
+		case n == 0:
+			d.add("", checkWarn, "mappings", fmt.Sprintf("src %s has no files to deploy", m.Src),
+				"build the project first, or check the exclude patterns")
+		default:
+			d.add("", checkOK, "mappings", fmt.Sprintf("%s: %d file(s) → %s", m.Src, n, m.Dest), "")
+		}
+	}
+
+	inv, err := loadInventory(filepath.Join(d.projectDir, cfg.Inventory))
+	if err != nil {
+		d.add("", checkFail, "inventory", err.Error(), "correct "+cfg.Inventory)
+	}
+	d.inv = inv
+
+	if _, err := loadSigningKey(d.projectDir, cfg); err != nil {
+		d.add("", checkFail, "signing", err.Error(),
+			fmt.Sprintf("create the key with eacd keygen or set %s", SigningKeyEnv))
+	}
+	if _, err := projectWebhooks(cfg); err != nil {
+		d.add("", checkFail, "webhooks", err.Error(), "export the variable named by secret_env")
+	}
+}
+
+// countFiles returns the number of files under dir that a deploy would
+// upload.
+func countFiles(dir string, exclude []string) (int, error) {
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return 0, err
+	}
+	if !fi.IsDir() {
+		return 0, fmt.Errorf("not a directory")
+	}
+	n := 0
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, path)
+		if info.IsDir() {
+			if rel != "." && archive.ShouldExclude(rel, true, exclude) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !archive.ShouldExclude(rel, false, exclude) {
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
+
+// get requests path on server, authenticated if authenticated is set, and
+// returns the response with its body.
+func (d *doctor) get(server, path string, authenticated bool) (*http.Response, []byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), doctorTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server+path, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if authenticated {
+		if err := authorize(req, d.creds, nil); err != nil {
+			return nil, nil, err
+		}
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	return resp, body, err
+}
+
+// checkServer checks that server is reachable, accepts the token, speaks a
+// compatible protocol and can run the project's deploys. It stops at the
+// first check the others depend on.
+func (d *doctor) checkServer(server string) {
+	u, err := url.Parse(server)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "ssh") {
+		d.add(server, checkFail, "url", fmt.Sprintf("%q is not a server URL", server),
+			"use http://host:8765, https://host or ssh://user@host/run/eacd.sock")
+		return
+	}
+	host, port := u.Hostname(), u.Port()
+	if port == "" {
+		port = map[string]string{"http": "80", "https": "443", "ssh": "22"}[u.Scheme]
+	}
+
+	if net.ParseIP(host) == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), doctorTimeout)
+		addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+		cancel()
+		if err != nil {
+			d.add(server, checkFail, "dns", err.Error(), "check the host name in .eacd/config.yaml and your DNS or /etc/hosts")
+			return
+		}
+		d.add(server, checkOK, "dns", fmt.Sprintf("%s resolves to %s", host, strings.Join(addrs, ", ")), "")
+	}
+
+	addr := net.JoinHostPort(host, port)
+	conn, err := net.DialTimeout("tcp", addr, doctorTimeout)
+	if err != nil {
+		fix := fmt.Sprintf("check that eacdd runs (systemctl status eacdd), listens on port %s (listen: in server.yaml) and that no firewall blocks it", port)
+		if u.Scheme == "ssh" {
+			fix = fmt.Sprintf("check that sshd runs on the server and port %s is open", port)
+		}
+		d.add(server, checkFail, "tcp", fmt.Sprintf("cannot connect to %s: %v", addr, err), fix)
+		return
+	}
+	conn.Close()
+	d.add(server, checkOK, "tcp", addr+" accepts connections", "")
+
+	resp, body, err := d.get(server, "/health", false)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		msg := fmt.Sprint(err)
+		if err == nil {
+			msg = fmt.Sprintf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+		}
+		fix := "check that the URL points at eacdd, with https:// only if it is behind a TLS proxy"
+		if u.Scheme == "ssh" {
+			fix = "check that ssh " + u.Host + " works without a password prompt and eacdd listens on the socket in the URL"
+		}
+		d.add(server, checkFail, "health", msg, fix)
+		return
+	}
+	d.add(server, checkOK, "health", "eacdd is up", "")
+	d.checkClock(server, resp)
+
+	v := d.checkToken(server)
+	if v == nil {
+		return
+	}
+	if err := checkProtocol(server, v); err != nil {
+		fix := "install a newer eacd"
+		if v.Protocol < api.MinProtocolVersion {
+			fix = "eacd upgrade-daemon --binary <new eacdd>"
+		}
+		d.add(server, checkFail, "version", err.Error(), fix)
+		return
+	}
+	d.add(server, checkOK, "version", fmt.Sprintf("eacdd %s (protocol %d), eacd %s (protocol %d)",
+		v.Version, v.Protocol, version.String(), api.ProtocolVersion), "")
+
+	var missing []string
+	for _, f := range d.neededFeatures() {
+		if !v.HasFeature(f) {
+			missing = append(missing, f)
+		}
+	}
+	if len(missing) > 0 {
+		d.add(server, checkFail, "features", fmt.Sprintf("eacdd %s does not support %s, which this project uses", v.Version, strings.Join(missing, ", ")),
+			"eacd upgrade-daemon --binary <new eacdd>")
+	}
+
+	if !v.HasFeature(api.FeatureHealth) {
+		d.add(server, checkWarn, "server", fmt.Sprintf("eacdd %s does not report disk space, systemd or the package manager", v.Version),
+			"eacd upgrade-daemon --binary <new eacdd>")
+		return
+	}
+	d.checkHost(server)
+}
+
+// checkClock compares the Date header of resp with the local clock.
+func (d *doctor) checkClock(server string, resp *http.Response) {
+	date, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return
+	}
+	skew := time.Since(date).Round(time.Second)
+	if skew < 0 {
+		skew = -skew
+	}
+	const fix = "sync both clocks with NTP, e.g. timedatectl set-ntp true"
+	switch {
+	case skew > auth.MaxSkew && d.creds.sign:
+		d.add(server, checkFail, "clock", fmt.Sprintf("clocks differ by %s; auth: hmac allows %s", skew, auth.MaxSkew), fix)
+	case skew > maxClockDrift:
+		d.add(server, checkWarn, "clock", fmt.Sprintf("clocks differ by %s", skew), fix)
+	default:
+		d.add(server, checkOK, "clock", "in sync with the server", "")
+	}
+}
+
+// checkToken calls GET /version, the no-op every token may use, and returns
+// its response, or nil if the token was rejected.
+func (d *doctor) checkToken(server string) *api.VersionResponse {
+	resp, body, err := d.get(server, "/version", true)
+	if err != nil {
+		d.add(server, checkFail, "token", err.Error(), "")
+		return nil
+	}
+	msg := fmt.Sprintf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	switch resp.StatusCode {
+	case http.StatusOK:
+		var v api.VersionResponse
+		if err := json.Unmarshal(body, &v); err != nil {
+			d.add(server, checkFail, "token", "invalid /version response: "+err.Error(), "")
+			return nil
+		}
+		d.add(server, checkOK, "token", "accepted", "")
+		return &v
+	case http.StatusNotFound:
+		d.add(server, checkWarn, "token", "eacdd predates GET /version, the token cannot be checked before a deploy",
+			"eacd upgrade-daemon --binary <new eacdd>")
+		return legacyDaemon()
+	case http.StatusUnauthorized:
+		fix := fmt.Sprintf("check %s against the tokens in server.yaml; if the server sets require_signed_requests, add auth: hmac", d.cfg.TokenEnv)
+		if d.creds.sign {
+			fix = fmt.Sprintf("check %s against the tokens in server.yaml, that eacdd supports auth: hmac and that both clocks are within %s", d.cfg.TokenEnv, auth.MaxSkew)
+		}
+		d.add(server, checkFail, "token", "rejected: "+msg, fix)
+	case http.StatusForbidden:
+		d.add(server, checkFail, "token", "forbidden: "+msg, "use a token with the read scope, from an address in allow_cidrs")
+	case http.StatusTooManyRequests:
+		d.add(server, checkFail, "token", "rate limited: "+msg, "wait until the limit or the ban after failed logins (auth_failures) expires")
+	default:
+		d.add(server, checkFail, "token", msg, "")
+	}
+	return nil
+}
+
+// neededFeatures returns the daemon features the project's deploys use.
+func (d *doctor) neededFeatures() []string {
+	var features []string
+	if _, err := os.Stat(secretsPath(d.projectDir, d.cfg)); err == nil {
+		features = append(features, api.FeatureSecrets)
+	}
+	if d.cfg.RefuseDrift {
+		features = append(features, api.FeatureDrift)
+	}
+	if d.cfg.SigningKey != "" || os.Getenv(SigningKeyEnv) != "" {
+		features = append(features, api.FeatureManifest)
+	}
+	if d.creds.sign {
+		features = append(features, api.FeatureSigning)
+	}
+	if len(d.cfg.Webhooks) > 0 {
+		features = append(features, api.FeatureWebhooks)
+	}
+	return features
+}
+
+// checkHost reports the server side of GET /health?verbose=1: free disk
+// space, the state dir and what the inventory and systemd unit need.
+func (d *doctor) checkHost(server string) {
+	resp, body, err := d.get(server, "/health?verbose=1", true)
+	var h api.HealthResponse
+	if err == nil && resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	if err == nil {
+		err = json.Unmarshal(body, &h)
+	}
+	if err != nil {
+		d.add(server, checkFail, "server", "health report: "+err.Error(), "")
+		return
+	}
+
+	problems := h.Problems
+	for _, disk := range h.Disks {
+		if disk.Error != "" {
+			d.add(server, checkFail, "disk", disk.Path+": "+disk.Error, "")
+			continue
+		}
+		var rest []string
+		failed := false
+		for _, p := range problems {
+			if strings.HasPrefix(p, disk.Path+":") {
+				d.add(server, checkFail, "disk", p, "free space on the server, e.g. journalctl --vacuum-size=100M, or lower min_free_disk")
+				failed = true
+			} else {
+				rest = append(rest, p)
+			}
+		}
+		problems = rest
+		if !failed {
+			d.add(server, checkOK, "disk", fmt.Sprintf("%s: %.1f GiB free of %.1f GiB, %d inodes free",
+				disk.Path, float64(disk.FreeBytes)/(1<<30), float64(disk.TotalBytes)/(1<<30), disk.FreeInodes), "")
+		}
+	}
+	for _, p := range problems {
+		d.add(server, checkFail, "state", strings.TrimPrefix(p, "state: "),
+			fmt.Sprintf("check the ownership and contents of %s on the server; eacdd runs as root", h.StateDir))
+	}
+	if len(problems) == 0 {
+		d.add(server, checkOK, "state", h.StateDir+" is writable and readable", "")
+	}
+
+	needPackages := d.inv != nil && len(d.inv.Packages) > 0
+	switch {
+	case h.PackageManager != "":
+		d.add(server, checkOK, "packages", "package manager "+h.PackageManager, "")
+	case needPackages:
+		d.add(server, checkFail, "packages", "no supported package manager, but the inventory lists packages",
+			"install the packages by hand and remove packages: from the inventory")
+	default:
+		d.add(server, checkOK, "packages", "no supported package manager (the inventory installs no packages)", "")
+	}
+
+	needSystemd := d.cfg.Deploy.Systemd != nil || (d.inv != nil && len(d.inv.Services) > 0)
+	switch {
+	case h.Systemd:
+		d.add(server, checkOK, "systemd", "systemd is running", "")
+	case needSystemd:
+		d.add(server, checkFail, "systemd", "systemctl is missing or systemd is not running, but the project installs units or manages services",
+			"deploy to a host with systemd, or remove deploy.systemd and the inventory services")
+	default:
+		d.add(server, checkOK, "systemd", "not running (the project needs no units or services)", "")
+	}
+
+	if h.DeployRunning {
+		d.add(server, checkWarn, "deploy", "a deploy or rollback is running", "wait for it to finish; a deploy now gets 409 busy")
+	}
+}
@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/flo-mic/eacd/internal/api"
+)
+
+// doctorDaemon answers /health, /version and /health?verbose=1 like eacdd
+// with the token "secret".
+func doctorDaemon(t *testing.T, health api.HealthResponse) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorized := r.Header.Get("Authorization") == "Bearer secret"
+		switch {
+		case r.URL.Path == "/health" && r.URL.Query().Get("verbose") == "":
+			w.Write([]byte("ok\n"))
+		case !authorized:
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+		case r.URL.Path == "/version":
+			json.NewEncoder(w).Encode(api.VersionResponse{Version: "v1.0.0", Protocol: api.ProtocolVersion, MinProtocol: api.MinProtocolVersion, Features: api.Features})
+		case r.URL.Path == "/health":
+			json.NewEncoder(w).Encode(health)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func findingsOf(t *testing.T, out []byte) doctorReport {
+	t.Helper()
+	var rep doctorReport
+	if err := json.Unmarshal(out, &rep); err != nil {
+		t.Fatalf("%v:\n%s", err, out)
+	}
+	return rep
+}
+
+func TestDoctorHealthy(t *testing.T) {
+	srv := doctorDaemon(t, api.HealthResponse{
+		StateDir:       "/var/lib/eacd",
+		Disks:          []api.DiskStatus{{Path: "/var/lib/eacd", FreeBytes: 8 << 30, TotalBytes: 16 << 30, FreeInodes: 1000}},
+		PackageManager: "apt-get",
+		Systemd:        true,
+		Ready:          true,
+	})
+	dir := writeProject(t, srv.URL)
+
+	var stdout, stderr bytes.Buffer
+	if err := Doctor([]string{"--dir", dir}, &stdout, &stderr); err != nil {
+		t.Fatalf("%v:\n%s", err, stdout.String())
+	}
+	for _, want := range []string{"OK    token", "OK    version   eacdd v1.0.0", "All "} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Errorf("missing %q in:\n%s", want, stdout.String())
+		}
+	}
+}
+
+func TestDoctorProblems(t *testing.T) {
+	srv := doctorDaemon(t, api.HealthResponse{
+		StateDir: "/var/lib/eacd",
+		Disks:    []api.DiskStatus{{Path: "/var/lib/eacd", FreeBytes: 1 << 20, TotalBytes: 16 << 30}},
+		Problems: []string{
+			"/var/lib/eacd: only 1.0 MiB free (min_free_disk is 256MiB)",
+			"state: state dir is not writable: permission denied",
+		},
+	})
+	dir := writeProject(t, srv.URL)
+	cfgPath := filepath.Join(dir, ".eacd", "config.yaml")
+	data, _ := os.ReadFile(cfgPath)
+	data = append(data, "  systemd:\n    unit: .eacd/app.service\nhooks:\n  server_pre: .eacd/stop.sh\n  server_post: .eacd/start.sh\n"...)
+	os.WriteFile(cfgPath, data, 0644)
+	os.WriteFile(filepath.Join(dir, ".eacd", "app.service"), []byte("[Service]\n"), 0644)
+	os.WriteFile(filepath.Join(dir, ".eacd", "start.sh"), []byte("#!/bin/sh\n"), 0644)
+	os.WriteFile(filepath.Join(dir, ".eacd", "inventory.yaml"), []byte("packages: [nginx]\n"), 0644)
+	os.Remove(filepath.Join(dir, "dist", "index.html"))
+
+	var stdout bytes.Buffer
+	err := Doctor([]string{"--dir", dir, "--output", "json"}, &stdout, &bytes.Buffer{})
+	if err == nil {
+		t.Fatal("doctor passed with problems")
+	}
+	rep := findingsOf(t, stdout.Bytes())
+	got := map[string]finding{}
+	for _, f := range rep.Checks {
+		if f.Status != checkOK {
+			got[f.Check+" "+f.Status] = f
+		}
+	}
+	for _, want := range []struct{ key, message, fix string }{
+		{"hooks fail", "stop.sh does not exist", "remove hooks.server_pre"},
+		{"hooks warn", "start.sh is not executable", "chmod +x .eacd/start.sh"},
+		{"mappings warn", "no files to deploy", "build the project first"},
+		{"disk fail", "only 1.0 MiB free", "min_free_disk"},
+		{"state fail", "not writable", "ownership"},
+		{"packages fail", "inventory lists packages", "by hand"},
+		{"systemd fail", "systemd is not running", "host with systemd"},
+	} {
+		f, ok := got[want.key]
+		if !ok || !strings.Contains(f.Message, want.message) || !strings.Contains(f.Fix, want.fix) {
+			t.Errorf("%s: got %+v", want.key, f)
+		}
+	}
+	if rep.Failed != 5 || rep.Warnings != 2 {
+		t.Errorf("failed = %d, warnings = %d", rep.Failed, rep.Warnings)
+	}
+}
+
+func TestDoctorRejectedToken(t *testing.T) {
+	srv := doctorDaemon(t, api.HealthResponse{})
+	dir := writeProject(t, srv.URL)
+	t.Setenv("EACD_TEST_TOKEN", "wrong")
+
+	var stdout bytes.Buffer
+	if err := Doctor([]string{"--dir", dir, "--output", "json"}, &stdout, &bytes.Buffer{}); err == nil {
+		t.Fatal("doctor passed with a wrong token")
+	}
+	rep := findingsOf(t, stdout.Bytes())
+	last := rep.Checks[len(rep.Checks)-1]
+	if last.Check != "token" || last.Status != checkFail || !strings.Contains(last.Fix, "EACD_TEST_TOKEN") {
+		t.Errorf("last check = %+v", last)
+	}
+}
+
+func TestDoctorUnreachable(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	url := srv.URL
+	srv.Close()
+	dir := writeProject(t, url)
+
+	var stdout bytes.Buffer
+	Doctor([]string{"--dir", dir}, &stdout, &bytes.Buffer{})
+	if !strings.Contains(stdout.String(), "FAIL  tcp") || !strings.Contains(stdout.String(), "systemctl status eacdd") {
+		t.Errorf("output:\n%s", stdout.String())
+	}
+}
+
+func TestDoctorNoProject(t *testing.T) {
+	var stdout bytes.Buffer
+	err := Doctor([]string{"--dir", t.TempDir()}, &stdout, &bytes.Buffer{})
+	if err == nil || !strings.Contains(stdout.String(), "fix: run eacd init") {
+		t.Errorf("err = %v, output:\n%s", err, stdout.String())
+	}
+}
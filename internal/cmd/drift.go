@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"text/tabwriter"
+
+	"github.com/flo-mic/eacd/internal/api"
+)
+
+// ErrDrift is returned when a server no longer matches its deployed state.
+// eacd exits with status 2 for it so cron jobs and CI can tell drift from errors.
+var ErrDrift = errors.New("drift detected")
+
+// Drift compares every configured server with the state of its last deploy.
+func Drift(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("drift", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	dir := fs.String("dir", ".", "Project directory (default: current directory)")
+	env := fs.String("env", "", "Environment from the 'environments:' block")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	_, cfg, err := loadProject(*dir, *env)
+	if err != nil {
+		return err
+	}
+	creds, err := resolveToken(cfg, stderr)
+	if err != nil {
+		return err
+	}
+
+	targets := cfg.Targets()
+	drifted := 0
+	for _, server := range targets {
+		result, err := fetchDrift(server, cfg.Name, creds)
+		if err != nil {
+			return err
+		}
+		if result == nil {
+			fmt.Fprintf(stdout, "[eacd] %s: %s has no deployed state\n", hostLabel(server), cfg.Name)
+			continue
+		}
+		if len(result.Items) == 0 {
+			fmt.Fprintf(stdout, "[eacd] %s: no drift from release #%d\n", hostLabel(server), result.Release)
+			continue
+		}
+		drifted++
+		fmt.Fprintf(stdout, "[eacd] %s: %d differences from release #%d\n", hostLabel(server), len(result.Items), result.Release)
+		printDrift(stdout, result.Items)
+	}
+	if drifted > 0 {
+		return fmt.Errorf("%w on %d of %d servers", ErrDrift, drifted, len(targets))
+	}
+	return nil
+}
+
+// fetchDrift asks a server for the drift of a project. It returns nil if the
+// project has never been deployed there.
+func fetchDrift(server, project string, creds credentials) (*api.DriftResponse, error) {
+	if _, err := requireFeatures(server, creds, api.FeatureDrift); err != nil {
+		return nil, err
+	}
+	resp, err := httpGet(server+"/drift?project="+url.QueryEscape(project), creds)
+	if err != nil {
+		return nil, fmt.Errorf("drift request: %w", err)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, nil
+	}
+	var result api.DriftResponse
+	if err := decodeJSONResponse(resp, &result); err != nil {
+		return nil, fmt.Errorf("drift request to %s: %w", server, err)
+	}
+	return &result, nil
+}
+
+// refuseOnDrift fails if server has drifted from its deployed state; used by
+// deploy when refuse_drift is set.
+func refuseOnDrift(server, project string, creds credentials, stdout io.Writer) error {
+	result, err := fetchDrift(server, project, creds)
+	if err != nil || result == nil || len(result.Items) == 0 {
+		return err
+	}
+	fmt.Fprintf(stdout, "[eacd] Server has drifted from release #%d:\n", result.Release)
+	printDrift(stdout, result.Items)
+	return fmt.Errorf("%w: refusing to deploy (refuse_drift is set; use --force to overwrite)", ErrDrift)
+}
+
+func printDrift(w io.Writer, items []api.DriftItem) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "  KIND\tTARGET\tDETAIL")
+	for _, item := range items {
+		fmt.Fprintf(tw, "  %s\t%s\t%s\n", item.Kind, item.Target, item.Detail)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/flo-mic/eacd/internal/api"
+)
+
+func driftProject(t *testing.T, items []api.DriftItem) string {
+	t.Helper()
+	srv := httptest.NewServer(withVersion(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/drift" || r.URL.Query().Get("project") != "app" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(api.DriftResponse{Project: "app", Release: 4, Items: items})
+	}))
+	t.Cleanup(srv.Close)
+
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, ".eacd"), 0755)
+	cfg := "name: app\nserver: " + srv.URL + "\ntoken_env: EACD_TEST_TOKEN\ndeploy:\n  mappings:\n    - src: .\n      dest: /opt/app\n"
+	os.WriteFile(filepath.Join(dir, ".eacd", "config.yaml"), []byte(cfg), 0644)
+	t.Setenv("EACD_TEST_TOKEN", "secret")
+	return dir
+}
+
+func TestDrift_Clean(t *testing.T) {
+	dir := driftProject(t, nil)
+	var out bytes.Buffer
+	if err := Drift([]string{"--dir", dir}, &out, &out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(out.String(), "no drift from release #4") {
+		t.Errorf("unexpected output:\n%s", out.String())
+	}
+}
+
+func TestDrift_Detected(t *testing.T) {
+	dir := driftProject(t, []api.DriftItem{{Kind: "file", Target: "/opt/app/index.html", Detail: "content changed since deploy"}})
+	var out bytes.Buffer
+	err := Drift([]string{"--dir", dir}, &out, &out)
+	if !errors.Is(err, ErrDrift) {
+		t.Fatalf("expected ErrDrift, got %v", err)
+	}
+	if !strings.Contains(out.String(), "/opt/app/index.html") {
+		t.Errorf("drift items not printed:\n%s", out.String())
+	}
+}
+
+func TestRefuseOnDrift(t *testing.T) {
+	dir := driftProject(t, []api.DriftItem{{Kind: "service", Target: "nginx", Detail: "not running, should be started"}})
+	_, cfg, err := loadProject(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := refuseOnDrift(cfg.Server, "app", credentials{token: "secret"}, &out); !errors.Is(err, ErrDrift) {
+		t.Fatalf("expected ErrDrift, got %v", err)
+	}
+	if err := refuseOnDrift(cfg.Server, "other", credentials{token: "secret"}, &out); err != nil {
+		t.Fatalf("project without deployed state should not be refused: %v", err)
+	}
+}
@@ -0,0 +1,218 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/flo-mic/eacd/internal/api"
+	"github.com/flo-mic/eacd/internal/config"
+)
+
+// History lists past releases of the project, or with "diff <a> <b>" shows
+// which files changed between two releases.
+func History(args []string, stdout, stderr io.Writer) error {
+	diff := len(args) > 0 && args[0] == "diff"
+	if diff {
+		args = args[1:]
+	}
+
+	fs := flag.NewFlagSet("history", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	dir := fs.String("dir", ".", "Project directory (default: current directory)")
+	env := fs.String("env", "", "Environment from the 'environments:' block")
+	limit := fs.Int("limit", 20, "Number of most recent releases to show (0 = all)")
+	output := outputFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := checkOutput(*output, OutputText, OutputJSON); err != nil {
+		return err
+	}
+	jsonOut := *output == OutputJSON
+
+	var a, b int
+	if diff {
+		var errA, errB error
+		a, errA = strconv.Atoi(fs.Arg(0))
+		b, errB = strconv.Atoi(fs.Arg(1))
+		if fs.NArg() != 2 || errA != nil || errB != nil {
+			return fmt.Errorf("usage: eacd history diff <release> <release>")
+		}
+	}
+
+	_, cfg, err := loadProject(*dir, *env)
+	if err != nil {
+		return err
+	}
+	creds, err := resolveToken(cfg, stderr)
+	if err != nil {
+		return err
+	}
+
+	report := historyReport{Version: reportVersion, Project: cfg.Name, Environment: cfg.Environment}
+	for i, server := range cfg.Targets() {
+		if i > 0 && !jsonOut {
+			fmt.Fprintln(stdout)
+		}
+		releases, err := fetchReleases(server, cfg, creds)
+		if err != nil {
+			return err
+		}
+		if !diff {
+			if *limit > 0 && len(releases) > *limit {
+				releases = releases[len(releases)-*limit:]
+			}
+			if jsonOut {
+				if releases == nil {
+					releases = []api.Release{}
+				}
+				report.Servers = append(report.Servers, serverHistory{Server: server, Releases: releases})
+				continue
+			}
+			fmt.Fprintf(stdout, "[eacd] Releases of %s on %s\n", cfg.Name, hostLabel(server))
+			printHistory(stdout, releases)
+			continue
+		}
+
+		ra, rb := findRelease(releases, a), findRelease(releases, b)
+		if ra == nil || rb == nil {
+			return fmt.Errorf("%s: release #%d or #%d not found", hostLabel(server), a, b)
+		}
+		if jsonOut {
+			added, changed, removed := diffReleaseFiles(ra.Files, rb.Files)
+			report.Servers = append(report.Servers, serverHistory{Server: server, Diff: &releaseDiff{
+				From: a, To: b, Added: nonNil(added), Changed: nonNil(changed), Removed: nonNil(removed),
+			}})
+			continue
+		}
+		fmt.Fprintf(stdout, "[eacd] %s on %s: release #%d → #%d\n", cfg.Name, hostLabel(server), a, b)
+		printReleaseDiff(stdout, ra, rb)
+	}
+	if jsonOut {
+		return writeJSON(stdout, report)
+	}
+	return nil
+}
+
+// historyReport is the JSON output of eacd history and eacd history diff.
+type historyReport struct {
+	Version     int             `json:"version"`
+	Project     string          `json:"project"`
+	Environment string          `json:"environment,omitempty"`
+	Servers     []serverHistory `json:"servers"`
+}
+
+// serverHistory holds either the releases (oldest first) or the diff.
+type serverHistory struct {
+	Server   string        `json:"server"`
+	Releases []api.Release `json:"releases,omitempty"`
+	Diff     *releaseDiff  `json:"diff,omitempty"`
+}
+
+type releaseDiff struct {
+	From    int      `json:"from"`
+	To      int      `json:"to"`
+	Added   []string `json:"added"`
+	Changed []string `json:"changed"`
+	Removed []string `json:"removed"`
+}
+
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
+
+func fetchReleases(server string, cfg *config.ClientConfig, creds credentials) ([]api.Release, error) {
+	if _, err := requireFeatures(server, creds, api.FeatureReleases); err != nil {
+		return nil, err
+	}
+	resp, err := httpGet(server+"/projects/"+url.PathEscape(cfg.Name)+"/releases", creds)
+	if err != nil {
+		return nil, fmt.Errorf("history request: %w", err)
+	}
+	var result api.ReleasesResponse
+	if err := decodeJSONResponse(resp, &result); err != nil {
+		return nil, fmt.Errorf("history request to %s: %w", server, err)
+	}
+	return result.Releases, nil
+}
+
+func findRelease(releases []api.Release, id int) *api.Release {
+	for i := range releases {
+		if releases[i].ID == id {
+			return &releases[i]
+		}
+	}
+	return nil
+}
+
+func printHistory(w io.Writer, releases []api.Release) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tTIME\tACTION\tRESULT\tWHO\tCOMMIT\tFILES\tMESSAGE")
+	for i := len(releases) - 1; i >= 0; i-- {
+		rel := &releases[i]
+		files := "-"
+		if rel.Action == "deploy" {
+			files = fmt.Sprintf("%d/%d", rel.FilesChanged, rel.FilesTotal)
+		}
+		message := rel.Detail
+		if rel.Meta != nil && rel.Meta.Message != "" {
+			message = rel.Meta.Message
+		}
+		commit := "-"
+		if rel.Meta != nil && rel.Meta.GitCommit != "" {
+			commit = shortCommit(rel.Meta.GitCommit)
+			if rel.Meta.GitDirty {
+				commit += "+dirty"
+			}
+		}
+		fmt.Fprintf(tw, "#%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			rel.ID, rel.Time.Local().Format("2006-01-02 15:04:05"), rel.Action, rel.Result, releaseWho(rel), commit, files, message)
+	}
+	tw.Flush()
+}
+
+func printReleaseDiff(w io.Writer, a, b *api.Release) {
+	fmt.Fprintf(w, "Commit: %s → %s\n", releaseCommit(a), releaseCommit(b))
+	added, changed, removed := diffReleaseFiles(a.Files, b.Files)
+	for _, f := range added {
+		fmt.Fprintf(w, "  + %s\n", f)
+	}
+	for _, f := range changed {
+		fmt.Fprintf(w, "  ~ %s\n", f)
+	}
+	for _, f := range removed {
+		fmt.Fprintf(w, "  - %s\n", f)
+	}
+	fmt.Fprintf(w, "[eacd] %d added, %d changed, %d removed\n", len(added), len(changed), len(removed))
+}
+
+// diffReleaseFiles compares two dest → hash maps and returns the sorted
+// destinations that were added, changed or removed going from a to b.
+func diffReleaseFiles(a, b map[string]string) (added, changed, removed []string) {
+	for dest, hash := range b {
+		old, ok := a[dest]
+		switch {
+		case !ok:
+			added = append(added, dest)
+		case old != hash:
+			changed = append(changed, dest)
+		}
+	}
+	for dest := range a {
+		if _, ok := b[dest]; !ok {
+			removed = append(removed, dest)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(changed)
+	sort.Strings(removed)
+	return added, changed, removed
+}
@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/flo-mic/eacd/internal/api"
+)
+
+func TestDiffReleaseFiles(t *testing.T) {
+	a := map[string]string{"/a": "1", "/b": "2", "/c": "3"}
+	b := map[string]string{"/a": "1", "/b": "9", "/d": "4"}
+
+	added, changed, removed := diffReleaseFiles(a, b)
+	if !reflect.DeepEqual(added, []string{"/d"}) {
+		t.Errorf("added = %v", added)
+	}
+	if !reflect.DeepEqual(changed, []string{"/b"}) {
+		t.Errorf("changed = %v", changed)
+	}
+	if !reflect.DeepEqual(removed, []string{"/c"}) {
+		t.Errorf("removed = %v", removed)
+	}
+}
+
+func TestHistoryDiff(t *testing.T) {
+	srv := httptest.NewServer(withVersion(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/projects/app/releases" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(api.ReleasesResponse{Releases: []api.Release{
+			{ID: 1, Action: "deploy", Result: "ok", Files: map[string]string{"/etc/app.conf": "a"}},
+			{ID: 2, Action: "deploy", Result: "ok", Files: map[string]string{"/etc/app.conf": "b", "/opt/app": "c"}},
+		}})
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, ".eacd"), 0755)
+	cfg := "name: app\nserver: " + srv.URL + "\ntoken_env: EACD_TEST_TOKEN\ndeploy:\n  mappings:\n    - src: .\n      dest: /opt/app\n"
+	os.WriteFile(filepath.Join(dir, ".eacd", "config.yaml"), []byte(cfg), 0644)
+	t.Setenv("EACD_TEST_TOKEN", "secret")
+
+	var out bytes.Buffer
+	if err := History([]string{"diff", "--dir", dir, "1", "2"}, &out, &out); err != nil {
+		t.Fatal(err)
+	}
+	s := out.String()
+	for _, want := range []string{"~ /etc/app.conf", "+ /opt/app", "1 added, 1 changed, 0 removed"} {
+		if !strings.Contains(s, want) {
+			t.Errorf("output missing %q:\n%s", want, s)
+		}
+	}
+
+	if err := History([]string{"diff", "--dir", dir, "1", "7"}, &out, &out); err == nil {
+		t.Error("expected error for unknown release")
+	}
+}
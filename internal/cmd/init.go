@@ -7,16 +7,25 @@ import (
 	"strings"
 
 	"github.com/charmbracelet/huh"
+	"github.com/flo-mic/eacd/internal/config"
 )
 
 // Init runs the interactive init wizard.
 func Init(args []string) error {
 	dir := "."
 	reinit := false
-	for _, a := range args {
-		if a == "--reinit" || a == "-r" {
+	envName := ""
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		switch {
+		case a == "--reinit" || a == "-r":
 			reinit = true
-		} else {
+		case a == "--env" && i+1 < len(args):
+			i++
+			envName = args[i]
+		case strings.HasPrefix(a, "--env="):
+			envName = strings.TrimPrefix(a, "--env=")
+		default:
 			dir = a
 		}
 	}
@@ -29,6 +38,10 @@ func Init(args []string) error {
 	simpleDir := filepath.Join(projectDir, ".eacd")
 	configPath := filepath.Join(simpleDir, "config.yaml")
 
+	if envName != "" {
+		return initEnvironment(projectDir, envName)
+	}
+
 	if _, err := os.Stat(configPath); err == nil && !reinit {
 		fmt.Println("A .eacd/config.yaml already exists. Run with --reinit to overwrite.")
 		return nil
@@ -349,6 +362,64 @@ func buildConfigYAML(name, server, token, src, dest string, excludes []string, u
 	return sb.String()
 }
 
+// initEnvironment asks for the settings of a new environment and adds it to
+// the environments: block of the project's existing config.yaml.
+func initEnvironment(projectDir, envName string) error {
+	if _, err := os.Stat(filepath.Join(projectDir, ".eacd", "config.yaml")); err != nil {
+		return fmt.Errorf("no .eacd/config.yaml found — run 'eacd init' first: %w", err)
+	}
+
+	fmt.Printf("Adding environment %q to .eacd/config.yaml\n\n", envName)
+
+	var serverURL, destDir string
+	tokenEnv := "EACD_TOKEN_" + strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(envName))
+
+	if err := huh.NewForm(huh.NewGroup(
+		huh.NewInput().
+			Title("Server URL").
+			Description("e.g. https://ct.example.com or http://192.168.1.x:8765").
+			Value(&serverURL).
+			Validate(func(s string) error {
+				if !strings.HasPrefix(s, "http://") && !strings.HasPrefix(s, "https://") {
+					return fmt.Errorf("must start with http:// or https://")
+				}
+				return nil
+			}),
+		huh.NewInput().
+			Title("Token environment variable").
+			Description("The auth token for this environment is read from this variable.").
+			Value(&tokenEnv).
+			Validate(func(s string) error {
+				if strings.TrimSpace(s) == "" {
+					return fmt.Errorf("variable name cannot be empty")
+				}
+				return nil
+			}),
+		huh.NewInput().
+			Title("Deploy destination override").
+			Description("Leave empty to use the top-level mappings.").
+			Value(&destDir).
+			Validate(func(s string) error {
+				if s != "" && !strings.HasPrefix(s, "/") {
+					return fmt.Errorf("must be an absolute path")
+				}
+				return nil
+			}),
+	)).Run(); err != nil {
+		return err
+	}
+
+	if err := config.AddEnvironment(projectDir, envName, serverURL, tokenEnv, destDir); err != nil {
+		return err
+	}
+
+	fmt.Printf("Added environment %q to .eacd/config.yaml\n", envName)
+	fmt.Println()
+	fmt.Println("Next steps:")
+	fmt.Printf("  1. Set the auth token: export %s=<your-token>\n", tokenEnv)
+	fmt.Printf("  2. Run: eacd deploy --env %s\n", envName)
+	return nil
+}
 
 func detectProjectType(dir string) string {
 	checks := map[string]string{
@@ -112,8 +112,10 @@ After=network.target
 [Service]
 Type=simple
 ExecStart=/usr/local/bin/eacdd --config /etc/eacd/server.yaml
+ExecReload=/bin/kill -HUP $MAINPID
 Restart=on-failure
 RestartSec=5
+TimeoutStopSec=150
 
 [Install]
 WantedBy=multi-user.target
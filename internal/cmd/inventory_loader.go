@@ -14,21 +14,14 @@ type inventoryFile struct {
 	Packages []string               `yaml:"packages"`
 	Services []api.InventoryService `yaml:"services"`
 	Users    []api.InventoryUser    `yaml:"users"`
+	Vars     map[string]string      `yaml:"vars"`
 }
 
 // loadInventory reads .eacd/inventory.yaml and returns an api.Inventory.
 // Returns nil, nil if the file does not exist.
 func loadInventory(path string) (*api.Inventory, error) {
-	data, err := os.ReadFile(path)
-	if os.IsNotExist(err) {
-		return nil, nil
-	}
-	if err != nil {
-		return nil, err
-	}
-
-	var f inventoryFile
-	if err := yaml.Unmarshal(data, &f); err != nil {
+	f, err := readInventoryFile(path)
+	if err != nil || f == nil {
 		return nil, err
 	}
 
@@ -42,3 +35,29 @@ func loadInventory(path string) (*api.Inventory, error) {
 		Users:    f.Users,
 	}, nil
 }
+
+// loadInventoryVars returns the vars: block of the inventory file.
+// Returns nil, nil if the file does not exist.
+func loadInventoryVars(path string) (map[string]string, error) {
+	f, err := readInventoryFile(path)
+	if err != nil || f == nil {
+		return nil, err
+	}
+	return f.Vars, nil
+}
+
+func readInventoryFile(path string) (*inventoryFile, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var f inventoryFile
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/flo-mic/eacd/internal/api"
+	"github.com/flo-mic/eacd/internal/signing"
+)
+
+func TestSignedDeploy(t *testing.T) {
+	keyPath := filepath.Join(t.TempDir(), "signing.key")
+	var stdout bytes.Buffer
+	if err := Keygen([]string{"--out", keyPath}, &stdout, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	var trusted ed25519.PublicKey
+	for _, line := range strings.Split(stdout.String(), "\n") {
+		if k, ok := strings.CutPrefix(strings.TrimSpace(line), "- "); ok {
+			trusted, _ = signing.ParsePublicKey(k)
+		}
+	}
+	if trusted == nil {
+		t.Fatalf("no public key printed:\n%s", stdout.String())
+	}
+
+	var manifest api.Manifest
+	var rollback api.RollbackRequest
+	var verifyErr, rollbackErr error
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/version":
+			json.NewEncoder(w).Encode(api.VersionResponse{Protocol: api.ProtocolVersion, MinProtocol: api.MinProtocolVersion, Features: api.Features})
+		case "/check":
+			json.NewEncoder(w).Encode(api.CheckResponse{Upload: []string{"/var/www/app/index.html"}})
+		case "/deploy":
+			mr, _ := r.MultipartReader()
+			part, _ := mr.NextPart()
+			data, _ := io.ReadAll(part)
+			json.Unmarshal(data, &manifest)
+			_, verifyErr = signing.Verify([]ed25519.PublicKey{trusted}, data, part.Header.Get(api.ManifestSignatureHeader))
+			w.Header().Set("Content-Type", api.EventsMediaType)
+			fmt.Fprintln(w, `{"type":"result","ok":true,"release":1}`)
+		case "/rollback":
+			data, _ := io.ReadAll(r.Body)
+			json.Unmarshal(data, &rollback)
+			_, rollbackErr = signing.Verify([]ed25519.PublicKey{trusted}, data, r.Header.Get(api.ManifestSignatureHeader))
+			w.Header().Set("Content-Type", api.EventsMediaType)
+			fmt.Fprintln(w, `{"type":"result","ok":true,"release":2}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	dir := writeProject(t, srv.URL)
+	os.WriteFile(filepath.Join(dir, ".eacd", "pre.sh"), []byte("#!/bin/sh\n"), 0755)
+	cfgPath := filepath.Join(dir, ".eacd", "config.yaml")
+	data, _ := os.ReadFile(cfgPath)
+	os.WriteFile(cfgPath, append(data, "signing_key: "+keyPath+"\nhooks:\n  server_pre: .eacd/pre.sh\n"...), 0644)
+
+	if err := Deploy([]string{"--dir", dir}, io.Discard, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if verifyErr != nil {
+		t.Errorf("manifest signature: %v", verifyErr)
+	}
+	if manifest.SignedAt == 0 || manifest.Nonce == "" {
+		t.Errorf("manifest has no timestamp or nonce: signed_at = %d, nonce = %q", manifest.SignedAt, manifest.Nonce)
+	}
+	if manifest.Hooks == nil || !strings.HasPrefix(manifest.Hooks.ServerPreHash, "sha256:") {
+		t.Errorf("hook hash missing: %+v", manifest.Hooks)
+	}
+	// index.html (12 bytes) and pre.sh (10 bytes) are uploaded.
+	if s := manifest.Size; s == nil || s.Uncompressed != 22 || s.Entries != 2 || manifest.Files[0].Size != 12 {
+		t.Errorf("sizes = %+v, files = %+v", s, manifest.Files)
+	}
+
+	if err := Rollback([]string{"--dir", dir}, io.Discard, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if rollbackErr != nil {
+		t.Errorf("rollback signature: %v", rollbackErr)
+	}
+	if rollback.SignedAt == 0 || rollback.Nonce == "" || rollback.Nonce == manifest.Nonce {
+		t.Errorf("rollback signed_at = %d, nonce = %q", rollback.SignedAt, rollback.Nonce)
+	}
+}
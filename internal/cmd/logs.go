@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+
+	"github.com/flo-mic/eacd/internal/api"
+)
+
+// Logs streams the journal of the project's systemd units from the configured
+// server(s). With several servers every line is prefixed with its host.
+// With --deploy it prints the saved transcript of a release instead.
+func Logs(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("logs", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	dir := fs.String("dir", ".", "Project directory (default: current directory)")
+	env := fs.String("env", "", "Environment from the 'environments:' block")
+	unit := fs.String("unit", "", "Only this unit (default: all units of the project)")
+	since := fs.String("since", "", "Show entries since, e.g. \"10 min ago\" or \"2026-10-18 14:00\"")
+	release := fs.Int("deploy", 0, "Show the saved output of this release (see 'eacd history') instead of the journal")
+	var lines int
+	var follow bool
+	fs.IntVar(&lines, "lines", 100, "Number of recent lines to show")
+	fs.IntVar(&lines, "n", 100, "Shorthand for --lines")
+	fs.BoolVar(&follow, "follow", false, "Keep streaming new entries")
+	fs.BoolVar(&follow, "f", false, "Shorthand for --follow")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if lines < 1 {
+		return fmt.Errorf("--lines must be at least 1")
+	}
+
+	_, cfg, err := loadProject(*dir, *env)
+	if err != nil {
+		return err
+	}
+	creds, err := resolveToken(cfg, stderr)
+	if err != nil {
+		return err
+	}
+
+	if *release > 0 {
+		return printTranscripts(cfg.Targets(), cfg.Name, *release, creds, stdout)
+	}
+
+	q := url.Values{}
+	q.Set("project", cfg.Name)
+	q.Set("lines", strconv.Itoa(lines))
+	if *unit != "" {
+		q.Set("unit", *unit)
+	}
+	if *since != "" {
+		q.Set("since", *since)
+	}
+	if follow {
+		q.Set("follow", "true")
+	}
+
+	targets := cfg.Targets()
+	if len(targets) == 1 {
+		return streamLogs(targets[0], q, creds, stdout)
+	}
+
+	var (
+		outMu sync.Mutex
+		wg    sync.WaitGroup
+		errs  = make([]error, len(targets))
+	)
+	for i, server := range targets {
+		wg.Add(1)
+		go func(i int, server string) {
+			defer wg.Done()
+			pw := &prefixWriter{prefix: "[" + hostLabel(server) + "] ", w: stdout, mu: &outMu}
+			defer pw.Flush()
+			errs[i] = streamLogs(server, q, creds, pw)
+		}(i, server)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			return fmt.Errorf("%s: %w", hostLabel(targets[i]), err)
+		}
+	}
+	return nil
+}
+
+// printTranscripts prints the saved output of release id from every server.
+func printTranscripts(servers []string, project string, id int, creds credentials, stdout io.Writer) error {
+	for i, server := range servers {
+		if len(servers) > 1 {
+			if i > 0 {
+				fmt.Fprintln(stdout)
+			}
+			fmt.Fprintf(stdout, "[eacd] %s\n", hostLabel(server))
+		}
+		if _, err := requireFeatures(server, creds, api.FeatureReleases); err != nil {
+			return err
+		}
+		resp, err := httpGet(fmt.Sprintf("%s/projects/%s/releases/%d/log", server, url.PathEscape(project), id), creds)
+		if err != nil {
+			return fmt.Errorf("log request: %w", err)
+		}
+		err = copyResponse(resp, stdout)
+		if err != nil {
+			return fmt.Errorf("release #%d on %s: %w", id, hostLabel(server), err)
+		}
+	}
+	return nil
+}
+
+// copyResponse closes resp and copies its body to out, turning non-200
+// responses into errors.
+func copyResponse(resp *http.Response, out io.Writer) error {
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+	}
+	_, err := io.Copy(out, resp.Body)
+	return err
+}
+
+func streamLogs(server string, q url.Values, creds credentials, out io.Writer) error {
+	if _, err := requireFeatures(server, creds, api.FeatureLogs); err != nil {
+		return err
+	}
+	resp, err := httpGet(server+"/logs?"+q.Encode(), creds)
+	if err != nil {
+		return fmt.Errorf("logs request: %w", err)
+	}
+	if err := copyResponse(resp, out); err != nil {
+		return fmt.Errorf("logs request failed: %w", err)
+	}
+	return nil
+}
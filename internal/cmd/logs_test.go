@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLogs(t *testing.T) {
+	var query string
+	srv := httptest.NewServer(withVersion(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/logs" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.URL.Query().Get("unit") == "sshd" {
+			http.Error(w, "unit sshd is not declared by project app", http.StatusForbidden)
+			return
+		}
+		query = r.URL.RawQuery
+		fmt.Fprintln(w, "2026-10-18T14:02:13+0000 ct my-api[812]: listening on :8080")
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, ".eacd"), 0755)
+	cfg := "name: app\nserver: " + srv.URL + "\ntoken_env: EACD_TEST_TOKEN\ndeploy:\n  mappings:\n    - src: .\n      dest: /opt/app\n"
+	os.WriteFile(filepath.Join(dir, ".eacd", "config.yaml"), []byte(cfg), 0644)
+	t.Setenv("EACD_TEST_TOKEN", "secret")
+
+	var out bytes.Buffer
+	if err := Logs([]string{"--dir", dir, "-n", "50", "-f", "--since", "1 hour ago"}, &out, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "listening on :8080") {
+		t.Errorf("log line not copied:\n%s", out.String())
+	}
+	for _, want := range []string{"project=app", "lines=50", "follow=true", "since=1+hour+ago"} {
+		if !strings.Contains(query, want) {
+			t.Errorf("query %q missing %q", query, want)
+		}
+	}
+
+	err := Logs([]string{"--dir", dir, "--unit", "sshd"}, &out, &out)
+	if err == nil || !strings.Contains(err.Error(), "not declared") {
+		t.Errorf("expected forbidden unit error, got %v", err)
+	}
+
+	if err := Logs([]string{"--dir", dir, "-n", "0"}, &out, &out); err == nil {
+		t.Error("--lines 0 accepted")
+	}
+}
+
+func TestLogsDeployTranscript(t *testing.T) {
+	srv := httptest.NewServer(withVersion(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/projects/app/releases/7/log" {
+			http.Error(w, "no log for release", http.StatusNotFound)
+			return
+		}
+		fmt.Fprintln(w, "[eacd] ERROR: pre-hook: exit status 1")
+		fmt.Fprintln(w, "[eacd] STATUS:FAIL")
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, ".eacd"), 0755)
+	cfg := "name: app\nserver: " + srv.URL + "\ntoken_env: EACD_TEST_TOKEN\ndeploy:\n  mappings:\n    - src: .\n      dest: /opt/app\n"
+	os.WriteFile(filepath.Join(dir, ".eacd", "config.yaml"), []byte(cfg), 0644)
+	t.Setenv("EACD_TEST_TOKEN", "secret")
+
+	var out bytes.Buffer
+	if err := Logs([]string{"--dir", dir, "--deploy", "7"}, &out, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "pre-hook: exit status 1") {
+		t.Errorf("transcript not printed:\n%s", out.String())
+	}
+	if err := Logs([]string{"--dir", dir, "--deploy", "3"}, &out, &out); err == nil {
+		t.Error("expected error for a missing transcript")
+	}
+}
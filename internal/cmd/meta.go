@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"strings"
+
+	"github.com/flo-mic/eacd/internal/api"
+)
+
+// checkMessage fails for a deploy or rollback message longer than the
+// server accepts.
+func checkMessage(message string) error {
+	if len(message) > api.MaxMetaMessage {
+		return fmt.Errorf("-m message is %d bytes, at most %d allowed", len(message), api.MaxMetaMessage)
+	}
+	return nil
+}
+
+// collectMeta gathers the git state of projectDir and who is deploying from
+// where. Outside a git repository the git fields are left empty.
+func collectMeta(projectDir, message string) *api.DeployMeta {
+	m := &api.DeployMeta{Message: message}
+
+	if u, err := user.Current(); err == nil {
+		m.User = u.Username
+	} else {
+		m.User = os.Getenv("USER")
+	}
+	m.Hostname, _ = os.Hostname()
+
+	if commit, err := gitOutput(projectDir, "rev-parse", "HEAD"); err == nil {
+		m.GitCommit = commit
+		m.GitBranch, _ = gitOutput(projectDir, "rev-parse", "--abbrev-ref", "HEAD")
+		status, _ := gitOutput(projectDir, "status", "--porcelain")
+		m.GitDirty = status != ""
+	}
+	return m
+}
+
+func gitOutput(dir string, args ...string) (string, error) {
+	out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// shortCommit returns the first 8 characters of a commit hash.
+func shortCommit(commit string) string {
+	if len(commit) > 8 {
+		return commit[:8]
+	}
+	return commit
+}
@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/flo-mic/eacd/internal/api"
+)
+
+func initGitRepo(t *testing.T, dir string) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	for _, args := range [][]string{
+		{"init", "-q", "-b", "main"},
+		{"-c", "user.email=t@example.com", "-c", "user.name=t", "commit", "-q", "--allow-empty", "-m", "init"},
+	} {
+		if out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+}
+
+func TestCollectMeta_GitRepo(t *testing.T) {
+	dir := t.TempDir()
+	initGitRepo(t, dir)
+
+	m := collectMeta(dir, "release 1.2")
+	if len(m.GitCommit) != 40 {
+		t.Errorf("GitCommit = %q", m.GitCommit)
+	}
+	if m.GitBranch != "main" {
+		t.Errorf("GitBranch = %q", m.GitBranch)
+	}
+	if m.GitDirty {
+		t.Error("fresh repo should not be dirty")
+	}
+	if m.Message != "release 1.2" {
+		t.Errorf("Message = %q", m.Message)
+	}
+
+	os.WriteFile(filepath.Join(dir, "new.txt"), []byte("x"), 0644)
+	if !collectMeta(dir, "").GitDirty {
+		t.Error("untracked file should make the tree dirty")
+	}
+}
+
+func TestCollectMeta_NoRepo(t *testing.T) {
+	m := collectMeta(t.TempDir(), "")
+	if m.GitCommit != "" || m.GitDirty {
+		t.Errorf("expected empty git fields outside a repo, got %+v", m)
+	}
+}
+
+func TestDeploy_RequireCleanGitRefusesDirtyTree(t *testing.T) {
+	dir := t.TempDir()
+	initGitRepo(t, dir)
+	os.MkdirAll(filepath.Join(dir, ".eacd"), 0755)
+	os.WriteFile(filepath.Join(dir, ".eacd", "config.yaml"), []byte(`name: app
+server: http://127.0.0.1:1
+require_clean_git: true
+deploy:
+  mappings:
+    - src: ./
+      dest: /opt/app
+`), 0644)
+
+	err := Deploy([]string{"--dir", dir}, io.Discard, io.Discard)
+	if err == nil || !strings.Contains(err.Error(), "uncommitted") {
+		t.Errorf("expected dirty tree to be refused, got %v", err)
+	}
+}
+
+func TestCheckMessage(t *testing.T) {
+	if err := checkMessage("release 1.2"); err != nil {
+		t.Error(err)
+	}
+	if err := checkMessage(strings.Repeat("x", api.MaxMetaMessage+1)); err == nil {
+		t.Error("overlong message accepted")
+	}
+}
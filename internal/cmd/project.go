@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/flo-mic/eacd/internal/api"
+	"github.com/flo-mic/eacd/internal/config"
+)
+
+// loadProject loads .eacd/config.yaml from dir and applies the overrides of
+// the selected environment (empty env = top-level settings).
+func loadProject(dir, env string) (string, *config.ClientConfig, error) {
+	projectDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", nil, fmt.Errorf("resolving project dir: %w", err)
+	}
+
+	cfg, err := config.LoadClientConfig(projectDir)
+	if err != nil {
+		return "", nil, err
+	}
+
+	cfg, err = cfg.ForEnvironment(env)
+	if err != nil {
+		return "", nil, err
+	}
+	return projectDir, cfg, nil
+}
+
+// credentials authenticate the requests to eacdd of one project config.
+type credentials struct {
+	token string
+	sign  bool // auth: hmac, sign requests with token instead of sending it
+}
+
+// resolveToken returns the credentials for cfg. The env var named by
+// token_env takes precedence over the config file; a hardcoded token triggers
+// a warning on warn.
+func resolveToken(cfg *config.ClientConfig, warn io.Writer) (credentials, error) {
+	token := os.Getenv(cfg.TokenEnv)
+	if token == "" && cfg.Token != "" {
+		fmt.Fprintf(warn, "warning: token is hardcoded in .eacd/config.yaml — consider using %s env var instead\n", cfg.TokenEnv)
+		token = cfg.Token
+	}
+	if token == "" {
+		return credentials{}, fmt.Errorf("no auth token: set %s or add 'token:' to .eacd/config.yaml", cfg.TokenEnv)
+	}
+	return credentials{token: token, sign: cfg.Auth == config.AuthHMAC}, nil
+}
+
+// projectWebhooks returns the webhooks of cfg as sent to the daemon, with
+// secret_env resolved.
+func projectWebhooks(cfg *config.ClientConfig) ([]api.Webhook, error) {
+	var hooks []api.Webhook
+	for i, h := range cfg.Webhooks {
+		secret := h.Secret
+		if h.SecretEnv != "" {
+			if secret = os.Getenv(h.SecretEnv); secret == "" {
+				return nil, fmt.Errorf("webhooks[%d]: %s is not set", i, h.SecretEnv)
+			}
+		}
+		hooks = append(hooks, api.Webhook{
+			URL:     h.URL,
+			Format:  h.Format,
+			Secret:  secret,
+			Events:  h.Events,
+			Timeout: h.Timeout.String(),
+			Retries: h.Retries,
+		})
+	}
+	return hooks, nil
+}
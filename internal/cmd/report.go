@@ -0,0 +1,183 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/flo-mic/eacd/internal/api"
+)
+
+// Output formats of --output.
+const (
+	OutputText   = "text"
+	OutputJSON   = "json"
+	OutputGitHub = "github" // text plus GitHub Actions workflow commands
+)
+
+// reportVersion is the "version" of the JSON reports. It changes only when
+// a field is removed or changes meaning; new fields may be added any time.
+const reportVersion = 1
+
+// outputFlag registers --output on fs.
+func outputFlag(fs *flag.FlagSet) *string {
+	return fs.String("output", OutputText, "Output format: text, json or github")
+}
+
+// checkOutput validates an --output value against the formats a command supports.
+func checkOutput(output string, allowed ...string) error {
+	for _, a := range allowed {
+		if output == a {
+			return nil
+		}
+	}
+	return fmt.Errorf("--output must be one of %s, got %q", strings.Join(allowed, ", "), output)
+}
+
+// runReport is the JSON report of a deploy or rollback.
+type runReport struct {
+	Version     int             `json:"version"`
+	Action      string          `json:"action"` // "deploy" or "rollback"
+	Project     string          `json:"project"`
+	Environment string          `json:"environment,omitempty"`
+	OK          bool            `json:"ok"`
+	ExitCode    int             `json:"exit_code"`
+	Error       string          `json:"error,omitempty"`
+	DurationMS  int64           `json:"duration_ms"`
+	Servers     []*serverReport `json:"servers"`
+}
+
+// serverReport is the outcome on one server.
+type serverReport struct {
+	Server        string        `json:"server"`
+	OK            bool          `json:"ok"`
+	Status        string        `json:"status"`         // "ok", "failed", "unhealthy" or "skipped"
+	Code          string        `json:"code,omitempty"` // error code, see RemoteError
+	Error         string        `json:"error,omitempty"`
+	Release       int           `json:"release,omitempty"`
+	FilesUploaded int           `json:"files_uploaded"`
+	FilesTotal    int           `json:"files_total"`
+	BytesSent     int64         `json:"bytes_sent"`
+	DurationMS    int64         `json:"duration_ms"`
+	Phases        []phaseReport `json:"phases"`
+	Warnings      []string      `json:"warnings"`
+}
+
+type phaseReport struct {
+	Name       string `json:"name"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+func newRunReport(action, project, environment string, servers []string) *runReport {
+	r := &runReport{Version: reportVersion, Action: action, Project: project, Environment: environment}
+	for _, s := range servers {
+		r.Servers = append(r.Servers, &serverReport{Server: s, Status: "skipped", Phases: []phaseReport{}, Warnings: []string{}})
+	}
+	return r
+}
+
+// server returns the report of server.
+func (r *runReport) server(server string) *serverReport {
+	for _, s := range r.Servers {
+		if s.Server == server {
+			return s
+		}
+	}
+	return nil
+}
+
+// record stores the outcome of a single server.
+func (s *serverReport) record(err error, began time.Time) {
+	s.DurationMS = time.Since(began).Milliseconds()
+	s.OK = err == nil
+	if err == nil {
+		s.Status = "ok"
+		return
+	}
+	s.Status = "failed"
+	s.Error = err.Error()
+	var re *RemoteError
+	if errors.As(err, &re) {
+		s.Code = re.Code
+		s.Error = re.Message
+	}
+}
+
+// event records a progress event of the server's stream.
+func (s *serverReport) event(e api.Event) {
+	switch e.Type {
+	case api.EventPhaseEnd:
+		s.Phases = append(s.Phases, phaseReport{Name: e.Phase, DurationMS: e.DurationMS})
+	case api.EventWarning:
+		s.Warnings = append(s.Warnings, e.Message)
+	case api.EventResult:
+		s.Release = e.Release
+	}
+}
+
+// finish fills in the overall result and writes the report in the given format.
+func (r *runReport) finish(w io.Writer, output string, err error, began time.Time) {
+	r.DurationMS = time.Since(began).Milliseconds()
+	r.OK = err == nil
+	var rerr *rolloutError
+	if errors.As(err, &rerr) {
+		for _, res := range rerr.results {
+			if s := r.server(res.server); s != nil && res.status == "unhealthy" {
+				s.OK, s.Status, s.Error = false, res.status, res.err.Error()
+			}
+		}
+	}
+	r.ExitCode = ExitCode(err)
+	if err != nil {
+		r.Error = err.Error()
+	}
+	switch output {
+	case OutputJSON:
+		writeJSON(w, r)
+	case OutputGitHub:
+		r.annotate(w)
+	}
+}
+
+// annotate writes GitHub Actions workflow commands: a warning per server
+// warning, an error per failed server and a notice per successful one.
+func (r *runReport) annotate(w io.Writer) {
+	for _, s := range r.Servers {
+		title := "eacd " + r.Action + " " + hostLabel(s.Server)
+		for _, msg := range s.Warnings {
+			fmt.Fprintf(w, "::warning title=%s::%s\n", ghEscapeProperty(title), ghEscape(msg))
+		}
+		switch {
+		case s.OK && r.Action == "deploy":
+			fmt.Fprintf(w, "::notice title=%s::release #%d, %d of %d files uploaded\n", ghEscapeProperty(title), s.Release, s.FilesUploaded, s.FilesTotal)
+		case s.OK:
+			fmt.Fprintf(w, "::notice title=%s::release #%d\n", ghEscapeProperty(title), s.Release)
+		case s.Error != "":
+			fmt.Fprintf(w, "::error title=%s::%s\n", ghEscapeProperty(title), ghEscape(s.Error))
+		}
+	}
+	if !r.OK && r.Error != "" && len(r.Servers) == 0 {
+		fmt.Fprintf(w, "::error title=%s::%s\n", ghEscapeProperty("eacd "+r.Action), ghEscape(r.Error))
+	}
+}
+
+// ghEscape escapes the message of a workflow command.
+func ghEscape(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+// ghEscapeProperty escapes a property value of a workflow command.
+func ghEscapeProperty(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(s)
+}
+
+// writeJSON writes v as indented JSON.
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
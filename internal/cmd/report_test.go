@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/flo-mic/eacd/internal/api"
+)
+
+// fakeDaemon answers /check with every file and /deploy with an event stream.
+func fakeDaemon(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/check":
+			var req api.CheckRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			var resp api.CheckResponse
+			for _, f := range req.Files {
+				resp.Upload = append(resp.Upload, f.Dest)
+			}
+			json.NewEncoder(w).Encode(resp)
+		case "/deploy":
+			w.Header().Set("Content-Type", api.EventsMediaType)
+			fmt.Fprintln(w, `{"type":"phase_end","phase":"files","duration_ms":12}`)
+			fmt.Fprintln(w, `{"type":"warning","message":"post-hook failed: exit status 1"}`)
+			fmt.Fprintln(w, `{"type":"result","ok":true,"release":4}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func writeProject(t *testing.T, server string) string {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, ".eacd"), 0755)
+	os.MkdirAll(filepath.Join(dir, "dist"), 0755)
+	os.WriteFile(filepath.Join(dir, "dist", "index.html"), []byte("<h1>hi</h1>\n"), 0644)
+	cfg := "name: app\nserver: " + server + "\ntoken_env: EACD_TEST_TOKEN\ndeploy:\n  mappings:\n    - src: dist\n      dest: /var/www/app\n"
+	os.WriteFile(filepath.Join(dir, ".eacd", "config.yaml"), []byte(cfg), 0644)
+	t.Setenv("EACD_TEST_TOKEN", "secret")
+	return dir
+}
+
+func TestDeployOutputJSON(t *testing.T) {
+	srv := fakeDaemon(t)
+	defer srv.Close()
+	dir := writeProject(t, srv.URL)
+
+	var stdout, stderr bytes.Buffer
+	if err := Deploy([]string{"--dir", dir, "--output", "json"}, &stdout, &stderr); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(stderr.String(), "Files to upload") {
+		t.Errorf("progress not written to stderr:\n%s", stderr.String())
+	}
+
+	var rep runReport
+	if err := json.Unmarshal(stdout.Bytes(), &rep); err != nil {
+		t.Fatalf("stdout is not a JSON report: %v\n%s", err, stdout.String())
+	}
+	if !rep.OK || rep.ExitCode != 0 || rep.Action != "deploy" || len(rep.Servers) != 1 {
+		t.Fatalf("unexpected report %+v", rep)
+	}
+	s := rep.Servers[0]
+	if s.Status != "ok" || s.Release != 4 || s.FilesUploaded != 1 || s.FilesTotal != 1 || s.BytesSent == 0 {
+		t.Errorf("unexpected server report %+v", s)
+	}
+	if len(s.Phases) != 1 || s.Phases[0].Name != "files" || len(s.Warnings) != 1 {
+		t.Errorf("phases %+v, warnings %v", s.Phases, s.Warnings)
+	}
+}
+
+func TestDeployOutputGitHub(t *testing.T) {
+	srv := fakeDaemon(t)
+	defer srv.Close()
+	dir := writeProject(t, srv.URL)
+
+	var stdout bytes.Buffer
+	if err := Deploy([]string{"--dir", dir, "--output", "github"}, &stdout, &stdout); err != nil {
+		t.Fatal(err)
+	}
+	out := stdout.String()
+	for _, want := range []string{
+		"::warning title=eacd deploy " + ghEscapeProperty(hostLabel(srv.URL)) + "::post-hook failed: exit status 1",
+		"::notice title=eacd deploy",
+		"release #4, 1 of 1 files uploaded",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestOutputRejected(t *testing.T) {
+	if err := Status([]string{"--output", "github"}, &bytes.Buffer{}, &bytes.Buffer{}); err == nil {
+		t.Error("status accepted --output github")
+	}
+	if err := Deploy([]string{"--output", "json", "--dry-run"}, &bytes.Buffer{}, &bytes.Buffer{}); err == nil {
+		t.Error("deploy accepted --dry-run with JSON output")
+	}
+}
+
+func TestGitHubEscape(t *testing.T) {
+	if got := ghEscape("50% done\nnext"); got != "50%25 done%0Anext" {
+		t.Errorf("ghEscape = %q", got)
+	}
+	if got := ghEscapeProperty("host:8765, a"); got != "host%3A8765%2C a" {
+		t.Errorf("ghEscapeProperty = %q", got)
+	}
+}
@@ -1,16 +1,17 @@
 package cmd
 
 import (
-	"bytes"
+	"crypto/ed25519"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
 	"net/http"
-	"os"
-	"path/filepath"
+	"time"
 
+	"github.com/flo-mic/eacd/internal/api"
 	"github.com/flo-mic/eacd/internal/config"
+	"github.com/flo-mic/eacd/internal/signing"
 )
 
 // Rollback sends a rollback request to the server for the current project.
@@ -18,38 +19,89 @@ func Rollback(args []string, stdout, stderr io.Writer) error {
 	fs := flag.NewFlagSet("rollback", flag.ContinueOnError)
 	fs.SetOutput(stderr)
 	dir := fs.String("dir", ".", "Project directory (default: current directory)")
+	env := fs.String("env", "", "Environment from the 'environments:' block to roll back")
+	message := fs.String("m", "", "Rollback message recorded in the server's audit log")
+	output := outputFlag(fs)
 	if err := fs.Parse(args); err != nil {
 		return err
 	}
+	if err := checkOutput(*output, OutputText, OutputJSON, OutputGitHub); err != nil {
+		return err
+	}
+	if err := checkMessage(*message); err != nil {
+		return err
+	}
+
+	projectDir, cfg, err := loadProject(*dir, *env)
+	if err != nil {
+		return err
+	}
+
+	// With JSON output, stdout only carries the report.
+	progress := stdout
+	if *output == OutputJSON {
+		progress = stderr
+	}
+	rep := newRunReport("rollback", cfg.Name, cfg.Environment, cfg.Targets())
+	began := time.Now()
+	err = runRollback(projectDir, cfg, *message, progress, rep)
+	rep.finish(stdout, *output, err, began)
+	return err
+}
 
-	projectDir, err := filepath.Abs(*dir)
+// runRollback rolls back all targets, recording the outcome in rep.
+func runRollback(projectDir string, cfg *config.ClientConfig, message string, stdout io.Writer, rep *runReport) error {
+	creds, err := resolveToken(cfg, io.Discard)
 	if err != nil {
-		return fmt.Errorf("resolving project dir: %w", err)
+		return err
 	}
 
-	cfg, err := config.LoadClientConfig(projectDir)
+	webhooks, err := projectWebhooks(cfg)
 	if err != nil {
 		return err
 	}
+	signer, err := loadSigningKey(projectDir, cfg)
+	if err != nil {
+		return fmt.Errorf("loading signing key: %w", err)
+	}
+	req := api.RollbackRequest{Name: cfg.Name, Meta: collectMeta(projectDir, message), Webhooks: webhooks}
 
-	token := os.Getenv("EACD_TOKEN")
-	if token == "" && cfg.Token != "" {
-		token = cfg.Token
+	rollbackOne := func(server string, out io.Writer) error {
+		began := time.Now()
+		sr := rep.server(server)
+		err := rollbackOn(server, req, signer, creds, out, sr)
+		sr.record(err, began)
+		return err
 	}
-	if token == "" {
-		return fmt.Errorf("no auth token: set EACD_TOKEN or add 'token:' to .eacd/config.yaml")
+	targets := cfg.Targets()
+	if len(targets) == 1 && cfg.Rollout == nil {
+		return rollbackOne(targets[0], stdout)
 	}
+	return runRollout(targets, cfg.Rollout, stdout, rollbackOne)
+}
 
-	body, _ := json.Marshal(map[string]string{"name": cfg.Name})
-	resp, err := httpPost(cfg.Server+"/rollback", token, "application/json", body)
+// rollbackOn sends the rollback request to a single server, signed by signer
+// unless it is nil.
+func rollbackOn(server string, req api.RollbackRequest, signer ed25519.PrivateKey, creds credentials, stdout io.Writer, rep *serverReport) error {
+	if _, err := daemonInfo(server, creds); err != nil {
+		return err
+	}
+	var header http.Header
+	if signer != nil {
+		req.SignedAt, req.Nonce = signStamp()
+	}
+	body, _ := json.Marshal(req)
+	if signer != nil {
+		header = http.Header{api.ManifestSignatureHeader: {signing.Sign(signer, body)}}
+	}
+	resp, err := httpPostStream(server+"/rollback", creds, "application/json", body, header)
 	if err != nil {
 		return fmt.Errorf("rollback request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		errBody, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("rollback failed (%d): %s", resp.StatusCode, bytes.TrimSpace(errBody))
+		return responseError(resp, "rollback")
 	}
-	return streamAndCheck(resp.Body, stdout, "rollback failed (see output above)")
+	return readStream(resp, stdout, "rollback", rep)
 }
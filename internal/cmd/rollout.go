@@ -0,0 +1,225 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/flo-mic/eacd/internal/config"
+)
+
+// targetResult is the outcome of one server in a fan-out run.
+type targetResult struct {
+	server   string
+	status   string // "ok", "failed", "unhealthy" or "skipped"
+	duration time.Duration
+	err      error
+}
+
+// runRollout runs fn against every server according to the rollout strategy.
+// Output of each server is prefixed with its host. "parallel" runs all servers
+// at once; "rolling" runs them in batches and stops at the first batch that
+// fails or does not pass its health check. A summary table is printed at the end.
+func runRollout(servers []string, rollout *config.RolloutConfig, stdout io.Writer, fn func(server string, out io.Writer) error) error {
+	if rollout == nil {
+		rollout = &config.RolloutConfig{Strategy: config.StrategyParallel, HealthTimeout: 30 * time.Second}
+	}
+
+	batchSize := len(servers)
+	if rollout.Strategy == config.StrategyRolling {
+		batchSize = rollout.BatchSize
+	}
+
+	results := make([]targetResult, len(servers))
+	for i, s := range servers {
+		results[i] = targetResult{server: s, status: "skipped"}
+	}
+
+	var outMu sync.Mutex
+	failed := false
+	for start := 0; start < len(servers) && !failed; start += batchSize {
+		end := start + batchSize
+		if end > len(servers) {
+			end = len(servers)
+		}
+		if rollout.Strategy == config.StrategyRolling {
+			fmt.Fprintf(stdout, "[eacd] Rolling batch %d/%d: %s\n", start/batchSize+1, (len(servers)+batchSize-1)/batchSize, strings.Join(hostLabels(servers[start:end]), ", "))
+		}
+
+		var wg sync.WaitGroup
+		for i := start; i < end; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				pw := &prefixWriter{prefix: "[" + hostLabel(servers[i]) + "] ", w: stdout, mu: &outMu}
+				defer pw.Flush()
+
+				began := time.Now()
+				res := &results[i]
+				if err := fn(servers[i], pw); err != nil {
+					res.status, res.err = "failed", err
+				} else if err := waitHealthy(servers[i], rollout, pw); err != nil {
+					res.status, res.err = "unhealthy", err
+				} else {
+					res.status = "ok"
+				}
+				res.duration = time.Since(began)
+			}(i)
+		}
+		wg.Wait()
+
+		for i := start; i < end; i++ {
+			if results[i].status != "ok" {
+				failed = true
+			}
+		}
+	}
+
+	printSummary(stdout, results)
+
+	rerr := &rolloutError{total: len(servers), results: results}
+	for _, r := range results {
+		if r.status != "ok" {
+			rerr.failed++
+			if rerr.first == nil {
+				rerr.first = r.err
+			}
+		}
+	}
+	if rerr.failed > 0 {
+		return rerr
+	}
+	return nil
+}
+
+// rolloutError reports how many servers did not complete. It unwraps to the
+// first server's error so the exit code reflects what went wrong.
+type rolloutError struct {
+	failed, total int
+	first         error
+	results       []targetResult
+}
+
+func (e *rolloutError) Error() string {
+	return fmt.Sprintf("%d of %d servers did not complete", e.failed, e.total)
+}
+
+func (e *rolloutError) Unwrap() error { return e.first }
+
+// waitHealthy polls the rollout health check URL for server until it returns
+// a 2xx status or the timeout expires. Without a health check it returns nil.
+func waitHealthy(server string, rollout *config.RolloutConfig, out io.Writer) error {
+	if rollout.HealthCheck == "" {
+		return nil
+	}
+	checkURL := strings.ReplaceAll(rollout.HealthCheck, "{host}", hostName(server))
+	fmt.Fprintf(out, "[eacd] Waiting for health check %s\n", checkURL)
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	deadline := time.Now().Add(rollout.HealthTimeout)
+	var lastErr error
+	for {
+		resp, err := client.Get(checkURL)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+				fmt.Fprintf(out, "[eacd] Health check passed\n")
+				return nil
+			}
+			err = fmt.Errorf("HTTP %d", resp.StatusCode)
+		}
+		lastErr = err
+		if time.Now().After(deadline) {
+			return fmt.Errorf("health check %s failed after %s: %w", checkURL, rollout.HealthTimeout, lastErr)
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+func printSummary(stdout io.Writer, results []targetResult) {
+	fmt.Fprintln(stdout)
+	tw := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SERVER\tRESULT\tDURATION\tDETAIL")
+	for _, r := range results {
+		dur, detail := "-", ""
+		if r.status != "skipped" {
+			dur = r.duration.Round(100 * time.Millisecond).String()
+		}
+		if r.err != nil {
+			detail = r.err.Error()
+		} else if r.status == "skipped" {
+			detail = "not attempted (earlier batch failed)"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", hostLabel(r.server), r.status, dur, detail)
+	}
+	tw.Flush()
+}
+
+// hostLabel returns host:port of a server URL, used to prefix its output.
+func hostLabel(server string) string {
+	if u, err := url.Parse(server); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return server
+}
+
+func hostLabels(servers []string) []string {
+	out := make([]string, len(servers))
+	for i, s := range servers {
+		out[i] = hostLabel(s)
+	}
+	return out
+}
+
+// hostName returns the host of a server URL without the port.
+func hostName(server string) string {
+	if u, err := url.Parse(server); err == nil && u.Hostname() != "" {
+		return u.Hostname()
+	}
+	return server
+}
+
+// prefixWriter prepends prefix to every line written to w. Complete lines are
+// written under mu so output of concurrent servers does not interleave mid-line.
+type prefixWriter struct {
+	prefix string
+	w      io.Writer
+	mu     *sync.Mutex
+	buf    bytes.Buffer
+}
+
+func (pw *prefixWriter) Write(p []byte) (int, error) {
+	pw.buf.Write(p)
+	for {
+		line, err := pw.buf.ReadBytes('\n')
+		if err != nil {
+			// Incomplete line: keep it for the next write.
+			pw.buf.Reset()
+			pw.buf.Write(line)
+			return len(p), nil
+		}
+		pw.mu.Lock()
+		_, werr := fmt.Fprintf(pw.w, "%s%s", pw.prefix, line)
+		pw.mu.Unlock()
+		if werr != nil {
+			return 0, werr
+		}
+	}
+}
+
+// Flush writes any buffered partial line.
+func (pw *prefixWriter) Flush() {
+	if pw.buf.Len() == 0 {
+		return
+	}
+	pw.mu.Lock()
+	fmt.Fprintf(pw.w, "%s%s\n", pw.prefix, pw.buf.String())
+	pw.mu.Unlock()
+	pw.buf.Reset()
+}
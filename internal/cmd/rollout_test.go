@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/flo-mic/eacd/internal/config"
+)
+
+func TestRunRollout_RollingStopsAfterFailedBatch(t *testing.T) {
+	servers := []string{"http://a:8765", "http://b:8765", "http://c:8765"}
+	rollout := &config.RolloutConfig{Strategy: config.StrategyRolling, BatchSize: 1}
+
+	var mu sync.Mutex
+	var called []string
+	var out bytes.Buffer
+	err := runRollout(servers, rollout, &out, func(server string, w io.Writer) error {
+		mu.Lock()
+		called = append(called, server)
+		mu.Unlock()
+		fmt.Fprintln(w, "[eacd] working")
+		if server == "http://b:8765" {
+			return fmt.Errorf("boom")
+		}
+		return nil
+	})
+	if err == nil {
+		t.Fatal("expected error when a batch fails")
+	}
+	if len(called) != 2 {
+		t.Errorf("expected 2 servers to be attempted, got %v", called)
+	}
+	s := out.String()
+	if !strings.Contains(s, "[a:8765] [eacd] working") {
+		t.Errorf("output should be prefixed per host, got:\n%s", s)
+	}
+	if !strings.Contains(s, "skipped") || !strings.Contains(s, "failed") {
+		t.Errorf("summary should list failed and skipped servers, got:\n%s", s)
+	}
+}
+
+func TestRunRollout_ParallelRunsAll(t *testing.T) {
+	servers := []string{"http://a:8765", "http://b:8765", "http://c:8765"}
+	rollout := &config.RolloutConfig{Strategy: config.StrategyParallel}
+
+	var mu sync.Mutex
+	count := 0
+	err := runRollout(servers, rollout, io.Discard, func(server string, w io.Writer) error {
+		mu.Lock()
+		count++
+		mu.Unlock()
+		if server == "http://a:8765" {
+			return fmt.Errorf("boom")
+		}
+		return nil
+	})
+	if err == nil {
+		t.Fatal("expected error when one server fails")
+	}
+	if count != 3 {
+		t.Errorf("parallel should attempt every server, attempted %d", count)
+	}
+}
+
+func TestPrefixWriter_SplitsLines(t *testing.T) {
+	var out bytes.Buffer
+	pw := &prefixWriter{prefix: "[h] ", w: &out, mu: &sync.Mutex{}}
+	io.WriteString(pw, "one\ntw")
+	io.WriteString(pw, "o\nthree")
+	pw.Flush()
+
+	want := "[h] one\n[h] two\n[h] three\n"
+	if out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+}
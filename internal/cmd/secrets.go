@@ -0,0 +1,345 @@
+package cmd
+
+import (
+	"bufio"
+	"crypto/ecdh"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/flo-mic/eacd/internal/api"
+	"github.com/flo-mic/eacd/internal/config"
+	"github.com/flo-mic/eacd/internal/secrets"
+	"gopkg.in/yaml.v3"
+)
+
+// localRecipient is the recipient name of the developer's own key.
+const localRecipient = "local"
+
+// Secrets runs the secrets subcommand: set, get, edit and rotate values in
+// the encrypted .eacd/secrets.enc.
+func Secrets(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: eacd secrets <set|get|edit|rotate> [--env <name>] [args]")
+	}
+	sub := args[0]
+
+	fs := flag.NewFlagSet("secrets "+sub, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	dir := fs.String("dir", ".", "Project directory (default: current directory)")
+	env := fs.String("env", "", "Environment whose servers are recipients (uses .eacd/secrets.<env>.enc)")
+	trust := keyTrust{stdin: stdin, stdout: stdout}
+	fs.Func("trust-key", "Fingerprint of a server key fetched over plain HTTP to encrypt to without asking (repeatable)", func(v string) error {
+		trust.pinned = append(trust.pinned, v)
+		return nil
+	})
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	projectDir, cfg, err := loadProject(*dir, *env)
+	if err != nil {
+		return err
+	}
+	path := secretsPath(projectDir, cfg)
+
+	switch sub {
+	case "set":
+		if fs.NArg() < 1 || fs.NArg() > 2 {
+			return fmt.Errorf("usage: eacd secrets set <name> [value]  (value is read from stdin if omitted)")
+		}
+		value := ""
+		if fs.NArg() == 2 {
+			value = fs.Arg(1)
+		} else {
+			if value, err = readLine(stdin); err != nil {
+				return err
+			}
+		}
+		return updateSecrets(path, cfg, trust, stdout, func(values map[string]string) error {
+			values[fs.Arg(0)] = value
+			return nil
+		})
+
+	case "get":
+		if fs.NArg() != 1 {
+			return fmt.Errorf("usage: eacd secrets get <name>")
+		}
+		values, err := openSecrets(path)
+		if err != nil {
+			return err
+		}
+		v, ok := values[fs.Arg(0)]
+		if !ok {
+			return fmt.Errorf("secret %q not found in %s", fs.Arg(0), filepath.Base(path))
+		}
+		fmt.Fprintln(stdout, v)
+		return nil
+
+	case "edit":
+		return updateSecrets(path, cfg, trust, stdout, func(values map[string]string) error {
+			edited, err := editValues(values, stdin, stdout, stderr)
+			if err != nil {
+				return err
+			}
+			for k := range values {
+				delete(values, k)
+			}
+			for k, v := range edited {
+				values[k] = v
+			}
+			return nil
+		})
+
+	case "rotate":
+		return rotateSecrets(path, cfg, trust, stdout)
+
+	default:
+		return fmt.Errorf("unknown secrets command %q (want set, get, edit or rotate)", sub)
+	}
+}
+
+// secretsPath returns .eacd/secrets.enc, or .eacd/secrets.<env>.enc when an
+// environment is selected, since each environment has its own servers.
+func secretsPath(projectDir string, cfg *config.ClientConfig) string {
+	if cfg.Environment != "" {
+		return filepath.Join(projectDir, ".eacd", "secrets."+cfg.Environment+".enc")
+	}
+	return filepath.Join(projectDir, ".eacd", "secrets.enc")
+}
+
+// localSecretsKey returns the developer's own key: EACD_SECRETS_KEY (base64,
+// for CI) or ~/.config/eacd/secrets.key. With create, a missing key file is generated.
+func localSecretsKey(create bool) (*ecdh.PrivateKey, error) {
+	if v := os.Getenv("EACD_SECRETS_KEY"); v != "" {
+		return secrets.ParsePrivateKey(v)
+	}
+	path, err := config.UserSecretsKeyPath()
+	if err != nil {
+		return nil, err
+	}
+	if create {
+		return secrets.LoadOrCreateKey(path)
+	}
+	key, err := secrets.LoadKey(path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no local secrets key at %s (set EACD_SECRETS_KEY in CI)", path)
+	}
+	return key, err
+}
+
+// openSecrets decrypts the secrets file with the local key.
+func openSecrets(path string) (map[string]string, error) {
+	f, err := secrets.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := localSecretsKey(false)
+	if err != nil {
+		return nil, err
+	}
+	values, err := f.Open(key)
+	if err == secrets.ErrNotRecipient {
+		return nil, fmt.Errorf("%s: your key is not a recipient; ask someone who can decrypt it to run 'eacd secrets rotate'", filepath.Base(path))
+	}
+	return values, err
+}
+
+// updateSecrets decrypts the secrets file (or starts empty), applies fn and
+// seals the result for the same recipients. A new file is sealed for the
+// local key and every configured server.
+func updateSecrets(path string, cfg *config.ClientConfig, trust keyTrust, stdout io.Writer, fn func(map[string]string) error) error {
+	values := map[string]string{}
+	var recipients map[string]*ecdh.PublicKey
+
+	if f, err := secrets.ReadFile(path); err == nil {
+		if values, err = openSecrets(path); err != nil {
+			return err
+		}
+		if recipients, err = f.RecipientKeys(); err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	} else {
+		if recipients, err = fetchRecipients(cfg, trust, stdout); err != nil {
+			return err
+		}
+	}
+
+	key, err := localSecretsKey(true)
+	if err != nil {
+		return err
+	}
+	if _, ok := recipients[localRecipient]; !ok {
+		recipients[localRecipient] = key.PublicKey()
+	}
+
+	if err := fn(values); err != nil {
+		return err
+	}
+	return sealSecrets(path, values, recipients, stdout)
+}
+
+// rotateSecrets re-encrypts the values with a fresh data key for the local
+// key and the current key of every configured server. Recipients that are no
+// longer configured lose access.
+func rotateSecrets(path string, cfg *config.ClientConfig, trust keyTrust, stdout io.Writer) error {
+	values, err := openSecrets(path)
+	if err != nil {
+		return err
+	}
+	recipients, err := fetchRecipients(cfg, trust, stdout)
+	if err != nil {
+		return err
+	}
+	key, err := localSecretsKey(false)
+	if err != nil {
+		return err
+	}
+	recipients[localRecipient] = key.PublicKey()
+	return sealSecrets(path, values, recipients, stdout)
+}
+
+func sealSecrets(path string, values map[string]string, recipients map[string]*ecdh.PublicKey, stdout io.Writer) error {
+	f, err := secrets.Seal(values, recipients)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := secrets.WriteFile(path, f); err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(recipients))
+	for name := range recipients {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintf(stdout, "[eacd] Wrote %s (%d secrets, recipients: %s)\n", filepath.Base(path), len(values), strings.Join(names, ", "))
+	return nil
+}
+
+// keyTrust decides whether to encrypt to a server key that was fetched
+// without authenticating the server.
+type keyTrust struct {
+	pinned []string // fingerprints from --trust-key
+	stdin  io.Reader
+	stdout io.Writer
+}
+
+// check accepts pub from server if the transport authenticates the server
+// (https:// or ssh://), its fingerprint is pinned or the user confirms it.
+// Over plain HTTP anyone on the network could swap in their own key.
+func (t keyTrust) check(server string, pub *ecdh.PublicKey) error {
+	if u, err := url.Parse(server); err == nil && (u.Scheme == "https" || u.Scheme == "ssh") {
+		return nil
+	}
+	fp := secrets.Fingerprint(pub)
+	if slices.Contains(t.pinned, fp) {
+		return nil
+	}
+	fmt.Fprintf(t.stdout, "[eacd] %s is plain HTTP, so its secrets key cannot be verified.\n", server)
+	fmt.Fprintf(t.stdout, "[eacd] Key fingerprint: %s\n", fp)
+	fmt.Fprintf(t.stdout, "[eacd] Compare it with 'eacdd -secrets-fingerprint' on the server, or pass --trust-key %s\n", fp)
+	fmt.Fprint(t.stdout, "Encrypt secrets to this key? [y/N] ")
+	answer := ""
+	if t.stdin != nil {
+		answer, _ = readLine(t.stdin)
+	}
+	if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+		return fmt.Errorf("secrets key of %s not confirmed", server)
+	}
+	return nil
+}
+
+// fetchRecipients asks every configured server for its secrets public key.
+func fetchRecipients(cfg *config.ClientConfig, trust keyTrust, stdout io.Writer) (map[string]*ecdh.PublicKey, error) {
+	creds, err := resolveToken(cfg, io.Discard)
+	if err != nil {
+		return nil, err
+	}
+
+	recipients := map[string]*ecdh.PublicKey{}
+	for _, server := range cfg.Targets() {
+		fmt.Fprintf(stdout, "[eacd] Fetching secrets key from %s\n", server)
+		resp, err := httpGet(server+"/secrets/key", creds)
+		if err != nil {
+			return nil, fmt.Errorf("fetching key from %s: %w", server, err)
+		}
+		var keyResp api.SecretsKeyResponse
+		err = decodeJSONResponse(resp, &keyResp)
+		if err != nil {
+			return nil, fmt.Errorf("fetching key from %s: %w", server, err)
+		}
+		pub, err := secrets.ParsePublicKey(keyResp.PublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("key from %s: %w", server, err)
+		}
+		if err := trust.check(server, pub); err != nil {
+			return nil, err
+		}
+		recipients[hostLabel(server)] = pub
+	}
+	return recipients, nil
+}
+
+// editValues opens the values as YAML in $EDITOR and returns the edited map.
+func editValues(values map[string]string, stdin io.Reader, stdout, stderr io.Writer) (map[string]string, error) {
+	tmp, err := os.CreateTemp("", "eacd-secrets-*.yaml")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+
+	data, err := yaml.Marshal(values)
+	if err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if len(values) == 0 {
+		data = []byte("# name: value\n")
+	}
+	_, err = tmp.Write(data)
+	tmp.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	editor := os.Getenv("EDITOR")
+	if editor == "" {
+		editor = "vi"
+	}
+	c := exec.Command("/bin/sh", "-c", editor+` "$1"`, "sh", tmp.Name())
+	c.Stdin, c.Stdout, c.Stderr = stdin, stdout, stderr
+	if err := c.Run(); err != nil {
+		return nil, fmt.Errorf("editor: %w", err)
+	}
+
+	data, err = os.ReadFile(tmp.Name())
+	if err != nil {
+		return nil, err
+	}
+	edited := map[string]string{}
+	if err := yaml.Unmarshal(data, &edited); err != nil {
+		return nil, fmt.Errorf("parsing edited secrets: %w", err)
+	}
+	return edited, nil
+}
+
+func readLine(r io.Reader) (string, error) {
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
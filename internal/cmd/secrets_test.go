@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/flo-mic/eacd/internal/api"
+	"github.com/flo-mic/eacd/internal/secrets"
+)
+
+func TestSecrets_SetGetAndDaemonCanDecrypt(t *testing.T) {
+	daemonKey, _ := secrets.GenerateKey()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/secrets/key" || r.Header.Get("Authorization") != "Bearer tok" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(api.SecretsKeyResponse{PublicKey: secrets.EncodePublicKey(daemonKey.PublicKey())})
+	}))
+	defer srv.Close()
+
+	localKey, _ := secrets.GenerateKey()
+	t.Setenv("EACD_SECRETS_KEY", secrets.EncodePrivateKey(localKey))
+	t.Setenv("EACD_TOKEN", "tok")
+
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, ".eacd"), 0755)
+	os.WriteFile(filepath.Join(dir, ".eacd", "config.yaml"), []byte("name: app\nserver: "+srv.URL+"\ndeploy:\n  mappings:\n    - src: ./dist\n      dest: /opt/app\n"), 0644)
+
+	// The server is plain HTTP, so its key must be confirmed or pinned.
+	if err := Secrets([]string{"set", "--dir", dir, "db_password", "hunter2"}, strings.NewReader("n\n"), io.Discard, io.Discard); err == nil || !strings.Contains(err.Error(), "not confirmed") {
+		t.Fatalf("unconfirmed key: got %v", err)
+	}
+	fp := secrets.Fingerprint(daemonKey.PublicKey())
+	if err := Secrets([]string{"set", "--dir", dir, "--trust-key", fp, "db_password", "hunter2"}, nil, io.Discard, io.Discard); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	// Second value from stdin reuses the stored recipients.
+	if err := Secrets([]string{"set", "--dir", dir, "api_key"}, strings.NewReader("abc123\n"), io.Discard, io.Discard); err != nil {
+		t.Fatalf("set from stdin: %v", err)
+	}
+
+	var out strings.Builder
+	if err := Secrets([]string{"get", "--dir", dir, "db_password"}, nil, &out, io.Discard); err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if out.String() != "hunter2\n" {
+		t.Errorf("get = %q", out.String())
+	}
+
+	f, err := secrets.ReadFile(filepath.Join(dir, ".eacd", "secrets.enc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, err := f.Open(daemonKey)
+	if err != nil {
+		t.Fatalf("daemon cannot decrypt: %v", err)
+	}
+	if values["api_key"] != "abc123" {
+		t.Errorf("values = %v", values)
+	}
+}
+
+func TestSecretsConfirmPlainHTTPKey(t *testing.T) {
+	daemonKey, _ := secrets.GenerateKey()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(api.SecretsKeyResponse{PublicKey: secrets.EncodePublicKey(daemonKey.PublicKey())})
+	}))
+	defer srv.Close()
+
+	localKey, _ := secrets.GenerateKey()
+	t.Setenv("EACD_SECRETS_KEY", secrets.EncodePrivateKey(localKey))
+	t.Setenv("EACD_TOKEN", "tok")
+
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, ".eacd"), 0755)
+	os.WriteFile(filepath.Join(dir, ".eacd", "config.yaml"), []byte("name: app\nserver: "+srv.URL+"\ndeploy:\n  mappings:\n    - src: ./dist\n      dest: /opt/app\n"), 0644)
+
+	var out strings.Builder
+	if err := Secrets([]string{"set", "--dir", dir, "a", "1"}, strings.NewReader("yes\n"), &out, io.Discard); err != nil {
+		t.Fatalf("confirmed key: %v", err)
+	}
+	if !strings.Contains(out.String(), secrets.Fingerprint(daemonKey.PublicKey())) {
+		t.Errorf("fingerprint not shown:\n%s", out.String())
+	}
+}
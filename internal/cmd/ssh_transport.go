@@ -0,0 +1,196 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultSocket is the daemon socket of ssh:// servers whose URL names none.
+const defaultSocket = "/run/eacd.sock"
+
+// socketPathRe matches the socket paths sshArgs accepts. The path ends up in
+// the command the remote login shell runs, so it must not contain anything
+// the shell would interpret.
+var socketPathRe = regexp.MustCompile(`^/[A-Za-z0-9._/-]+\.sock$`)
+
+func init() {
+	http.DefaultTransport.(*http.Transport).RegisterProtocol("ssh", &sshTransport{transports: map[string]*http.Transport{}})
+}
+
+// sshTransport sends requests for ssh://user@host[:port]/path/to/eacd.sock
+// servers to the daemon's Unix socket through "ssh user@host eacdd -connect".
+// Connections are kept alive like any HTTP connection, so one SSH session
+// serves many requests.
+type sshTransport struct {
+	mu         sync.Mutex
+	transports map[string]*http.Transport // by user@host:port and socket
+}
+
+// splitSSHPath splits the path of an ssh:// request URL into the socket,
+// the first path up to a segment ending in ".sock", and the API path.
+func splitSSHPath(p string) (socket, rest string) {
+	segments := strings.Split(p, "/")
+	for i, s := range segments {
+		if strings.HasSuffix(s, ".sock") {
+			return strings.Join(segments[:i+1], "/"), "/" + strings.Join(segments[i+1:], "/")
+		}
+	}
+	return defaultSocket, p
+}
+
+func (t *sshTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	socket, path := splitSSHPath(req.URL.Path)
+	dest := req.URL.Hostname()
+	if u := req.URL.User; u != nil {
+		dest = u.Username() + "@" + dest
+	}
+	port := req.URL.Port()
+
+	key := dest + ":" + port + socket
+	t.mu.Lock()
+	tr, ok := t.transports[key]
+	if !ok {
+		tr = &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return sshDial(dest, port, socket)
+			},
+			IdleConnTimeout: 90 * time.Second,
+		}
+		t.transports[key] = tr
+	}
+	t.mu.Unlock()
+
+	out := req.Clone(req.Context())
+	u := *req.URL
+	u.Scheme, u.Host, u.User, u.Path, u.RawPath = "http", "eacdd", nil, path, ""
+	out.URL = &u
+	out.Host = ""
+	return tr.RoundTrip(out)
+}
+
+// sshAPIRequestURI returns the request URI the daemon sees for u: for
+// ssh:// URLs the socket path is not part of it.
+func sshAPIRequestURI(u *url.URL) string {
+	if u.Scheme != "ssh" {
+		return u.RequestURI()
+	}
+	_, path := splitSSHPath(u.Path)
+	v := url.URL{Path: path, RawQuery: u.RawQuery}
+	return v.RequestURI()
+}
+
+// sshDial starts an SSH session to dest that is connected to socket on the
+// remote host; replaced in tests.
+var sshDial = func(dest, port, socket string) (net.Conn, error) {
+	args, err := sshArgs(dest, port, socket)
+	if err != nil {
+		return nil, err
+	}
+	c := exec.Command("ssh", args...)
+	stdin, err := c.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := c.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	conn := &cmdConn{cmd: c, r: stdout, w: stdin, addr: sshAddr(dest + ":" + socket)}
+	c.Stderr = &conn.stderr
+	if err := c.Start(); err != nil {
+		return nil, fmt.Errorf("starting ssh: %w", err)
+	}
+	return conn, nil
+}
+
+// sshArgs returns the ssh arguments that connect to socket on dest
+// ("host" or "user@host"). A user or host starting with "-" is refused, as
+// ssh would read it as an option, e.g. -oProxyCommand from a server URL in
+// a cloned repository.
+func sshArgs(dest, port, socket string) ([]string, error) {
+	user, host, ok := strings.Cut(dest, "@")
+	if !ok {
+		user, host = "", dest
+	}
+	if host == "" || strings.HasPrefix(host, "-") || strings.HasPrefix(user, "-") || strings.HasPrefix(port, "-") {
+		return nil, fmt.Errorf("invalid ssh destination %q", dest)
+	}
+	if !socketPathRe.MatchString(socket) {
+		return nil, fmt.Errorf("invalid daemon socket %q in ssh URL (use an absolute path of letters, digits, '.', '_', '-' and '/' ending in .sock)", socket)
+	}
+	args := []string{"-o", "BatchMode=yes"}
+	if port != "" {
+		args = append(args, "-p", port)
+	}
+	return append(args, "--", dest, "eacdd", "-connect", socket), nil
+}
+
+// cmdConn is a net.Conn over the stdin and stdout of a command.
+type cmdConn struct {
+	cmd    *exec.Cmd
+	r      io.ReadCloser
+	w      io.WriteCloser
+	addr   sshAddr
+	stderr lockedBuffer
+	once   sync.Once
+}
+
+// lockedBuffer collects the stderr of ssh while the connection reads.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func (c *cmdConn) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if err == io.EOF {
+		if msg := strings.TrimSpace(c.stderr.String()); msg != "" {
+			err = fmt.Errorf("ssh %s: %s", c.addr, msg)
+		}
+	}
+	return n, err
+}
+
+func (c *cmdConn) Write(p []byte) (int, error) { return c.w.Write(p) }
+
+func (c *cmdConn) Close() error {
+	c.once.Do(func() {
+		c.w.Close()
+		c.cmd.Process.Kill()
+		c.cmd.Wait()
+	})
+	return nil
+}
+
+func (c *cmdConn) LocalAddr() net.Addr                { return c.addr }
+func (c *cmdConn) RemoteAddr() net.Addr               { return c.addr }
+func (c *cmdConn) SetDeadline(t time.Time) error      { return nil }
+func (c *cmdConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *cmdConn) SetWriteDeadline(t time.Time) error { return nil }
+
+type sshAddr string
+
+func (a sshAddr) Network() string { return "ssh" }
+func (a sshAddr) String() string  { return string(a) }
@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/flo-mic/eacd/internal/api"
+)
+
+func TestSplitSSHPath(t *testing.T) {
+	cases := []struct{ path, socket, rest string }{
+		{"/run/eacd.sock/version", "/run/eacd.sock", "/version"},
+		{"/run/eacd.sock", "/run/eacd.sock", "/"},
+		{"/var/run/eacd/api.sock/projects/app", "/var/run/eacd/api.sock", "/projects/app"},
+		{"/version", defaultSocket, "/version"},
+	}
+	for _, c := range cases {
+		socket, rest := splitSSHPath(c.path)
+		if socket != c.socket || rest != c.rest {
+			t.Errorf("%s: got %s %s, want %s %s", c.path, socket, rest, c.socket, c.rest)
+		}
+	}
+}
+
+func TestSSHArgs(t *testing.T) {
+	args, err := sshArgs("deploy@ct-101", "2222", "/run/eacd.sock")
+	want := []string{"-o", "BatchMode=yes", "-p", "2222", "--", "deploy@ct-101", "eacdd", "-connect", "/run/eacd.sock"}
+	if err != nil || !slices.Equal(args, want) {
+		t.Errorf("got %q (%v), want %q", args, err, want)
+	}
+
+	for _, dest := range []string{"-oProxyCommand=id", "-oProxyCommand=id@host", "user@-oProxyCommand=id", ""} {
+		if args, err := sshArgs(dest, "", defaultSocket); err == nil {
+			t.Errorf("%q accepted: %q", dest, args)
+		}
+	}
+
+	// The real dialer refuses such a server URL before running anything.
+	_, err = http.Get("ssh://-oProxyCommand=id/run/eacd.sock/version")
+	if err == nil || !strings.Contains(err.Error(), "invalid ssh destination") {
+		t.Errorf("option as host: got %v", err)
+	}
+
+	// The socket is part of the remote shell command.
+	for _, socket := range []string{"/run/$(id>/tmp/x).sock", "/run/a;id;.sock", "/run/a b.sock", "/run/`id`.sock", "/run/a|id.sock", "run/eacd.sock", "/run/eacd"} {
+		if args, err := sshArgs("host", "", socket); err == nil {
+			t.Errorf("socket %q accepted: %q", socket, args)
+		}
+	}
+	_, err = http.Get("ssh://host/run/$(id>%2Ftmp%2Fx).sock/version")
+	if err == nil || !strings.Contains(err.Error(), "invalid daemon socket") {
+		t.Errorf("shell metacharacters in socket: got %v", err)
+	}
+}
+
+func TestSSHTransport(t *testing.T) {
+	dir, err := os.MkdirTemp("", "eacd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sock := filepath.Join(dir, "d.sock")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/version" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(api.VersionResponse{Version: "v1.2.3", Protocol: api.ProtocolVersion, MinProtocol: api.MinProtocolVersion})
+	})}
+	go srv.Serve(l)
+	defer srv.Close()
+
+	var gotDest, gotPort, gotSocket string
+	orig := sshDial
+	sshDial = func(dest, port, socket string) (net.Conn, error) {
+		gotDest, gotPort, gotSocket = dest, port, socket
+		return net.Dial("unix", sock)
+	}
+	defer func() { sshDial = orig }()
+
+	v, err := daemonInfo("ssh://root@ct.lan:2222/run/eacd.sock", credentials{token: "t"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Version != "v1.2.3" {
+		t.Errorf("version = %q", v.Version)
+	}
+	if gotDest != "root@ct.lan" || gotPort != "2222" || gotSocket != "/run/eacd.sock" {
+		t.Errorf("ssh to %s port %s socket %s", gotDest, gotPort, gotSocket)
+	}
+}
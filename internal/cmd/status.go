@@ -0,0 +1,160 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"text/tabwriter"
+
+	"github.com/flo-mic/eacd/internal/api"
+)
+
+// Status prints what is currently deployed on the configured server(s).
+func Status(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("status", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	dir := fs.String("dir", ".", "Project directory (default: current directory)")
+	env := fs.String("env", "", "Environment from the 'environments:' block")
+	output := outputFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := checkOutput(*output, OutputText, OutputJSON); err != nil {
+		return err
+	}
+
+	_, cfg, err := loadProject(*dir, *env)
+	if err != nil {
+		return err
+	}
+	creds, err := resolveToken(cfg, stderr)
+	if err != nil {
+		return err
+	}
+
+	report := statusReport{Version: reportVersion, Project: cfg.Name, Environment: cfg.Environment}
+	for i, server := range cfg.Targets() {
+		status, err := fetchStatus(server, cfg.Name, creds)
+		if err != nil {
+			return err
+		}
+		report.Servers = append(report.Servers, serverStatus{Server: server, Deployed: status != nil, Status: status})
+		if *output == OutputJSON {
+			continue
+		}
+
+		if i > 0 {
+			fmt.Fprintln(stdout)
+		}
+		if status == nil {
+			fmt.Fprintf(stdout, "[eacd] %s has not been deployed to %s\n", cfg.Name, hostLabel(server))
+			continue
+		}
+		fmt.Fprintf(stdout, "[eacd] %s on %s\n", status.Name, hostLabel(server))
+		printStatus(stdout, status)
+	}
+	if *output == OutputJSON {
+		return writeJSON(stdout, report)
+	}
+	return nil
+}
+
+// statusReport is the JSON output of eacd status.
+type statusReport struct {
+	Version     int            `json:"version"`
+	Project     string         `json:"project"`
+	Environment string         `json:"environment,omitempty"`
+	Servers     []serverStatus `json:"servers"`
+}
+
+type serverStatus struct {
+	Server   string             `json:"server"`
+	Deployed bool               `json:"deployed"`
+	Status   *api.ProjectStatus `json:"status,omitempty"`
+}
+
+// fetchStatus returns the project's status on server, or nil if it was
+// never deployed there.
+func fetchStatus(server, name string, creds credentials) (*api.ProjectStatus, error) {
+	if _, err := requireFeatures(server, creds, api.FeatureReleases); err != nil {
+		return nil, err
+	}
+	resp, err := httpGet(server+"/projects/"+url.PathEscape(name), creds)
+	if err != nil {
+		return nil, fmt.Errorf("status request: %w", err)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, nil
+	}
+	var status api.ProjectStatus
+	if err := decodeJSONResponse(resp, &status); err != nil {
+		return nil, fmt.Errorf("status request to %s: %w", server, err)
+	}
+	return &status, nil
+}
+
+func printStatus(w io.Writer, status *api.ProjectStatus) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	if rel := status.Current; rel != nil {
+		fmt.Fprintf(tw, "Release:\t#%d %s (%s)\n", rel.ID, rel.Action, rel.Time.Local().Format("2006-01-02 15:04:05"))
+		fmt.Fprintf(tw, "Commit:\t%s\n", releaseCommit(rel))
+		fmt.Fprintf(tw, "Deployed by:\t%s\n", releaseWho(rel))
+		if rel.Meta != nil && rel.Meta.Message != "" {
+			fmt.Fprintf(tw, "Message:\t%s\n", rel.Meta.Message)
+		}
+	} else {
+		fmt.Fprintf(tw, "Release:\tnone (no successful deploy)\n")
+	}
+	rollback := "not available"
+	if status.RollbackAvailable {
+		rollback = "available"
+	}
+	fmt.Fprintf(tw, "Rollback:\t%s\n", rollback)
+	tw.Flush()
+
+	if len(status.Services) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "Services:")
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "  NAME\tDESIRED\tACTIVE\tENABLED")
+	for _, s := range status.Services {
+		fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\n", s.Name, s.Desired, yesNo(s.Active), yesNo(s.Enabled))
+	}
+	tw.Flush()
+}
+
+// releaseCommit formats the git commit and branch of a release.
+func releaseCommit(rel *api.Release) string {
+	m := rel.Meta
+	if m == nil || m.GitCommit == "" {
+		return "-"
+	}
+	s := shortCommit(m.GitCommit)
+	if m.GitDirty {
+		s += "+dirty"
+	}
+	if m.GitBranch != "" {
+		s += " (" + m.GitBranch + ")"
+	}
+	return s
+}
+
+// releaseWho formats who triggered a release: the local user and host if
+// known, and the token fingerprint.
+func releaseWho(rel *api.Release) string {
+	if m := rel.Meta; m != nil && m.User != "" {
+		return m.User + "@" + m.Hostname + " (" + rel.Identity + ")"
+	}
+	return rel.Identity
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
@@ -0,0 +1,192 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/flo-mic/eacd/internal/api"
+	"github.com/flo-mic/eacd/internal/events"
+)
+
+// Exit codes of eacd. Failures reported by the daemon map to the error code
+// of its result event; anything else exits with ExitError.
+const (
+	ExitError        = 1
+	ExitDrift        = 2
+	ExitBadRequest   = 3
+	ExitSecrets      = 4
+	ExitInventory    = 5
+	ExitHook         = 6
+	ExitFiles        = 7
+	ExitSystemd      = 8
+	ExitRollback     = 9 // rollback failed or no snapshot
+	ExitBusy         = 10
+	ExitUnauthorized = 11
+	ExitInternal     = 12
+	ExitIncompatible = 13 // daemon speaks an incompatible protocol or lacks a feature
+	ExitSignature    = 14 // manifest not signed by a trusted key
+	ExitDiskSpace    = 15 // not enough disk space on the server
+)
+
+// Client-side error codes of RemoteError, derived from the HTTP status.
+const (
+	CodeBusy         = "busy"
+	CodeUnauthorized = "unauthorized"
+)
+
+var exitCodes = map[string]int{
+	api.CodeBadRequest: ExitBadRequest,
+	api.CodeSecrets:    ExitSecrets,
+	api.CodeInventory:  ExitInventory,
+	api.CodeHook:       ExitHook,
+	api.CodeFiles:      ExitFiles,
+	api.CodeSystemd:    ExitSystemd,
+	api.CodeNoSnapshot: ExitRollback,
+	api.CodeRollback:   ExitRollback,
+	api.CodeInternal:   ExitInternal,
+	api.CodeSignature:  ExitSignature,
+	api.CodeDiskSpace:  ExitDiskSpace,
+	CodeBusy:           ExitBusy,
+	CodeUnauthorized:   ExitUnauthorized,
+	CodeIncompatible:   ExitIncompatible,
+}
+
+// RemoteError is a failure reported by the daemon.
+type RemoteError struct {
+	Code    string // api.Code*, CodeBusy, CodeUnauthorized or CodeIncompatible
+	Message string
+}
+
+func (e *RemoteError) Error() string {
+	if e.Message == "" {
+		return e.Code
+	}
+	return fmt.Sprintf("%s (%s)", e.Message, e.Code)
+}
+
+// ExitCode returns the process exit code for an error returned by a command.
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	if errors.Is(err, ErrDrift) {
+		return ExitDrift
+	}
+	var re *RemoteError
+	if errors.As(err, &re) {
+		if code, ok := exitCodes[re.Code]; ok {
+			return code
+		}
+	}
+	return ExitError
+}
+
+// httpPostStream is httpPost for /deploy and /rollback: it asks for the
+// event stream, which older daemons ignore. header, if not nil, is added to
+// the request.
+func httpPostStream(url string, creds credentials, contentType string, body []byte, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if err := authorize(req, creds, body); err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Accept", api.EventsMediaType+", text/plain;q=0.5")
+	return http.DefaultClient.Do(req)
+}
+
+// responseError turns a non-200 response into an error. A busy daemon and a
+// rejected token get their own RemoteError codes.
+func responseError(resp *http.Response, what string) error {
+	body, _ := io.ReadAll(resp.Body)
+	msg := fmt.Sprintf("%s failed (%d): %s", what, resp.StatusCode, bytes.TrimSpace(body))
+	switch resp.StatusCode {
+	case http.StatusConflict:
+		return &RemoteError{Code: CodeBusy, Message: msg}
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return &RemoteError{Code: CodeUnauthorized, Message: msg}
+	}
+	return errors.New(msg)
+}
+
+// readStream renders the output of a deploy or rollback to out and returns
+// its result: the event stream if the daemon sent one, otherwise the
+// plain-text stream checked via streamAndCheck. Events are recorded in rep.
+func readStream(resp *http.Response, out io.Writer, what string, rep *serverReport) error {
+	if mt, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mt != api.EventsMediaType {
+		return streamAndCheck(resp.Body, out, what+" failed (see output above)")
+	}
+
+	sc := bufio.NewScanner(resp.Body)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		var e api.Event
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return fmt.Errorf("reading %s events: %w", what, err)
+		}
+		rep.event(e)
+		if e.Type == api.EventResult {
+			return printResult(out, e, what)
+		}
+		printEvent(out, e)
+	}
+	if err := sc.Err(); err != nil {
+		return fmt.Errorf("reading %s events: %w", what, err)
+	}
+	return fmt.Errorf("%s failed: connection closed before the result", what)
+}
+
+// printEvent writes the human-readable form of a progress event.
+func printEvent(out io.Writer, e api.Event) {
+	switch e.Type {
+	case api.EventPhaseStart:
+		fmt.Fprintf(out, "[eacd] → %s\n", e.Phase)
+	case api.EventPhaseEnd:
+		fmt.Fprintf(out, "[eacd] ✓ %s (%s)\n", e.Phase, formatMS(e.DurationMS))
+	case api.EventHookOutput:
+		fmt.Fprintf(out, "[eacd]   %s | %s\n", e.Hook, e.Message)
+	case api.EventFile:
+		fmt.Fprintf(out, "[eacd]   placed %s (%s)\n", e.Path, e.Mode)
+	default:
+		io.WriteString(out, events.Text(e))
+	}
+}
+
+// printResult writes the result event and returns it as an error on failure.
+func printResult(out io.Writer, e api.Event, what string) error {
+	if !e.OK {
+		fmt.Fprintf(out, "[eacd] ✗ %s failed after %s\n", what, formatMS(e.DurationMS))
+		msg := e.Error
+		if msg == "" {
+			msg = what + " failed"
+		}
+		return &RemoteError{Code: e.Code, Message: msg}
+	}
+	if e.Release > 0 {
+		fmt.Fprintf(out, "[eacd] ✓ %s finished in %s (release #%d)\n", what, formatMS(e.DurationMS), e.Release)
+	} else {
+		fmt.Fprintf(out, "[eacd] ✓ %s finished in %s\n", what, formatMS(e.DurationMS))
+	}
+	return nil
+}
+
+// formatMS formats a duration in milliseconds, to a tenth of a second above one second.
+func formatMS(ms int64) string {
+	d := time.Duration(ms) * time.Millisecond
+	if d >= time.Second {
+		d = d.Round(100 * time.Millisecond)
+	}
+	return d.String()
+}
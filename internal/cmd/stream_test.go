@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/flo-mic/eacd/internal/api"
+)
+
+func TestReadStreamEvents(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept") == "" {
+			t.Error("client did not ask for the event stream")
+		}
+		w.Header().Set("Content-Type", api.EventsMediaType)
+		fmt.Fprintln(w, `{"type":"phase_start","phase":"files"}`)
+		fmt.Fprintln(w, `{"type":"file","path":"/opt/app/run.sh","mode":"0755"}`)
+		fmt.Fprintln(w, `{"type":"phase_end","phase":"files","duration_ms":1240}`)
+		fmt.Fprintln(w, `{"type":"hook_output","hook":"post.sh","message":"migrated"}`)
+		fmt.Fprintln(w, `{"type":"warning","message":"post-hook failed"}`)
+		fmt.Fprintln(w, `{"type":"result","code":"systemd","error":"systemd: restart failed","duration_ms":3000}`)
+	}))
+	defer srv.Close()
+
+	resp, err := httpPostStream(srv.URL, credentials{token: "t"}, "application/json", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var out bytes.Buffer
+	err = readStream(resp, &out, "deployment", &serverReport{})
+	var re *RemoteError
+	if !errors.As(err, &re) || re.Code != api.CodeSystemd {
+		t.Fatalf("expected systemd RemoteError, got %v", err)
+	}
+	if ExitCode(err) != ExitSystemd {
+		t.Errorf("exit code = %d, want %d", ExitCode(err), ExitSystemd)
+	}
+	for _, want := range []string{"→ files", "placed /opt/app/run.sh (0755)", "✓ files (1.2s)", "post.sh | migrated", "WARNING: post-hook failed", "failed after 3s"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output missing %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestReadStreamText(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "[eacd] Placed /a (mode 0644)")
+		fmt.Fprintln(w, "[eacd] STATUS:OK")
+	}))
+	defer srv.Close()
+
+	resp, err := httpPostStream(srv.URL, credentials{token: "t"}, "application/json", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var out bytes.Buffer
+	if err := readStream(resp, &out, "deployment", &serverReport{}); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "[eacd] Placed /a (mode 0644)\n" {
+		t.Errorf("output = %q", out.String())
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	busy := responseError(&http.Response{StatusCode: http.StatusConflict, Body: http.NoBody}, "deployment")
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{nil, 0},
+		{errors.New("boom"), ExitError},
+		{fmt.Errorf("check: %w", ErrDrift), ExitDrift},
+		{busy, ExitBusy},
+		{&RemoteError{Code: api.CodeHook}, ExitHook},
+		{&RemoteError{Code: "unknown"}, ExitError},
+		{&rolloutError{failed: 1, total: 2, first: &RemoteError{Code: api.CodeFiles}}, ExitFiles},
+	}
+	for _, tt := range tests {
+		if got := ExitCode(tt.err); got != tt.want {
+			t.Errorf("ExitCode(%v) = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+}
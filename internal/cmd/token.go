@@ -0,0 +1,279 @@
+package cmd
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/flo-mic/eacd/internal/api"
+	"github.com/flo-mic/eacd/internal/config"
+)
+
+const tokenUsage = "Usage: eacd token rotate [--grace <dur>] | add --name <n> [--scope <s>] [--ttl <dur>] | list | revoke <id|name>"
+
+// Token manages the tokens accepted by the configured server(s).
+func Token(args []string, stdout, stderr io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing subcommand\n%s", tokenUsage)
+	}
+	sub, args := args[0], args[1:]
+
+	fs := flag.NewFlagSet("token "+sub, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	dir := fs.String("dir", ".", "Project directory (default: current directory)")
+	env := fs.String("env", "", "Environment from the 'environments:' block")
+	var grace, ttl *time.Duration
+	var name, scope *string
+	switch sub {
+	case "rotate":
+		grace = fs.Duration("grace", 24*time.Hour, "How long the old token keeps working")
+	case "add":
+		name = fs.String("name", "", "Name of the token, e.g. ci (required)")
+		scope = fs.String("scope", "", "Comma-separated scopes: read, deploy, admin (default: all)")
+		ttl = fs.Duration("ttl", 0, "Token expires after this duration (default: never)")
+	case "list", "revoke":
+	default:
+		return fmt.Errorf("unknown subcommand %q\n%s", sub, tokenUsage)
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	projectDir, cfg, err := loadProject(*dir, *env)
+	if err != nil {
+		return err
+	}
+	creds, err := resolveToken(cfg, stderr)
+	if err != nil {
+		return err
+	}
+	servers := cfg.Targets()
+	for _, server := range servers {
+		if _, err := requireFeatures(server, creds, api.FeatureTokens); err != nil {
+			return err
+		}
+	}
+
+	switch sub {
+	case "rotate":
+		return rotateToken(projectDir, cfg, servers, creds, *grace, stdout)
+	case "add":
+		if *name == "" {
+			return fmt.Errorf("--name is required\n%s", tokenUsage)
+		}
+		req := api.TokenRequest{Name: *name}
+		if *scope != "" {
+			req.Scopes = strings.Split(*scope, ",")
+		}
+		if *ttl > 0 {
+			req.TTL = ttl.String()
+		}
+		return addToken(servers, creds, req, stdout)
+	case "list":
+		return listTokens(servers, creds, stdout)
+	default:
+		if fs.NArg() != 1 {
+			return fmt.Errorf("revoke needs one token ID or name\n%s", tokenUsage)
+		}
+		return revokeToken(servers, creds, fs.Arg(0), stdout)
+	}
+}
+
+// rotateToken replaces the primary token on every server with one new token
+// and stores it where the old one came from: .eacd/config.yaml, in the
+// selected environment's entry, or the environment variable, in which case
+// the new value is printed. It refuses to rotate a token that other
+// environments still use for their servers.
+func rotateToken(projectDir string, cfg *config.ClientConfig, servers []string, creds credentials, grace time.Duration, stdout io.Writer) error {
+	fromEnv := os.Getenv(cfg.TokenEnv) != ""
+	shared, err := tokenSharers(projectDir, cfg, fromEnv)
+	if err != nil {
+		return err
+	}
+	if len(shared) > 0 {
+		source := "the top-level token"
+		if fromEnv {
+			source = cfg.TokenEnv
+		}
+		return fmt.Errorf("%s is also used by %s, whose servers would reject it once the grace period ends; "+
+			"give each environment its own token_env or token and rotate them one by one", source, strings.Join(shared, ", "))
+	}
+
+	next, err := generateToken()
+	if err != nil {
+		return err
+	}
+	body, _ := json.Marshal(api.RotateRequest{Token: next, Grace: grace.String()})
+
+	var expires *time.Time
+	for i, server := range servers {
+		resp, err := httpPost(server+"/admin/tokens/rotate", creds, "application/json", body)
+		if err != nil {
+			return rotateError(servers[:i], next, fmt.Errorf("rotate request to %s: %w", hostLabel(server), err))
+		}
+		var out api.TokenResponse
+		if resp.StatusCode != http.StatusOK {
+			err := responseError(resp, "rotate on "+hostLabel(server))
+			resp.Body.Close()
+			return rotateError(servers[:i], next, err)
+		}
+		if err := decodeJSONResponse(resp, &out); err != nil {
+			return rotateError(servers[:i], next, err)
+		}
+		expires = out.PreviousExpires
+		fmt.Fprintf(stdout, "[eacd] %s: new token %s\n", hostLabel(server), out.Info.ID)
+	}
+	if expires != nil {
+		fmt.Fprintf(stdout, "[eacd] The old token keeps working until %s\n", expires.Local().Format("2006-01-02 15:04:05"))
+	}
+
+	if !fromEnv {
+		if err := config.SetToken(projectDir, cfg.Environment, next); err != nil {
+			return fmt.Errorf("the servers use the new token, but saving it failed: %w\nnew token: %s", err, next)
+		}
+		fmt.Fprintln(stdout, "[eacd] Saved the new token to .eacd/config.yaml")
+		return nil
+	}
+	fmt.Fprintf(stdout, "[eacd] Update %s wherever it is set (e.g. CI secrets):\n", cfg.TokenEnv)
+	fmt.Fprintf(stdout, "export %s=%s\n", cfg.TokenEnv, next)
+	return nil
+}
+
+// tokenSharers returns the other parts of the project config, the top level
+// and environments, that authenticate with the token cfg's comes from: the
+// same variable if fromEnv, otherwise the top-level token, which
+// environments without their own token_env or token inherit. A token saved
+// to an environment's own entry is never shared.
+func tokenSharers(projectDir string, cfg *config.ClientConfig, fromEnv bool) ([]string, error) {
+	if !fromEnv && cfg.Environment != "" {
+		return nil, nil
+	}
+	raw, err := config.LoadClientConfig(projectDir)
+	if err != nil {
+		return nil, err
+	}
+	var shared []string
+	for _, name := range append([]string{""}, raw.EnvironmentNames()...) {
+		if name == cfg.Environment {
+			continue
+		}
+		other, err := raw.ForEnvironment(name)
+		if err != nil {
+			continue // the top level has no servers of its own
+		}
+		label := "environment " + name
+		if name == "" {
+			label = "the top level"
+		}
+		if fromEnv && other.TokenEnv == cfg.TokenEnv {
+			shared = append(shared, label)
+		}
+		if !fromEnv && os.Getenv(other.TokenEnv) == "" && other.Token == cfg.Token {
+			shared = append(shared, label)
+		}
+	}
+	return shared, nil
+}
+
+// rotateError reports a rotation that stopped part way. The servers in done
+// already accept only the new token after the grace period, so it must not
+// be lost.
+func rotateError(done []string, next string, err error) error {
+	if len(done) == 0 {
+		return err
+	}
+	labels := make([]string, len(done))
+	for i, s := range done {
+		labels[i] = hostLabel(s)
+	}
+	return fmt.Errorf("%w\nalready rotated on %s; their new token is %s", err, strings.Join(labels, ", "), next)
+}
+
+func addToken(servers []string, creds credentials, req api.TokenRequest, stdout io.Writer) error {
+	body, _ := json.Marshal(req)
+	for _, server := range servers {
+		resp, err := httpPost(server+"/admin/tokens", creds, "application/json", body)
+		if err != nil {
+			return fmt.Errorf("token request: %w", err)
+		}
+		var out api.TokenResponse
+		if err := decodeJSONResponse(resp, &out); err != nil {
+			return fmt.Errorf("adding token on %s: %w", hostLabel(server), err)
+		}
+		if len(servers) > 1 {
+			fmt.Fprintf(stdout, "%s\t%s\t%s\n", hostLabel(server), out.Info.ID, out.Token)
+		} else {
+			fmt.Fprintln(stdout, out.Token)
+		}
+	}
+	return nil
+}
+
+func listTokens(servers []string, creds credentials, stdout io.Writer) error {
+	for i, server := range servers {
+		resp, err := httpGet(server+"/admin/tokens", creds)
+		if err != nil {
+			return fmt.Errorf("token request: %w", err)
+		}
+		var out api.TokensResponse
+		if err := decodeJSONResponse(resp, &out); err != nil {
+			return fmt.Errorf("listing tokens on %s: %w", hostLabel(server), err)
+		}
+		if len(servers) > 1 {
+			if i > 0 {
+				fmt.Fprintln(stdout)
+			}
+			fmt.Fprintf(stdout, "[eacd] %s\n", hostLabel(server))
+		}
+		tw := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tNAME\tSCOPES\tEXPIRES")
+		for _, t := range out.Tokens {
+			scopes := "all"
+			if len(t.Scopes) > 0 {
+				scopes = strings.Join(t.Scopes, ",")
+			}
+			expires := "never"
+			if t.Expires != nil {
+				expires = t.Expires.Local().Format("2006-01-02 15:04")
+			}
+			name := t.Name
+			if t.Primary {
+				name += " (primary)"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", t.ID, name, scopes, expires)
+		}
+		tw.Flush()
+	}
+	return nil
+}
+
+func revokeToken(servers []string, creds credentials, key string, stdout io.Writer) error {
+	for _, server := range servers {
+		req, err := http.NewRequest(http.MethodDelete, server+"/admin/tokens/"+url.PathEscape(key), nil)
+		if err != nil {
+			return err
+		}
+		if err := authorize(req, creds, nil); err != nil {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return fmt.Errorf("token request: %w", err)
+		}
+		if resp.StatusCode != http.StatusNoContent {
+			err := responseError(resp, "revoke on "+hostLabel(server))
+			resp.Body.Close()
+			return err
+		}
+		resp.Body.Close()
+		fmt.Fprintf(stdout, "[eacd] %s: revoked %s\n", hostLabel(server), key)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flo-mic/eacd/internal/api"
+)
+
+func TestTokenRotate(t *testing.T) {
+	var got api.RotateRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/version":
+			json.NewEncoder(w).Encode(api.VersionResponse{Protocol: api.ProtocolVersion, MinProtocol: api.MinProtocolVersion, Features: api.Features})
+		case "/admin/tokens/rotate":
+			if r.Header.Get("Authorization") != "Bearer old-token" {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			json.NewDecoder(r.Body).Decode(&got)
+			exp := time.Now().Add(time.Hour)
+			json.NewEncoder(w).Encode(api.TokenResponse{Token: got.Token, Info: api.TokenInfo{ID: "token:12345678"}, PreviousExpires: &exp})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, ".eacd"), 0755)
+	cfgPath := filepath.Join(dir, ".eacd", "config.yaml")
+	os.WriteFile(cfgPath, []byte("name: app\nserver: "+srv.URL+"\ntoken: old-token\ntoken_env: EACD_TEST_TOKEN\ndeploy:\n  mappings:\n    - src: dist\n      dest: /var/www/app\n"), 0644)
+	t.Setenv("EACD_TEST_TOKEN", "")
+
+	var stdout, stderr bytes.Buffer
+	if err := Token([]string{"rotate", "--dir", dir, "--grace", "1h"}, &stdout, &stderr); err != nil {
+		t.Fatal(err)
+	}
+	if got.Grace != "1h0m0s" || len(got.Token) < 32 {
+		t.Errorf("request = %+v", got)
+	}
+	data, _ := os.ReadFile(cfgPath)
+	if !strings.Contains(string(data), "token: "+got.Token) {
+		t.Errorf("config not updated:\n%s", data)
+	}
+
+	// With the token in the environment, the new one is printed instead.
+	os.WriteFile(cfgPath, bytes.Replace(data, []byte(got.Token), []byte("old-token"), 1), 0644)
+	t.Setenv("EACD_TEST_TOKEN", "old-token")
+	stdout.Reset()
+	if err := Token([]string{"rotate", "--dir", dir}, &stdout, &stderr); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(stdout.String(), "export EACD_TEST_TOKEN="+got.Token) {
+		t.Errorf("new token not printed:\n%s", stdout.String())
+	}
+	data, _ = os.ReadFile(cfgPath)
+	if !strings.Contains(string(data), "token: old-token") {
+		t.Errorf("config changed although the token came from the environment:\n%s", data)
+	}
+}
+
+func TestTokenRotateShared(t *testing.T) {
+	rotated := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/version":
+			json.NewEncoder(w).Encode(api.VersionResponse{Protocol: api.ProtocolVersion, MinProtocol: api.MinProtocolVersion, Features: api.Features})
+		case "/admin/tokens/rotate":
+			rotated = true
+			var req api.RotateRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			json.NewEncoder(w).Encode(api.TokenResponse{Token: req.Token, Info: api.TokenInfo{ID: "token:12345678"}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, ".eacd"), 0755)
+	cfgPath := filepath.Join(dir, ".eacd", "config.yaml")
+	os.WriteFile(cfgPath, []byte("name: app\ntoken: old-token\ntoken_env: EACD_TEST_TOKEN\n"+
+		"environments:\n  staging:\n    server: "+srv.URL+"\n  prod:\n    server: "+srv.URL+"\n"+
+		"deploy:\n  mappings:\n    - src: dist\n      dest: /var/www/app\n"), 0644)
+
+	// A shared variable is refused before any server is touched.
+	t.Setenv("EACD_TEST_TOKEN", "old-token")
+	var stdout, stderr bytes.Buffer
+	err := Token([]string{"rotate", "--dir", dir, "--env", "staging"}, &stdout, &stderr)
+	if err == nil || !strings.Contains(err.Error(), "environment prod") {
+		t.Fatalf("err = %v, want a refusal naming prod", err)
+	}
+	if rotated {
+		t.Error("token rotated although it is shared")
+	}
+
+	// A config token inherited by staging is saved to staging's own entry.
+	t.Setenv("EACD_TEST_TOKEN", "")
+	if err := Token([]string{"rotate", "--dir", dir, "--env", "staging"}, &stdout, &stderr); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(cfgPath)
+	if !strings.Contains(string(data), "token: old-token") || strings.Count(string(data), "token: ") != 2 {
+		t.Errorf("new token not saved to staging:\n%s", data)
+	}
+}
@@ -0,0 +1,161 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"debug/elf"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/flo-mic/eacd/internal/api"
+)
+
+// upgradePoll is how often upgrade-daemon asks for the upgrade state.
+var upgradePoll = time.Second
+
+// UpgradeDaemon replaces eacdd on the configured servers, one at a time,
+// with a local binary and waits until each runs the new version.
+func UpgradeDaemon(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("upgrade-daemon", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	dir := fs.String("dir", ".", "Project directory (default: current directory)")
+	env := fs.String("env", "", "Environment from the 'environments:' block")
+	binary := fs.String("binary", "", "New eacdd binary, e.g. dist/eacdd-linux-amd64 (required)")
+	sigPath := fs.String("signature", "", "File with the base64 ed25519 signature of the binary")
+	timeout := fs.Duration("timeout", 60*time.Second, "How long to wait for each daemon to come back")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *binary == "" {
+		return fmt.Errorf("--binary is required\nUsage: eacd upgrade-daemon --binary <eacdd> [--signature <file>] [--env <name>]")
+	}
+
+	data, err := os.ReadFile(*binary)
+	if err != nil {
+		return err
+	}
+	arch, err := binaryArch(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", *binary, err)
+	}
+	var signature string
+	if *sigPath != "" {
+		sig, err := os.ReadFile(*sigPath)
+		if err != nil {
+			return err
+		}
+		signature = strings.TrimSpace(string(sig))
+	}
+	sum := sha256.Sum256(data)
+	checksum := hex.EncodeToString(sum[:])
+
+	_, cfg, err := loadProject(*dir, *env)
+	if err != nil {
+		return err
+	}
+	creds, err := resolveToken(cfg, stderr)
+	if err != nil {
+		return err
+	}
+
+	for _, server := range cfg.Targets() {
+		v, err := requireFeatures(server, creds, api.FeatureUpgrade)
+		if err != nil {
+			return err
+		}
+		if v.OS != "linux" || v.Arch != arch {
+			return fmt.Errorf("%s runs %s/%s, but %s is a linux/%s binary", hostLabel(server), v.OS, v.Arch, *binary, arch)
+		}
+		if err := upgradeOne(server, creds, data, checksum, signature, *timeout, stdout); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// upgradeOne uploads the binary to server and waits for the outcome.
+func upgradeOne(server string, creds credentials, data []byte, checksum, signature string, timeout time.Duration, stdout io.Writer) error {
+	req, err := http.NewRequest(http.MethodPost, server+"/admin/upgrade", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	if err := authorize(req, creds, data); err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("X-Eacd-Sha256", checksum)
+	if signature != "" {
+		req.Header.Set("X-Eacd-Signature", signature)
+	}
+	fmt.Fprintf(stdout, "[eacd] Uploading eacdd to %s (%d bytes)\n", hostLabel(server), len(data))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("upgrade request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return responseError(resp, "upgrade of "+hostLabel(server))
+	}
+	var started api.UpgradeResponse
+	if err := json.NewDecoder(resp.Body).Decode(&started); err != nil {
+		return fmt.Errorf("parsing upgrade response: %w", err)
+	}
+	fmt.Fprintf(stdout, "[eacd] %s: installed %s (was %s), restarting\n", hostLabel(server), started.To, started.From)
+
+	status, err := waitUpgrade(server, creds, started.To, timeout)
+	if err != nil {
+		return fmt.Errorf("%s: %w", hostLabel(server), err)
+	}
+	if status.State != "ok" {
+		return fmt.Errorf("%s: upgrade to %s rolled back, still running %s: %s", hostLabel(server), status.To, status.From, status.Error)
+	}
+	fmt.Fprintf(stdout, "[eacd] %s: eacdd %s is running\n", hostLabel(server), status.To)
+	return nil
+}
+
+// waitUpgrade polls GET /admin/upgrade until the upgrade to version to is no
+// longer pending. Errors while the daemon restarts are expected and ignored.
+func waitUpgrade(server string, creds credentials, to string, timeout time.Duration) (*api.UpgradeStatus, error) {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		time.Sleep(upgradePoll)
+		resp, err := httpGet(server+"/admin/upgrade", creds)
+		if err != nil {
+			continue
+		}
+		var status api.UpgradeStatus
+		if err := decodeJSONResponse(resp, &status); err != nil {
+			continue
+		}
+		if status.To == to && status.State != "pending" {
+			return &status, nil
+		}
+	}
+	return nil, fmt.Errorf("no result of the upgrade to %s after %s", to, timeout)
+}
+
+// binaryArch returns the GOARCH of a Linux ELF binary.
+func binaryArch(data []byte) (string, error) {
+	f, err := elf.NewFile(bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("not a Linux binary: %w", err)
+	}
+	switch f.Machine {
+	case elf.EM_X86_64:
+		return "amd64", nil
+	case elf.EM_AARCH64:
+		return "arm64", nil
+	case elf.EM_386:
+		return "386", nil
+	case elf.EM_ARM:
+		return "arm", nil
+	}
+	return "", fmt.Errorf("unsupported machine %s", f.Machine)
+}
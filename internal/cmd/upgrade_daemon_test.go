@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flo-mic/eacd/internal/api"
+)
+
+func TestBinaryArch(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("test binary is not ELF")
+	}
+	exe, _ := os.Executable()
+	data, _ := os.ReadFile(exe)
+	if arch, err := binaryArch(data); err != nil || arch != runtime.GOARCH {
+		t.Errorf("binaryArch = %q, %v", arch, err)
+	}
+	if _, err := binaryArch([]byte("#!/bin/sh\n")); err == nil {
+		t.Error("script accepted as binary")
+	}
+}
+
+func TestUpgradeOne(t *testing.T) {
+	upgradePoll = time.Millisecond
+	defer func() { upgradePoll = time.Second }()
+
+	for _, state := range []string{"ok", "rolled_back"} {
+		var gotSum string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodPost {
+				gotSum = r.Header.Get("X-Eacd-Sha256")
+				w.WriteHeader(http.StatusAccepted)
+				json.NewEncoder(w).Encode(api.UpgradeResponse{From: "v1", To: "v2"})
+				return
+			}
+			json.NewEncoder(w).Encode(api.UpgradeStatus{State: state, From: "v1", To: "v2", Error: "did not come up"})
+		}))
+
+		var out bytes.Buffer
+		err := upgradeOne(srv.URL, credentials{token: "t"}, []byte("bin"), "abc", "", time.Second, &out)
+		srv.Close()
+		if gotSum != "abc" {
+			t.Errorf("checksum header = %q", gotSum)
+		}
+		if state == "ok" && err != nil {
+			t.Errorf("ok: %v", err)
+		}
+		if state == "rolled_back" && (err == nil || !strings.Contains(err.Error(), "rolled back")) {
+			t.Errorf("rolled_back: got %v", err)
+		}
+	}
+}
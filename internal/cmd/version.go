@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/flo-mic/eacd/internal/api"
+	"github.com/flo-mic/eacd/internal/auth"
+	"github.com/flo-mic/eacd/internal/version"
+)
+
+// CodeIncompatible is the RemoteError code for a daemon that does not speak
+// a compatible protocol version or lacks a required feature.
+const CodeIncompatible = "incompatible"
+
+// legacyDaemon describes a daemon without GET /version. It predates every
+// feature: it only serves /check, /deploy, /rollback and /health.
+func legacyDaemon() *api.VersionResponse {
+	return &api.VersionResponse{Version: "unknown", Protocol: 1, MinProtocol: 1}
+}
+
+var (
+	daemonMu    sync.Mutex
+	daemonInfos = map[string]*api.VersionResponse{}
+)
+
+// daemonInfo returns the /version response of server, fetched once per
+// process, and fails if its protocol is incompatible with this client.
+func daemonInfo(server string, creds credentials) (*api.VersionResponse, error) {
+	daemonMu.Lock()
+	defer daemonMu.Unlock()
+	if v, ok := daemonInfos[server]; ok {
+		return v, nil
+	}
+
+	resp, err := httpGet(server+"/version", creds)
+	if err != nil {
+		return nil, fmt.Errorf("version request: %w", err)
+	}
+	var v api.VersionResponse
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		v = *legacyDaemon()
+	} else if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		err := responseError(resp, "version request to "+hostLabel(server))
+		if resp.StatusCode == http.StatusUnauthorized && creds.sign {
+			err = fmt.Errorf("%w (auth: hmac needs an eacdd that supports signed requests, and both clocks within %s)", err, auth.MaxSkew)
+		}
+		return nil, err
+	} else if err := decodeJSONResponse(resp, &v); err != nil {
+		return nil, fmt.Errorf("version request to %s: %w", server, err)
+	}
+
+	if err := checkProtocol(server, &v); err != nil {
+		return nil, err
+	}
+	daemonInfos[server] = &v
+	return &v, nil
+}
+
+// checkProtocol fails if the daemon v on server speaks a protocol this
+// client cannot talk to.
+func checkProtocol(server string, v *api.VersionResponse) error {
+	if v.Protocol < api.MinProtocolVersion {
+		return &RemoteError{Code: CodeIncompatible, Message: fmt.Sprintf(
+			"eacdd %s on %s speaks protocol %d, but this eacd needs at least %d — upgrade the daemon",
+			v.Version, hostLabel(server), v.Protocol, api.MinProtocolVersion)}
+	}
+	if v.MinProtocol > api.ProtocolVersion {
+		return &RemoteError{Code: CodeIncompatible, Message: fmt.Sprintf(
+			"eacdd %s on %s needs protocol %d or newer, but eacd %s speaks %d — upgrade eacd",
+			v.Version, hostLabel(server), v.MinProtocol, version.String(), api.ProtocolVersion)}
+	}
+	return nil
+}
+
+// requireFeatures checks that server speaks a compatible protocol and
+// advertises all features.
+func requireFeatures(server string, creds credentials, features ...string) (*api.VersionResponse, error) {
+	v, err := daemonInfo(server, creds)
+	if err != nil {
+		return nil, err
+	}
+	var missing []string
+	for _, f := range features {
+		if !v.HasFeature(f) {
+			missing = append(missing, f)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, &RemoteError{Code: CodeIncompatible, Message: fmt.Sprintf(
+			"eacdd %s on %s does not support %s — upgrade the daemon",
+			v.Version, hostLabel(server), strings.Join(missing, ", "))}
+	}
+	return v, nil
+}
+
+// Version prints the client version and, inside a project, the version of
+// every daemon it deploys to.
+func Version(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("version", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	dir := fs.String("dir", ".", "Project directory (default: current directory)")
+	env := fs.String("env", "", "Environment from the 'environments:' block")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(stdout, "eacd %s (protocol %d)\n", version.String(), api.ProtocolVersion)
+
+	_, cfg, err := loadProject(*dir, *env)
+	if err != nil {
+		return nil // outside a project there are no daemons to ask
+	}
+	creds, err := resolveToken(cfg, stderr)
+	if err != nil {
+		return err
+	}
+	var failed error
+	for _, server := range cfg.Targets() {
+		v, err := daemonInfo(server, creds)
+		if err != nil {
+			fmt.Fprintf(stdout, "%s: %v\n", hostLabel(server), err)
+			failed = err
+			continue
+		}
+		fmt.Fprintf(stdout, "%s: eacdd %s (protocol %d, %s/%s) features: %s\n",
+			hostLabel(server), v.Version, v.Protocol, v.OS, v.Arch, strings.Join(v.Features, ", "))
+	}
+	return failed
+}
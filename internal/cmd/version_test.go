@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/flo-mic/eacd/internal/api"
+	"github.com/flo-mic/eacd/internal/auth"
+)
+
+func versionServer(v *api.VersionResponse) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/version" || v == nil {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(v)
+	}))
+}
+
+// withVersion serves GET /version like a current eacdd and passes every
+// other request to h.
+func withVersion(h http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/version" {
+			json.NewEncoder(w).Encode(api.VersionResponse{Version: "v1.0.0", Protocol: api.ProtocolVersion, MinProtocol: api.MinProtocolVersion, Features: api.Features})
+			return
+		}
+		h(w, r)
+	})
+}
+
+func TestRequireFeatures(t *testing.T) {
+	current := versionServer(&api.VersionResponse{Version: "v1.0.0", Protocol: api.ProtocolVersion, MinProtocol: api.MinProtocolVersion, Features: []string{api.FeatureLogs}})
+	defer current.Close()
+	if _, err := requireFeatures(current.URL, credentials{token: "t"}, api.FeatureLogs); err != nil {
+		t.Errorf("advertised feature rejected: %v", err)
+	}
+	_, err := requireFeatures(current.URL, credentials{token: "t"}, api.FeatureDrift)
+	if ExitCode(err) != ExitIncompatible || !strings.Contains(err.Error(), "does not support drift") {
+		t.Errorf("missing feature: got %v", err)
+	}
+
+	legacy := versionServer(nil)
+	defer legacy.Close()
+	if _, err := requireFeatures(legacy.URL, credentials{token: "t"}); err != nil {
+		t.Errorf("daemon without /version rejected for a command without features: %v", err)
+	}
+	for _, f := range []string{api.FeatureSecrets, api.FeatureDrift} {
+		_, err := requireFeatures(legacy.URL, credentials{token: "t"}, f)
+		if ExitCode(err) != ExitIncompatible || !strings.Contains(err.Error(), "does not support "+f) {
+			t.Errorf("daemon without /version and %s: got %v", f, err)
+		}
+	}
+}
+
+func TestDaemonInfoIncompatible(t *testing.T) {
+	tooNew := versionServer(&api.VersionResponse{Version: "v9.0.0", Protocol: api.ProtocolVersion + 5, MinProtocol: api.ProtocolVersion + 1})
+	defer tooNew.Close()
+	_, err := daemonInfo(tooNew.URL, credentials{token: "t"})
+	var re *RemoteError
+	if !errors.As(err, &re) || re.Code != CodeIncompatible || !strings.Contains(err.Error(), "upgrade eacd") {
+		t.Errorf("newer daemon: got %v", err)
+	}
+
+	tooOld := versionServer(&api.VersionResponse{Version: "v0.1.0", Protocol: api.MinProtocolVersion - 1})
+	defer tooOld.Close()
+	if _, err := daemonInfo(tooOld.URL, credentials{token: "t"}); err == nil || !strings.Contains(err.Error(), "upgrade the daemon") {
+		t.Errorf("older daemon: got %v", err)
+	}
+}
+
+func TestSignedClientRequests(t *testing.T) {
+	store := auth.NewStore([]auth.Token{{Secret: "secret"}})
+	store.RequireSigned.Store(true)
+	srv := httptest.NewServer(store.Middleware("", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(api.VersionResponse{Protocol: api.ProtocolVersion, MinProtocol: api.MinProtocolVersion})
+	})))
+	defer srv.Close()
+
+	dir := writeProject(t, srv.URL)
+	cfgPath := filepath.Join(dir, ".eacd", "config.yaml")
+	data, _ := os.ReadFile(cfgPath)
+	os.WriteFile(cfgPath, append(data, "auth: hmac\n"...), 0644)
+	_, cfg, err := loadProject(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	creds, err := resolveToken(cfg, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := daemonInfo(srv.URL, creds); err != nil {
+		t.Errorf("signed request rejected: %v", err)
+	}
+	resp, err := httpGet(srv.URL+"/version", credentials{token: creds.token})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("unsigned request: status %d", resp.StatusCode)
+	}
+}
@@ -3,17 +3,76 @@ package config
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
+// DefaultTokenEnv is the environment variable the client reads the auth token from
+// unless token_env says otherwise.
+const DefaultTokenEnv = "EACD_TOKEN"
+
+// DefaultInventory is the inventory file used when 'inventory' is not set.
+const DefaultInventory = ".eacd/inventory.yaml"
+
 // ClientConfig is loaded from .eacd/config.yaml in the project root.
 type ClientConfig struct {
-	Name   string       `yaml:"name"`
-	Server string       `yaml:"server"`
-	Token  string       `yaml:"token"`
-	Deploy DeployConfig `yaml:"deploy"`
-	Hooks  ClientHooks  `yaml:"hooks"`
+	Name            string                 `yaml:"name"`
+	Server          string                 `yaml:"server"`
+	Servers         []string               `yaml:"servers"` // fan-out targets, used instead of server
+	Rollout         *RolloutConfig         `yaml:"rollout"`
+	Token           string                 `yaml:"token"`
+	TokenEnv        string                 `yaml:"token_env"`   // env var holding the token, default EACD_TOKEN
+	Auth            string                 `yaml:"auth"`        // "bearer" (default) or "hmac": sign requests instead of sending the token
+	SigningKey      string                 `yaml:"signing_key"` // ed25519 key for signing manifests, see eacd keygen
+	Inventory       string                 `yaml:"inventory"`   // inventory file relative to project root
+	Deploy          DeployConfig           `yaml:"deploy"`
+	Hooks           ClientHooks            `yaml:"hooks"`
+	Vars            map[string]string      `yaml:"vars"`              // template data, see Mapping.Template
+	RequireCleanGit bool                   `yaml:"require_clean_git"` // refuse to deploy uncommitted changes
+	RefuseDrift     bool                   `yaml:"refuse_drift"`      // refuse to deploy over drifted servers
+	Webhooks        []WebhookConfig        `yaml:"webhooks"`          // notified by the daemon of deploys and rollbacks
+	Environments    map[string]Environment `yaml:"environments"`
+
+	// Environment is the name selected via ForEnvironment; empty for top level.
+	Environment string `yaml:"-"`
+}
+
+// Environment overrides top-level settings for one deploy target, e.g. staging or prod.
+// Empty fields inherit the top-level value.
+type Environment struct {
+	Server     string            `yaml:"server"`
+	Servers    []string          `yaml:"servers"`
+	Rollout    *RolloutConfig    `yaml:"rollout"`
+	Token      string            `yaml:"token"`
+	TokenEnv   string            `yaml:"token_env"`
+	Auth       string            `yaml:"auth"`
+	SigningKey string            `yaml:"signing_key"`
+	Inventory  string            `yaml:"inventory"`
+	Deploy     DeployConfig      `yaml:"deploy"`
+	Hooks      ClientHooks       `yaml:"hooks"`
+	Vars       map[string]string `yaml:"vars"`     // merged over the top-level vars
+	Webhooks   []WebhookConfig   `yaml:"webhooks"` // replace the top-level webhooks
+
+	RequireCleanGit bool `yaml:"require_clean_git"` // enables the check for this environment
+	RefuseDrift     bool `yaml:"refuse_drift"`      // enables the check for this environment
+}
+
+// Rollout strategies for configs with several servers.
+const (
+	StrategyParallel = "parallel"
+	StrategyRolling  = "rolling"
+)
+
+// RolloutConfig controls how a deploy fans out to several servers.
+type RolloutConfig struct {
+	Strategy      string        `yaml:"strategy"`       // "parallel" (default) or "rolling"
+	BatchSize     int           `yaml:"batch_size"`     // servers per batch for "rolling", default 1
+	HealthCheck   string        `yaml:"health_check"`   // URL polled after each deploy; {host} is replaced by the server host
+	HealthTimeout time.Duration `yaml:"health_timeout"` // how long to wait for the health check, default 30s
 }
 
 // DeployConfig describes what to deploy and where.
@@ -26,9 +85,30 @@ type DeployConfig struct {
 type Mapping struct {
 	Src     string   `yaml:"src"`
 	Dest    string   `yaml:"dest"`
-	Mode    string   `yaml:"mode"`     // file mode, e.g. "0644"
+	Mode    string   `yaml:"mode"`     // file mode, e.g. "0644"; empty picks the default at deploy time
 	DirMode string   `yaml:"dir_mode"` // directory mode, e.g. "0755"
 	Exclude []string `yaml:"exclude"`  // glob/prefix patterns to skip
+
+	// Template renders every file of the mapping with text/template before
+	// hashing; Templates limits rendering to files matching these patterns.
+	Template  bool     `yaml:"template"`
+	Templates []string `yaml:"templates"`
+}
+
+// IsTemplate reports whether the file at rel (relative to Src) is rendered.
+func (m Mapping) IsTemplate(rel string) bool {
+	if m.Template {
+		return true
+	}
+	for _, pattern := range m.Templates {
+		if ok, _ := filepath.Match(pattern, rel); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(pattern, filepath.Base(rel)); ok {
+			return true
+		}
+	}
+	return false
 }
 
 // SystemdSpec describes an optional systemd unit to deploy.
@@ -61,22 +141,307 @@ func LoadClientConfig(projectDir string) (*ClientConfig, error) {
 	if cfg.Name == "" {
 		return nil, fmt.Errorf("%s: 'name' is required", path)
 	}
-	if cfg.Server == "" {
-		return nil, fmt.Errorf("%s: 'server' is required", path)
+
+	if err := validateAuth(cfg.Auth); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
 	}
-	if len(cfg.Deploy.Mappings) == 0 {
-		return nil, fmt.Errorf("%s: at least one deploy.mapping is required", path)
+	for name, env := range cfg.Environments {
+		if err := validateAuth(env.Auth); err != nil {
+			return nil, fmt.Errorf("%s: environment %q: %w", path, name, err)
+		}
+	}
+
+	// Without environments the top level must be deployable on its own.
+	// With environments, every environment must be deployable after merging.
+	if len(cfg.Environments) == 0 {
+		if err := cfg.validateTarget(); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	for _, name := range cfg.EnvironmentNames() {
+		env, _ := cfg.ForEnvironment(name)
+		if err := env.validateTarget(); err != nil {
+			return nil, fmt.Errorf("%s: environment %q: %w", path, name, err)
+		}
 	}
 
 	// Apply defaults
-	for i := range cfg.Deploy.Mappings {
-		if cfg.Deploy.Mappings[i].Mode == "" {
-			cfg.Deploy.Mappings[i].Mode = "0644"
+	applyMappingDefaults(cfg.Deploy.Mappings)
+	for name, env := range cfg.Environments {
+		applyMappingDefaults(env.Deploy.Mappings)
+		cfg.Environments[name] = env
+	}
+	if cfg.TokenEnv == "" {
+		cfg.TokenEnv = DefaultTokenEnv
+	}
+	if cfg.Inventory == "" {
+		cfg.Inventory = DefaultInventory
+	}
+	if err := applyRolloutDefaults(cfg.Rollout); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for name, env := range cfg.Environments {
+		if err := applyRolloutDefaults(env.Rollout); err != nil {
+			return nil, fmt.Errorf("%s: environment %q: %w", path, name, err)
 		}
-		if cfg.Deploy.Mappings[i].DirMode == "" {
-			cfg.Deploy.Mappings[i].DirMode = "0755"
+	}
+	if err := applyWebhookDefaults(cfg.Webhooks); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for name, env := range cfg.Environments {
+		if err := applyWebhookDefaults(env.Webhooks); err != nil {
+			return nil, fmt.Errorf("%s: environment %q: %w", path, name, err)
 		}
 	}
 
 	return &cfg, nil
 }
+
+// Auth modes of the client config's auth: setting.
+const (
+	AuthBearer = "bearer" // send the token as Bearer token
+	AuthHMAC   = "hmac"   // sign each request with the token, see auth.SchemeHMAC
+)
+
+func validateAuth(mode string) error {
+	switch mode {
+	case "", AuthBearer, AuthHMAC:
+		return nil
+	}
+	return fmt.Errorf("auth: unknown mode %q (use bearer or hmac)", mode)
+}
+
+// EnvironmentNames returns the configured environment names in sorted order.
+func (c *ClientConfig) EnvironmentNames() []string {
+	names := make([]string, 0, len(c.Environments))
+	for name := range c.Environments {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ForEnvironment returns a copy of the config with the named environment's
+// overrides applied. An empty name selects the top-level settings, which is
+// only valid if they define a server and mappings on their own.
+func (c *ClientConfig) ForEnvironment(name string) (*ClientConfig, error) {
+	out := *c
+	out.Environments = nil
+	out.Environment = name
+
+	if name == "" {
+		if len(c.Environments) > 0 && out.validateTarget() != nil {
+			return nil, fmt.Errorf("no environment selected; use --env with one of: %s", strings.Join(c.EnvironmentNames(), ", "))
+		}
+		return &out, nil
+	}
+
+	env, ok := c.Environments[name]
+	if !ok {
+		if len(c.Environments) == 0 {
+			return nil, fmt.Errorf("unknown environment %q: no environments are configured", name)
+		}
+		return nil, fmt.Errorf("unknown environment %q (available: %s)", name, strings.Join(c.EnvironmentNames(), ", "))
+	}
+
+	if env.Server != "" {
+		out.Server = env.Server
+		out.Servers = nil
+	}
+	if len(env.Servers) > 0 {
+		out.Servers = env.Servers
+		out.Server = ""
+	}
+	if env.Rollout != nil {
+		out.Rollout = env.Rollout
+	}
+	if env.TokenEnv != "" {
+		// The top-level token belongs to the top-level token_env; an
+		// environment with its own variable must not fall back to it.
+		out.TokenEnv = env.TokenEnv
+		out.Token = ""
+	}
+	if env.Token != "" {
+		out.Token = env.Token
+	}
+	if env.Auth != "" {
+		out.Auth = env.Auth
+	}
+	if env.SigningKey != "" {
+		out.SigningKey = env.SigningKey
+	}
+	if env.Inventory != "" {
+		out.Inventory = env.Inventory
+	}
+	if len(env.Deploy.Mappings) > 0 {
+		out.Deploy.Mappings = env.Deploy.Mappings
+	}
+	if env.Deploy.Systemd != nil {
+		out.Deploy.Systemd = env.Deploy.Systemd
+	}
+	if env.Hooks.LocalPre != "" {
+		out.Hooks.LocalPre = env.Hooks.LocalPre
+	}
+	if env.Hooks.ServerPre != "" {
+		out.Hooks.ServerPre = env.Hooks.ServerPre
+	}
+	if env.Hooks.ServerPost != "" {
+		out.Hooks.ServerPost = env.Hooks.ServerPost
+	}
+	if env.RequireCleanGit {
+		out.RequireCleanGit = true
+	}
+	if env.RefuseDrift {
+		out.RefuseDrift = true
+	}
+	if len(env.Webhooks) > 0 {
+		out.Webhooks = env.Webhooks
+	}
+	if len(env.Vars) > 0 {
+		out.Vars = make(map[string]string, len(c.Vars)+len(env.Vars))
+		for k, v := range c.Vars {
+			out.Vars[k] = v
+		}
+		for k, v := range env.Vars {
+			out.Vars[k] = v
+		}
+	}
+	return &out, nil
+}
+
+// Targets returns the server URLs a deploy goes to: the servers list if set,
+// otherwise the single server.
+func (c *ClientConfig) Targets() []string {
+	if len(c.Servers) > 0 {
+		return c.Servers
+	}
+	if c.Server == "" {
+		return nil
+	}
+	return []string{c.Server}
+}
+
+// validateTarget checks the fields a deploy target cannot do without.
+func (c *ClientConfig) validateTarget() error {
+	if c.Server == "" && len(c.Servers) == 0 {
+		return fmt.Errorf("'server' or 'servers' is required")
+	}
+	if len(c.Deploy.Mappings) == 0 {
+		return fmt.Errorf("at least one deploy.mapping is required")
+	}
+	return nil
+}
+
+func applyRolloutDefaults(r *RolloutConfig) error {
+	if r == nil {
+		return nil
+	}
+	switch r.Strategy {
+	case "":
+		r.Strategy = StrategyParallel
+	case StrategyParallel, StrategyRolling:
+	default:
+		return fmt.Errorf("rollout.strategy must be %q or %q, got %q", StrategyParallel, StrategyRolling, r.Strategy)
+	}
+	if r.BatchSize <= 0 {
+		r.BatchSize = 1
+	}
+	if r.HealthTimeout <= 0 {
+		r.HealthTimeout = 30 * time.Second
+	}
+	return nil
+}
+
+// applyMappingDefaults fills in DirMode. Mode stays empty if unset: the
+// plan picks 0644, or 0600 for templates that render secrets.
+func applyMappingDefaults(mappings []Mapping) {
+	for i := range mappings {
+		if mappings[i].DirMode == "" {
+			mappings[i].DirMode = "0755"
+		}
+	}
+}
+
+// SetToken stores token in the config.yaml of projectDir: in the environment's
+// entry if one is given, even if it inherited the top-level token so far,
+// since other environments may still use that one. Otherwise it is stored at
+// the top level. The file is written atomically; other settings and comments
+// are kept.
+func SetToken(projectDir, environment, token string) error {
+	path := filepath.Join(projectDir, ".eacd", "config.yaml")
+	doc, err := readYAML(path)
+	if err != nil {
+		return err
+	}
+	target := doc.Content[0]
+	if environment != "" {
+		envs := mappingValue(target, "environments")
+		if envs == nil || envs.Kind != yaml.MappingNode {
+			return fmt.Errorf("%s: no environments block", path)
+		}
+		env := mappingValue(envs, environment)
+		if env == nil || env.Kind != yaml.MappingNode {
+			return fmt.Errorf("%s: environment %q is not a mapping", path, environment)
+		}
+		target = env
+	}
+	setMappingKey(target, "token", &yaml.Node{Kind: yaml.ScalarNode, Value: token})
+	return writeYAML(path, doc)
+}
+
+// AddEnvironment adds name to the environments: block of the config.yaml of
+// projectDir, creating the block if needed. A non-empty dest overrides the
+// destination of the first top-level mapping, so the environment keeps
+// deploying the same files. Other settings and comments are kept.
+func AddEnvironment(projectDir, name, server, tokenEnv, dest string) error {
+	path := filepath.Join(projectDir, ".eacd", "config.yaml")
+	doc, err := readYAML(path)
+	if err != nil {
+		return err
+	}
+	root := doc.Content[0]
+
+	envs := mappingValue(root, "environments")
+	if envs == nil || envs.Kind == yaml.ScalarNode && envs.Tag == "!!null" {
+		envs = &yaml.Node{Kind: yaml.MappingNode}
+		setMappingKey(root, "environments", envs)
+	}
+	if envs.Kind != yaml.MappingNode {
+		return fmt.Errorf("%s: 'environments' is not a mapping", path)
+	}
+	if mappingValue(envs, name) != nil {
+		return fmt.Errorf("environment %q already exists in .eacd/config.yaml", name)
+	}
+
+	env := &yaml.Node{Kind: yaml.MappingNode}
+	setMappingKey(env, "server", &yaml.Node{Kind: yaml.ScalarNode, Value: server})
+	setMappingKey(env, "token_env", &yaml.Node{Kind: yaml.ScalarNode, Value: tokenEnv})
+	if dest != "" {
+		mapping := &yaml.Node{Kind: yaml.MappingNode}
+		if first := firstMapping(root); first != nil {
+			mapping.Content = append(mapping.Content, first.Content...)
+		}
+		if mappingValue(mapping, "src") == nil {
+			setMappingKey(mapping, "src", &yaml.Node{Kind: yaml.ScalarNode, Value: "./"})
+		}
+		setMappingKey(mapping, "dest", &yaml.Node{Kind: yaml.ScalarNode, Value: dest})
+		deploy := &yaml.Node{Kind: yaml.MappingNode}
+		setMappingKey(deploy, "mappings", &yaml.Node{Kind: yaml.SequenceNode, Content: []*yaml.Node{mapping}})
+		setMappingKey(env, "deploy", deploy)
+	}
+	setMappingKey(envs, name, env)
+	return writeYAML(path, doc)
+}
+
+// firstMapping returns the first entry of the top-level deploy.mappings, or nil.
+func firstMapping(root *yaml.Node) *yaml.Node {
+	deploy := mappingValue(root, "deploy")
+	if deploy == nil || deploy.Kind != yaml.MappingNode {
+		return nil
+	}
+	mappings := mappingValue(deploy, "mappings")
+	if mappings == nil || mappings.Kind != yaml.SequenceNode || len(mappings.Content) == 0 || mappings.Content[0].Kind != yaml.MappingNode {
+		return nil
+	}
+	return mappings.Content[0]
+}
@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -57,8 +58,8 @@ deploy:
 		t.Fatal(err)
 	}
 	m := cfg.Deploy.Mappings[0]
-	if m.Mode != "0644" {
-		t.Errorf("default Mode = %q, want 0644", m.Mode)
+	if m.Mode != "" {
+		t.Errorf("Mode = %q, want it left empty for the plan to default", m.Mode)
 	}
 	if m.DirMode != "0755" {
 		t.Errorf("default DirMode = %q, want 0755", m.DirMode)
@@ -193,3 +194,457 @@ deploy:
 		t.Errorf("DirMode should not be overridden, got %q", m.DirMode)
 	}
 }
+
+const envConfig = `
+name: app
+server: http://staging:8765
+deploy:
+  mappings:
+    - src: ./dist
+      dest: /opt/app
+hooks:
+  server_post: .eacd/start.sh
+environments:
+  prod:
+    server: http://prod:8765
+    token_env: EACD_TOKEN_PROD
+    inventory: .eacd/inventory.prod.yaml
+    deploy:
+      mappings:
+        - src: ./dist
+          dest: /srv/app
+      systemd:
+        unit: .eacd/app.service
+        restart: true
+    hooks:
+      server_pre: .eacd/stop.sh
+`
+
+func TestLoadClientConfig_EnvironmentDefaults(t *testing.T) {
+	dir := t.TempDir()
+	writeConfig(t, dir, envConfig)
+	cfg, err := LoadClientConfig(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.TokenEnv != "EACD_TOKEN" {
+		t.Errorf("default TokenEnv = %q, want EACD_TOKEN", cfg.TokenEnv)
+	}
+	if cfg.Inventory != ".eacd/inventory.yaml" {
+		t.Errorf("default Inventory = %q", cfg.Inventory)
+	}
+	if m := cfg.Environments["prod"].Deploy.Mappings[0]; m.DirMode != "0755" {
+		t.Errorf("environment mapping default DirMode = %q, want 0755", m.DirMode)
+	}
+}
+
+func TestForEnvironment_Overrides(t *testing.T) {
+	dir := t.TempDir()
+	writeConfig(t, dir, envConfig)
+	cfg, err := LoadClientConfig(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prod, err := cfg.ForEnvironment("prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prod.Server != "http://prod:8765" {
+		t.Errorf("Server = %q", prod.Server)
+	}
+	if prod.TokenEnv != "EACD_TOKEN_PROD" {
+		t.Errorf("TokenEnv = %q", prod.TokenEnv)
+	}
+	if prod.Inventory != ".eacd/inventory.prod.yaml" {
+		t.Errorf("Inventory = %q", prod.Inventory)
+	}
+	if prod.Deploy.Mappings[0].Dest != "/srv/app" {
+		t.Errorf("Dest = %q", prod.Deploy.Mappings[0].Dest)
+	}
+	if prod.Deploy.Systemd == nil || !prod.Deploy.Systemd.Restart {
+		t.Error("expected systemd override")
+	}
+	// Hooks merge field by field.
+	if prod.Hooks.ServerPre != ".eacd/stop.sh" || prod.Hooks.ServerPost != ".eacd/start.sh" {
+		t.Errorf("Hooks = %+v", prod.Hooks)
+	}
+	if prod.Name != "app" {
+		t.Errorf("Name = %q", prod.Name)
+	}
+
+	// The base config must not be modified.
+	if cfg.Server != "http://staging:8765" {
+		t.Errorf("base Server changed to %q", cfg.Server)
+	}
+}
+
+func TestForEnvironment_TokenEnvDropsTopLevelToken(t *testing.T) {
+	dir := t.TempDir()
+	writeConfig(t, dir, `
+name: app
+server: http://staging:8765
+token: staging-secret
+deploy:
+  mappings:
+    - src: ./dist
+      dest: /opt/app
+environments:
+  prod:
+    server: http://prod:8765
+    token_env: EACD_TOKEN_PROD
+  qa:
+    server: http://qa:8765
+    token_env: EACD_TOKEN_QA
+    token: qa-secret
+`)
+	cfg, err := LoadClientConfig(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prod, err := cfg.ForEnvironment("prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prod.Token != "" {
+		t.Errorf("prod inherited the top-level token %q", prod.Token)
+	}
+	qa, err := cfg.ForEnvironment("qa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if qa.Token != "qa-secret" {
+		t.Errorf("qa Token = %q", qa.Token)
+	}
+	staging, err := cfg.ForEnvironment("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if staging.Token != "staging-secret" {
+		t.Errorf("top-level Token = %q", staging.Token)
+	}
+}
+
+func TestForEnvironment_Unknown(t *testing.T) {
+	dir := t.TempDir()
+	writeConfig(t, dir, envConfig)
+	cfg, err := LoadClientConfig(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cfg.ForEnvironment("qa"); err == nil {
+		t.Error("expected error for unknown environment")
+	}
+}
+
+func TestForEnvironment_TopLevelWithoutServer(t *testing.T) {
+	dir := t.TempDir()
+	writeConfig(t, dir, `
+name: app
+deploy:
+  mappings:
+    - src: ./dist
+      dest: /opt/app
+environments:
+  staging:
+    server: http://staging:8765
+  prod:
+    server: http://prod:8765
+`)
+	cfg, err := LoadClientConfig(dir)
+	if err != nil {
+		t.Fatalf("server may be omitted at top level when environments define it: %v", err)
+	}
+	if _, err := cfg.ForEnvironment(""); err == nil {
+		t.Error("expected error when no environment is selected and top level has no server")
+	}
+	if _, err := cfg.ForEnvironment("staging"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestLoadClientConfig_EnvironmentMissingServer(t *testing.T) {
+	dir := t.TempDir()
+	writeConfig(t, dir, `
+name: app
+deploy:
+  mappings:
+    - src: ./dist
+      dest: /opt/app
+environments:
+  prod:
+    token_env: EACD_TOKEN_PROD
+`)
+	if _, err := LoadClientConfig(dir); err == nil {
+		t.Error("expected error for environment without a server")
+	}
+}
+
+func TestLoadClientConfig_ServersAndRollout(t *testing.T) {
+	dir := t.TempDir()
+	writeConfig(t, dir, `
+name: app
+servers:
+  - http://a:8765
+  - http://b:8765
+rollout:
+  strategy: rolling
+  health_check: http://{host}:8080/healthz
+  health_timeout: 10s
+deploy:
+  mappings:
+    - src: ./dist
+      dest: /opt/app
+environments:
+  canary:
+    server: http://c:8765
+`)
+	cfg, err := LoadClientConfig(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cfg.Targets(); len(got) != 2 {
+		t.Errorf("Targets() = %v", got)
+	}
+	if cfg.Rollout.BatchSize != 1 {
+		t.Errorf("default BatchSize = %d, want 1", cfg.Rollout.BatchSize)
+	}
+	if cfg.Rollout.HealthTimeout.Seconds() != 10 {
+		t.Errorf("HealthTimeout = %v", cfg.Rollout.HealthTimeout)
+	}
+
+	canary, err := cfg.ForEnvironment("canary")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := canary.Targets(); len(got) != 1 || got[0] != "http://c:8765" {
+		t.Errorf("environment server should replace servers list, got %v", got)
+	}
+}
+
+func TestLoadClientConfig_InvalidStrategy(t *testing.T) {
+	dir := t.TempDir()
+	writeConfig(t, dir, `
+name: app
+server: http://a:8765
+rollout:
+  strategy: blue-green
+deploy:
+  mappings:
+    - src: ./dist
+      dest: /opt/app
+`)
+	if _, err := LoadClientConfig(dir); err == nil {
+		t.Error("expected error for unknown rollout strategy")
+	}
+}
+
+func TestForEnvironment_MergesVars(t *testing.T) {
+	dir := t.TempDir()
+	writeConfig(t, dir, `
+name: app
+server: http://staging:8765
+vars:
+  port: "8080"
+  db: postgres://staging/app
+deploy:
+  mappings:
+    - src: ./dist
+      dest: /opt/app
+      templates: ["*.conf"]
+environments:
+  prod:
+    server: http://prod:8765
+    vars:
+      db: postgres://prod/app
+`)
+	cfg, err := LoadClientConfig(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prod, err := cfg.ForEnvironment("prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prod.Vars["port"] != "8080" || prod.Vars["db"] != "postgres://prod/app" {
+		t.Errorf("Vars = %v", prod.Vars)
+	}
+	if cfg.Vars["db"] != "postgres://staging/app" {
+		t.Error("base vars must not be modified")
+	}
+	if prod.Environment != "prod" {
+		t.Errorf("Environment = %q", prod.Environment)
+	}
+
+	m := prod.Deploy.Mappings[0]
+	if !m.IsTemplate("config/app.conf") || m.IsTemplate("app.bin") {
+		t.Error("IsTemplate should match the templates patterns against the file name")
+	}
+}
+
+func TestSetToken(t *testing.T) {
+	dir := t.TempDir()
+	writeConfig(t, dir, `# project config
+name: app
+server: http://a:8765
+token: old
+environments:
+  staging:
+    server: http://b:8765
+  prod:
+    server: http://c:8765
+    token: prod-old # own token
+`)
+	if err := SetToken(dir, "staging", "new"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetToken(dir, "prod", "prod-new"); err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := os.ReadFile(filepath.Join(dir, ".eacd", "config.yaml"))
+	for _, want := range []string{"# project config", "token: old", "token: prod-new # own token"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("missing %q in:\n%s", want, data)
+		}
+	}
+	// staging inherited the top-level token; the new one goes into its own entry.
+	if !strings.Contains(string(data), "\ntoken: old\n") || !strings.Contains(string(data), "    server: http://b:8765\n    token: new\n") {
+		t.Errorf("staging token not saved to its entry:\n%s", data)
+	}
+
+	if err := SetToken(dir, "qa", "x"); err == nil {
+		t.Error("expected an error for an unknown environment")
+	}
+}
+
+func TestAddEnvironment_CreatesSection(t *testing.T) {
+	dir := t.TempDir()
+	writeConfig(t, dir, "name: app\nserver: http://staging:8765\ndeploy:\n  mappings:\n    - src: ./dist\n      dest: /srv/app\n")
+	if err := AddEnvironment(dir, "prod", "http://prod:8765", "EACD_TOKEN_PROD", ""); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadClientConfig(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prod, err := cfg.ForEnvironment("prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prod.Server != "http://prod:8765" || prod.TokenEnv != "EACD_TOKEN_PROD" || prod.Deploy.Mappings[0].Dest != "/srv/app" {
+		t.Errorf("prod = %+v", prod)
+	}
+}
+
+func TestAddEnvironment_AppendsToSection(t *testing.T) {
+	dir := t.TempDir()
+	writeConfig(t, dir, `# project config
+name: app
+server: http://staging:8765
+deploy:
+  mappings:
+    - src: ./site
+      dest: /var/www
+      exclude: [node_modules]
+environments:
+  staging:
+    server: http://staging:8765
+    deploy:
+      mappings:
+        - src: ./staging-only
+          dest: /srv/staging
+
+hooks:
+  server_post: .eacd/start.sh
+`)
+	if err := AddEnvironment(dir, "prod", "http://prod:8765", "EACD_TOKEN_PROD", "/srv/app"); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, ".eacd", "config.yaml"))
+	if !strings.Contains(string(data), "# project config") {
+		t.Errorf("comment not kept:\n%s", data)
+	}
+
+	cfg, err := LoadClientConfig(dir)
+	if err != nil {
+		t.Fatalf("%v\n%s", err, data)
+	}
+	if len(cfg.Environments) != 2 || cfg.Hooks.ServerPost != ".eacd/start.sh" {
+		t.Errorf("environments or hooks lost:\n%s", data)
+	}
+	prod, err := cfg.ForEnvironment("prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The src of the top-level mapping, not of another environment's.
+	m := prod.Deploy.Mappings
+	if len(m) != 1 || m[0].Src != "./site" || m[0].Dest != "/srv/app" || len(m[0].Exclude) != 1 {
+		t.Errorf("prod mappings = %+v\n%s", m, data)
+	}
+}
+
+func TestAddEnvironment_RejectsDuplicate(t *testing.T) {
+	dir := t.TempDir()
+	writeConfig(t, dir, "name: app\nenvironments:\n  prod:\n    server: http://prod:8765\n")
+	if err := AddEnvironment(dir, "prod", "http://other:8765", "EACD_TOKEN_PROD", ""); err == nil {
+		t.Error("expected error for duplicate environment")
+	}
+}
+
+func TestLoadClientConfig_Auth(t *testing.T) {
+	dir := t.TempDir()
+	writeConfig(t, dir, `
+name: app
+server: http://a:8765
+auth: signed
+deploy:
+  mappings:
+    - src: ./dist
+      dest: /srv/app
+`)
+	if _, err := LoadClientConfig(dir); err == nil || !strings.Contains(err.Error(), "auth") {
+		t.Errorf("unknown auth mode: got %v", err)
+	}
+}
+
+func TestForEnvironment_Webhooks(t *testing.T) {
+	dir := t.TempDir()
+	writeConfig(t, dir, `
+name: app
+server: http://staging:8765
+webhooks:
+  - url: https://chat.example/staging
+deploy:
+  mappings:
+    - src: ./dist
+      dest: /opt/app
+environments:
+  prod:
+    server: http://prod:8765
+    webhooks:
+      - url: https://chat.example/prod
+        format: mattermost
+        secret_env: PROD_HOOK_SECRET
+`)
+	cfg, err := LoadClientConfig(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prod, err := cfg.ForEnvironment("prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(prod.Webhooks) != 1 || prod.Webhooks[0].URL != "https://chat.example/prod" || prod.Webhooks[0].SecretEnv != "PROD_HOOK_SECRET" {
+		t.Errorf("prod webhooks = %+v", prod.Webhooks)
+	}
+	if len(cfg.Webhooks) != 1 || cfg.Webhooks[0].Format != "json" {
+		t.Errorf("top-level webhooks = %+v", cfg.Webhooks)
+	}
+
+	writeConfig(t, dir, "name: app\nserver: http://a:8765\nwebhooks:\n  - url: https://x\n    format: teams\ndeploy:\n  mappings:\n    - src: ./dist\n      dest: /opt/app\n")
+	if _, err := LoadClientConfig(dir); err == nil || !strings.Contains(err.Error(), "teams") {
+		t.Errorf("unknown format: got %v", err)
+	}
+}
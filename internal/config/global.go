@@ -26,6 +26,16 @@ func globalConfigDir() (string, error) {
 	return filepath.Join(home, ".config", "eacd"), nil
 }
 
+// DefaultSigningKeyPath returns ~/.config/eacd/signing.key, where eacd keygen
+// writes the manifest signing key.
+func DefaultSigningKeyPath() (string, error) {
+	dir, err := globalConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "signing.key"), nil
+}
+
 func proxmoxConfigPath() (string, error) {
 	dir, err := globalConfigDir()
 	if err != nil {
@@ -82,6 +92,16 @@ func SaveProxmoxConfig(cfg *ProxmoxConfig) error {
 	return os.WriteFile(path, data, 0600)
 }
 
+// UserSecretsKeyPath returns ~/.config/eacd/secrets.key, the developer's own
+// key for decrypting .eacd/secrets.enc.
+func UserSecretsKeyPath() (string, error) {
+	dir, err := globalConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "secrets.key"), nil
+}
+
 func applyProxmoxDefaults(cfg *ProxmoxConfig) {
 	if cfg.Port == 0 {
 		cfg.Port = 8006
@@ -3,15 +3,106 @@ package config
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
 // ServerConfig is loaded from /etc/eacd/server.yaml on the CT.
 type ServerConfig struct {
-	Listen string `yaml:"listen"`   // e.g. ":8765"
+	Listen string `yaml:"listen"` // e.g. ":8765"
 	Token  string `yaml:"token"`
 	LogDir string `yaml:"log_dir"`
+
+	// Tokens are accepted in addition to Token, e.g. scoped CI tokens or
+	// the previous token during the grace period of a rotation.
+	Tokens []TokenConfig `yaml:"tokens"`
+
+	// RequireSignedRequests rejects bearer tokens; clients must sign each
+	// request with HMAC-SHA256 (client config auth: hmac).
+	RequireSignedRequests bool `yaml:"require_signed_requests"`
+
+	SecretsKey string `yaml:"secrets_key"` // X25519 key for secrets.enc, created on first start
+	AuditLog   string `yaml:"audit_log"`   // hash-chained JSON lines of every check, deploy and rollback
+
+	DeployLogs DeployLogsConfig `yaml:"deploy_logs"`
+
+	// UpgradePublicKey is a base64 ed25519 public key. If set, eacd
+	// upgrade-daemon must send binaries signed with the matching private key.
+	UpgradePublicKey string `yaml:"upgrade_public_key"`
+
+	// TrustedKeys are base64 ed25519 public keys (see eacd keygen). If set,
+	// deploys must carry a manifest signed by one of them.
+	TrustedKeys []string `yaml:"trusted_keys"`
+
+	// AllowCIDRs restricts access to these networks or IPs; empty allows all.
+	AllowCIDRs []string `yaml:"allow_cidrs"`
+	// TrustedProxies may set X-Forwarded-For, e.g. a local reverse proxy.
+	TrustedProxies []string `yaml:"trusted_proxies"`
+
+	RateLimits   map[string]RateLimit `yaml:"rate_limits"` // keys: see RateLimitDefaults
+	AuthFailures AuthFailuresConfig   `yaml:"auth_failures"`
+
+	// MinFreeDisk is the free space below which /health?ready=1 fails
+	// (default 256MB).
+	MinFreeDisk ByteSize `yaml:"min_free_disk"`
+
+	// MetricsToken is accepted as a bearer token for /metrics only, e.g.
+	// by Prometheus. Tokens with the read scope work as well.
+	MetricsToken string `yaml:"metrics_token"`
+
+	// Webhooks are notified of the deploys and rollbacks of all projects,
+	// or those listed in their projects.
+	Webhooks []WebhookConfig `yaml:"webhooks"`
+
+	// WebhookAllow lists the URLs project webhooks may post to, e.g.
+	// https://hooks.slack.com/services/. A project webhook is delivered only
+	// if its URL has the scheme and host of an entry and a path below the
+	// entry's; with none, project webhooks are ignored.
+	WebhookAllow []string `yaml:"webhook_allow"`
+
+	// ShutdownTimeout is how long eacdd waits for in-flight requests, e.g.
+	// a deploy, on SIGTERM before it cuts them off (default 1m).
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+}
+
+// RateLimit allows Requests per Per and client IP.
+type RateLimit struct {
+	Requests int           `yaml:"requests"`
+	Per      time.Duration `yaml:"per"` // default 1m
+}
+
+// RateLimitDefaults are the endpoint groups of rate_limits and their
+// defaults.
+var RateLimitDefaults = map[string]RateLimit{
+	"check":    {Requests: 60, Per: time.Minute}, // /check
+	"read":     {Requests: 60, Per: time.Minute}, // status, history, logs, files, drift, audit, version, secrets key, metrics
+	"deploy":   {Requests: 10, Per: time.Minute}, // /deploy
+	"rollback": {Requests: 10, Per: time.Minute}, // /rollback
+	"admin":    {Requests: 10, Per: time.Minute}, // /admin/*
+}
+
+// AuthFailuresConfig bans a client IP after repeated failed authentication.
+type AuthFailuresConfig struct {
+	Max    int           `yaml:"max"`    // failures allowed within Window (default 10)
+	Window time.Duration `yaml:"window"` // default 10m
+	Ban    time.Duration `yaml:"ban"`    // default 15m
+}
+
+// TokenConfig is an entry of the tokens: list.
+type TokenConfig struct {
+	Name    string    `yaml:"name"`
+	Token   string    `yaml:"token"`
+	Scopes  []string  `yaml:"scopes,omitempty"`  // "read", "deploy", "admin"; empty allows everything
+	Expires time.Time `yaml:"expires,omitempty"` // the token is rejected after this time
+}
+
+// DeployLogsConfig controls the deploy and rollback transcripts kept under
+// /var/lib/eacd/<project>/logs/.
+type DeployLogsConfig struct {
+	MaxSize  ByteSize `yaml:"max_size"`  // per transcript; output beyond it is not saved (default 5MB)
+	MaxTotal ByteSize `yaml:"max_total"` // per project; the oldest transcripts are deleted (default 100MB)
+	Keep     int      `yaml:"keep"`      // transcripts kept per project (default 50)
 }
 
 // LoadServerConfig reads and parses the server config file.
@@ -29,12 +120,113 @@ func LoadServerConfig(path string) (*ServerConfig, error) {
 	if cfg.Token == "" {
 		return nil, fmt.Errorf("%s: 'token' is required", path)
 	}
+	for i, t := range cfg.Tokens {
+		if t.Token == "" {
+			return nil, fmt.Errorf("%s: tokens[%d]: 'token' is required", path, i)
+		}
+		// A misspelled scope would leave a token that every route rejects.
+		for _, s := range t.Scopes {
+			switch s {
+			case "read", "deploy", "admin":
+			default:
+				return nil, fmt.Errorf("%s: tokens[%d] %q: unknown scope %q (use read, deploy or admin)", path, i, t.Name, s)
+			}
+		}
+	}
 	if cfg.Listen == "" {
 		cfg.Listen = ":8765"
 	}
 	if cfg.LogDir == "" {
 		cfg.LogDir = "/var/log/eacd"
 	}
+	if cfg.AuditLog == "" {
+		cfg.AuditLog = "/var/lib/eacd/audit.log"
+	}
+	if cfg.SecretsKey == "" {
+		cfg.SecretsKey = "/etc/eacd/secrets.key"
+	}
+	if cfg.DeployLogs.MaxSize == 0 {
+		cfg.DeployLogs.MaxSize = 5 << 20
+	}
+	if cfg.DeployLogs.MaxTotal == 0 {
+		cfg.DeployLogs.MaxTotal = 100 << 20
+	}
+	if cfg.DeployLogs.Keep == 0 {
+		cfg.DeployLogs.Keep = 50
+	}
+	if err := applyRateLimitDefaults(&cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := applyWebhookDefaults(cfg.Webhooks); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := checkWebhookAllow(cfg.WebhookAllow); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if cfg.AuthFailures.Max == 0 {
+		cfg.AuthFailures.Max = 10
+	}
+	if cfg.AuthFailures.Window == 0 {
+		cfg.AuthFailures.Window = 10 * time.Minute
+	}
+	if cfg.AuthFailures.Ban == 0 {
+		cfg.AuthFailures.Ban = 15 * time.Minute
+	}
+	if cfg.MinFreeDisk == 0 {
+		cfg.MinFreeDisk = 256 << 20
+	}
+	if cfg.ShutdownTimeout == 0 {
+		cfg.ShutdownTimeout = time.Minute
+	}
 
 	return &cfg, nil
 }
+
+func applyRateLimitDefaults(cfg *ServerConfig) error {
+	limits := make(map[string]RateLimit, len(RateLimitDefaults))
+	for name, l := range cfg.RateLimits {
+		if _, ok := RateLimitDefaults[name]; !ok {
+			return fmt.Errorf("rate_limits: unknown endpoint group %q (use check, read, deploy, rollback or admin)", name)
+		}
+		if l.Requests <= 0 {
+			return fmt.Errorf("rate_limits: %s: 'requests' must be positive", name)
+		}
+		if l.Per == 0 {
+			l.Per = time.Minute
+		}
+		limits[name] = l
+	}
+	for name, l := range RateLimitDefaults {
+		if _, ok := limits[name]; !ok {
+			limits[name] = l
+		}
+	}
+	cfg.RateLimits = limits
+	return nil
+}
+
+// SaveServerTokens sets token and tokens in the server config at path and
+// writes it atomically. Other settings and comments are kept.
+func SaveServerTokens(path, token string, tokens []TokenConfig) error {
+	doc, err := readYAML(path)
+	if err != nil {
+		return err
+	}
+	root := doc.Content[0]
+
+	var tokenNode, tokensNode yaml.Node
+	if err := tokenNode.Encode(token); err != nil {
+		return err
+	}
+	if err := tokensNode.Encode(tokens); err != nil {
+		return err
+	}
+	setMappingKey(root, "token", &tokenNode)
+	if len(tokens) > 0 {
+		setMappingKey(root, "tokens", &tokensNode)
+	} else {
+		deleteMappingKey(root, "tokens")
+	}
+
+	return writeYAML(path, doc)
+}
@@ -0,0 +1,139 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSaveServerTokens(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.yaml")
+	os.WriteFile(path, []byte("# eacdd config\nlisten: \":8765\"\ntoken: old # rotated by eacd token rotate\n"), 0600)
+
+	expires := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	if err := SaveServerTokens(path, "new", []TokenConfig{{Name: "previous primary", Token: "old", Expires: expires}}); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	if !strings.Contains(string(data), "# eacdd config") {
+		t.Errorf("comment lost:\n%s", data)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Errorf("mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	cfg, err := LoadServerConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Token != "new" || cfg.Listen != ":8765" {
+		t.Errorf("token = %q, listen = %q", cfg.Token, cfg.Listen)
+	}
+	if len(cfg.Tokens) != 1 || cfg.Tokens[0].Token != "old" || !cfg.Tokens[0].Expires.Equal(expires) {
+		t.Errorf("tokens = %+v", cfg.Tokens)
+	}
+
+	if err := SaveServerTokens(path, "new", nil); err != nil {
+		t.Fatal(err)
+	}
+	data, _ = os.ReadFile(path)
+	if strings.Contains(string(data), "tokens:") {
+		t.Errorf("empty tokens list kept:\n%s", data)
+	}
+}
+
+func TestServerTokenScopes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.yaml")
+	os.WriteFile(path, []byte("token: t\ntokens:\n  - name: ci\n    token: c\n    scopes: [read, deploy]\n"), 0600)
+	if _, err := LoadServerConfig(path); err != nil {
+		t.Fatal(err)
+	}
+
+	os.WriteFile(path, []byte("token: t\ntokens:\n  - name: ci\n    token: c\n    scopes: [deploi]\n"), 0600)
+	_, err := LoadServerConfig(path)
+	if err == nil || !strings.Contains(err.Error(), `"ci"`) || !strings.Contains(err.Error(), "deploi") {
+		t.Errorf("misspelled scope: got %v", err)
+	}
+}
+
+func TestServerRateLimits(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.yaml")
+	os.WriteFile(path, []byte("token: t\nrate_limits:\n  deploy:\n    requests: 3\n    per: 10m\n  check:\n    requests: 100\n"), 0600)
+	cfg, err := LoadServerConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := cfg.RateLimits["deploy"]; l.Requests != 3 || l.Per != 10*time.Minute {
+		t.Errorf("deploy = %+v", l)
+	}
+	if l := cfg.RateLimits["check"]; l.Requests != 100 || l.Per != time.Minute {
+		t.Errorf("check = %+v", l)
+	}
+	if l := cfg.RateLimits["admin"]; l != RateLimitDefaults["admin"] {
+		t.Errorf("admin = %+v, want the default", l)
+	}
+	if cfg.AuthFailures.Max != 10 || cfg.AuthFailures.Ban != 15*time.Minute {
+		t.Errorf("auth_failures = %+v", cfg.AuthFailures)
+	}
+
+	os.WriteFile(path, []byte("token: t\nrate_limits:\n  uploads:\n    requests: 3\n"), 0600)
+	if _, err := LoadServerConfig(path); err == nil || !strings.Contains(err.Error(), "uploads") {
+		t.Errorf("unknown group: got %v", err)
+	}
+}
+
+func TestServerWebhooks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.yaml")
+	os.WriteFile(path, []byte("token: t\nwebhooks:\n  - url: https://chat.example/hook\n    format: slack\n    events: [deploy_failed]\n  - url: https://ntfy.example/eacd\n    retries: -1\n"), 0600)
+	cfg, err := LoadServerConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h := cfg.Webhooks[0]; h.Format != "slack" || h.Timeout != 10*time.Second || h.Retries != 3 {
+		t.Errorf("webhooks[0] = %+v", h)
+	}
+	if h := cfg.Webhooks[1]; h.Format != "json" || h.Retries != 0 {
+		t.Errorf("webhooks[1] = %+v", h)
+	}
+
+	os.WriteFile(path, []byte("token: t\nwebhooks:\n  - url: https://chat.example/hook\n    events: [deployed]\n"), 0600)
+	if _, err := LoadServerConfig(path); err == nil || !strings.Contains(err.Error(), "deployed") {
+		t.Errorf("unknown event: got %v", err)
+	}
+}
+
+func TestWebhookAllowed(t *testing.T) {
+	allow := []string{"https://hooks.slack.com/services/", "http://ntfy.lan:8080"}
+	for _, tc := range []struct {
+		url  string
+		want bool
+	}{
+		{"https://hooks.slack.com/services/T0/B0/x", true},
+		{"https://HOOKS.slack.com/services/T0", true},
+		{"https://hooks.slack.com/services", true},
+		{"http://ntfy.lan:8080/eacd", true},
+		{"https://hooks.slack.com/api/x", false},
+		{"https://hooks.slack.com/servicesX", false},
+		{"https://hooks.slack.com/services/../api", false},
+		{"http://hooks.slack.com/services/T0", false},
+		{"https://hooks.slack.com.evil.example/services/T0", false},
+		{"https://hooks.slack.com@evil.example/services/T0", false},
+		{"http://ntfy.lan/eacd", false},
+		{"http://169.254.169.254/latest/meta-data", false},
+	} {
+		if got := WebhookAllowed(allow, tc.url); got != tc.want {
+			t.Errorf("%s: allowed = %v", tc.url, got)
+		}
+	}
+	if WebhookAllowed(nil, "https://hooks.slack.com/services/T0") {
+		t.Error("allowed without webhook_allow")
+	}
+
+	path := filepath.Join(t.TempDir(), "server.yaml")
+	os.WriteFile(path, []byte("token: t\nwebhook_allow: [hooks.slack.com]\n"), 0600)
+	if _, err := LoadServerConfig(path); err == nil || !strings.Contains(err.Error(), "webhook_allow") {
+		t.Errorf("entry without scheme: got %v", err)
+	}
+}
@@ -0,0 +1,42 @@
+package config
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestParseByteSize(t *testing.T) {
+	cases := map[string]ByteSize{
+		"4096":   4096,
+		"512KB":  512 << 10,
+		"10MB":   10 << 20,
+		"10 MiB": 10 << 20,
+		"1.5G":   3 << 29,
+		"2gib":   2 << 30,
+		"100B":   100,
+	}
+	for in, want := range cases {
+		got, err := ParseByteSize(in)
+		if err != nil || got != want {
+			t.Errorf("ParseByteSize(%q) = %d, %v; want %d", in, got, err, want)
+		}
+	}
+	for _, bad := range []string{"", "MB", "ten", "-1"} {
+		if _, err := ParseByteSize(bad); err == nil {
+			t.Errorf("ParseByteSize(%q) should fail", bad)
+		}
+	}
+}
+
+func TestByteSizeYAML(t *testing.T) {
+	var v struct {
+		Max ByteSize `yaml:"max"`
+	}
+	if err := yaml.Unmarshal([]byte("max: 5MB\n"), &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Max != 5<<20 || v.Max.String() != "5MiB" {
+		t.Errorf("got %d (%s)", v.Max, v.Max)
+	}
+}
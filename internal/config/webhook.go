@@ -0,0 +1,94 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// WebhookConfig is an entry of webhooks: in server.yaml or the project
+// config. eacdd posts deploy and rollback events to it.
+type WebhookConfig struct {
+	URL       string        `yaml:"url"`
+	Format    string        `yaml:"format"`     // json (default), slack, mattermost, ntfy or gotify
+	Secret    string        `yaml:"secret"`     // signs the body with HMAC-SHA256
+	SecretEnv string        `yaml:"secret_env"` // project config: env var holding the secret
+	Events    []string      `yaml:"events"`     // default: all, see WebhookEvents
+	Projects  []string      `yaml:"projects"`   // server.yaml: only these projects (default: all)
+	Timeout   time.Duration `yaml:"timeout"`    // per attempt (default 10s)
+	Retries   int           `yaml:"retries"`    // after a failed attempt (default 3)
+}
+
+// WebhookFormats are the payload formats of webhooks.
+var WebhookFormats = []string{"json", "slack", "mattermost", "ntfy", "gotify"}
+
+// WebhookEvents are the events webhooks can subscribe to.
+var WebhookEvents = []string{"deploy_started", "deploy_succeeded", "deploy_failed", "rolled_back", "rollback_failed"}
+
+func applyWebhookDefaults(hooks []WebhookConfig) error {
+	for i := range hooks {
+		h := &hooks[i]
+		if h.URL == "" {
+			return fmt.Errorf("webhooks[%d]: 'url' is required", i)
+		}
+		if h.Format == "" {
+			h.Format = "json"
+		}
+		if !slices.Contains(WebhookFormats, h.Format) {
+			return fmt.Errorf("webhooks[%d]: unknown format %q (use %s)", i, h.Format, strings.Join(WebhookFormats, ", "))
+		}
+		for _, e := range h.Events {
+			if !slices.Contains(WebhookEvents, e) {
+				return fmt.Errorf("webhooks[%d]: unknown event %q (use %s)", i, e, strings.Join(WebhookEvents, ", "))
+			}
+		}
+		if h.Timeout == 0 {
+			h.Timeout = 10 * time.Second
+		}
+		if h.Retries == 0 {
+			h.Retries = 3
+		}
+		if h.Retries < 0 {
+			h.Retries = 0
+		}
+	}
+	return nil
+}
+
+func checkWebhookAllow(allow []string) error {
+	for i, a := range allow {
+		u, err := url.Parse(a)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.User != nil {
+			return fmt.Errorf("webhook_allow[%d]: %q is not an http or https URL", i, a)
+		}
+	}
+	return nil
+}
+
+// WebhookAllowed reports whether a project webhook may post to rawURL: it
+// must have the scheme and host of an entry of allow and a path at or below
+// the entry's.
+func WebhookAllowed(allow []string, rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.User != nil || u.Opaque != "" {
+		return false
+	}
+	for _, seg := range strings.Split(u.Path, "/") {
+		if seg == "." || seg == ".." {
+			return false
+		}
+	}
+	for _, a := range allow {
+		au, err := url.Parse(a)
+		if err != nil || au.Scheme != u.Scheme || !strings.EqualFold(au.Host, u.Host) {
+			continue
+		}
+		prefix := strings.TrimSuffix(au.Path, "/")
+		if u.Path == prefix || strings.HasPrefix(u.Path, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
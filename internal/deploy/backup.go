@@ -7,21 +7,48 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+
+	"github.com/flo-mic/eacd/internal/api"
 )
 
 const rollbackDir = "/var/lib/eacd"
 
 func rollbackBase(project string) string {
-	return filepath.Join(rollbackDir, project, "rollback")
+	return filepath.Join(releasesDir, project, "rollback")
+}
+
+// snapshot describes what a rollback snapshot holds.
+type snapshot struct {
+	// Release is the ID of the last successful release when the snapshot
+	// was taken, i.e. the release a rollback returns to; 0 if none.
+	Release int `json:"release,omitempty"`
+	// Deployed is the deployed-file state drift was checked against when
+	// the snapshot was taken; nil if nothing was deployed.
+	Deployed []api.FileEntry `json:"deployed"`
 }
 
 // BackupFiles saves the current on-disk versions of destPaths so they can be
-// restored by RestoreBackup. newFiles are files that did not exist before this
-// deploy and should be deleted on rollback.
+// restored by RestoreBackup, together with the release they belong to.
+// newFiles are files that did not exist before this deploy and should be
+// deleted on rollback.
 func BackupFiles(project string, destPaths []string) error {
 	base := rollbackBase(project)
 	filesDir := filepath.Join(base, "files")
 
+	// The snapshot holds whatever the last successful release put on disk,
+	// even if deploys failed since.
+	var snap snapshot
+	releases, err := LoadReleases(project)
+	if err != nil {
+		return fmt.Errorf("loading releases: %w", err)
+	}
+	if cur := CurrentRelease(releases); cur != nil {
+		snap.Release = cur.ID
+	}
+	if snap.Deployed, err = LoadDeployedFiles(project); err != nil {
+		return fmt.Errorf("loading deployed state: %w", err)
+	}
+
 	// Clean previous backup
 	os.RemoveAll(base)
 	if err := os.MkdirAll(filesDir, 0755); err != nil {
@@ -48,11 +75,30 @@ func BackupFiles(project string, destPaths []string) error {
 
 	// Persist list of new files (to delete on rollback)
 	data, _ := json.Marshal(newFiles)
-	return os.WriteFile(filepath.Join(base, "new-files.json"), data, 0644)
+	if err := os.WriteFile(filepath.Join(base, "new-files.json"), data, 0644); err != nil {
+		return err
+	}
+	data, _ = json.Marshal(snap)
+	return os.WriteFile(filepath.Join(base, "snapshot.json"), data, 0644)
 }
 
-// RestoreBackup undoes the last deployment: restores backed-up files and
-// deletes any files that were new in that deployment.
+// SnapshotRelease returns the ID of the release the project's rollback
+// snapshot restores, or 0 if it is unknown.
+func SnapshotRelease(project string) int {
+	data, err := os.ReadFile(filepath.Join(rollbackBase(project), "snapshot.json"))
+	if err != nil {
+		return 0
+	}
+	var snap snapshot
+	if json.Unmarshal(data, &snap) != nil {
+		return 0
+	}
+	return snap.Release
+}
+
+// RestoreBackup undoes the last deployment: restores backed-up files,
+// deletes any files that were new in that deployment and makes the
+// deployed-file state saved with the snapshot current again.
 func RestoreBackup(project string, log io.Writer) error {
 	base := rollbackBase(project)
 	filesDir := filepath.Join(base, "files")
@@ -89,6 +135,18 @@ func RestoreBackup(project string, log io.Writer) error {
 		os.Remove(f)
 	}
 
+	// Snapshots taken before the state was saved with them leave it alone.
+	if raw, err := os.ReadFile(filepath.Join(base, "snapshot.json")); err == nil {
+		var snap snapshot
+		err := json.Unmarshal(raw, &snap)
+		if err == nil {
+			err = writeDeployedFiles(project, snap.Deployed)
+		}
+		if err != nil {
+			fmt.Fprintf(log, "[eacd] WARNING: restoring deployed state: %v\n", err)
+		}
+	}
+
 	os.RemoveAll(base)
 	return nil
 }
@@ -0,0 +1,47 @@
+package deploy
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/flo-mic/eacd/internal/api"
+)
+
+func TestBackupAfterFailedDeployKeepsCurrentRelease(t *testing.T) {
+	releasesDir = t.TempDir()
+	t.Cleanup(func() { releasesDir = rollbackDir })
+	dest := filepath.Join(t.TempDir(), "app.conf")
+
+	// Release 1 and 2 succeed, then a deploy fails after taking its backup.
+	for _, result := range []string{"ok", "ok"} {
+		if _, err := RecordRelease("app", api.Release{Action: "deploy", Result: result}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.WriteFile(dest, []byte("release 2\n"), 0644)
+	if err := BackupFiles("app", []string{dest}); err != nil {
+		t.Fatal(err)
+	}
+	RecordRelease("app", api.Release{Action: "deploy", Result: "fail"})
+
+	// The next deploy's backup holds release 2's files again.
+	if err := BackupFiles("app", []string{dest}); err != nil {
+		t.Fatal(err)
+	}
+	if id := SnapshotRelease("app"); id != 2 {
+		t.Errorf("snapshot release = %d, want 2", id)
+	}
+
+	os.WriteFile(dest, []byte("broken\n"), 0644)
+	if err := RestoreBackup("app", io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(dest); string(data) != "release 2\n" {
+		t.Errorf("restored %q", data)
+	}
+	if id := SnapshotRelease("app"); id != 0 {
+		t.Errorf("snapshot release after restore = %d, want 0", id)
+	}
+}
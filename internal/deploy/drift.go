@@ -0,0 +1,88 @@
+package deploy
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/flo-mic/eacd/internal/api"
+	"github.com/flo-mic/eacd/internal/delta"
+)
+
+func deployedPath(project string) string {
+	return filepath.Join(releasesDir, project, "deployed.json")
+}
+
+// SaveDeployedFiles records the files of a successful deploy as the state
+// drift is checked against. BackupFiles keeps the state it replaces with the
+// rollback snapshot.
+func SaveDeployedFiles(project string, files []api.FileEntry) error {
+	state := make([]api.FileEntry, len(files))
+	for i, f := range files {
+		state[i] = api.FileEntry{Dest: f.Dest, Mode: f.Mode, Hash: f.Hash}
+	}
+	return writeDeployedFiles(project, state)
+}
+
+// writeDeployedFiles replaces the project's deployed-file state with files;
+// nil means nothing is deployed.
+func writeDeployedFiles(project string, files []api.FileEntry) error {
+	path := deployedPath(project)
+	if files == nil {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(files, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// LoadDeployedFiles returns the files of the last deploy, or nil if the
+// project has no recorded state.
+func LoadDeployedFiles(project string) ([]api.FileEntry, error) {
+	data, err := os.ReadFile(deployedPath(project))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var files []api.FileEntry
+	if err := json.Unmarshal(data, &files); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// FileDrift compares files on disk with their deployed hash and mode.
+func FileDrift(files []api.FileEntry) []api.DriftItem {
+	var items []api.DriftItem
+	for _, f := range files {
+		info, err := os.Stat(f.Dest)
+		if err != nil {
+			items = append(items, api.DriftItem{Kind: "missing", Target: f.Dest, Detail: "file no longer exists"})
+			continue
+		}
+		if hash, err := delta.HashFile(f.Dest); err != nil {
+			items = append(items, api.DriftItem{Kind: "file", Target: f.Dest, Detail: fmt.Sprintf("cannot read: %v", err)})
+		} else if hash != f.Hash {
+			items = append(items, api.DriftItem{Kind: "file", Target: f.Dest, Detail: "content changed since deploy"})
+		}
+		if want, err := parseMode(f.Mode, 0644); err == nil && info.Mode().Perm() != want.Perm() {
+			items = append(items, api.DriftItem{Kind: "mode", Target: f.Dest, Detail: fmt.Sprintf("mode %04o, deployed %04o", info.Mode().Perm(), want.Perm())})
+		}
+	}
+	return items
+}
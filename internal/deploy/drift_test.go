@@ -0,0 +1,95 @@
+package deploy
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/flo-mic/eacd/internal/api"
+	"github.com/flo-mic/eacd/internal/delta"
+)
+
+func TestFileDrift(t *testing.T) {
+	dir := t.TempDir()
+	same := filepath.Join(dir, "same")
+	edited := filepath.Join(dir, "edited")
+	chmodded := filepath.Join(dir, "chmodded")
+	for _, p := range []string{same, edited, chmodded} {
+		if err := os.WriteFile(p, []byte("v1"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	hash, _ := delta.HashFile(same)
+
+	files := []api.FileEntry{
+		{Dest: same, Mode: "0644", Hash: hash},
+		{Dest: edited, Mode: "0644", Hash: hash},
+		{Dest: chmodded, Mode: "0644", Hash: hash},
+		{Dest: filepath.Join(dir, "gone"), Mode: "0644", Hash: hash},
+	}
+	os.WriteFile(edited, []byte("hotfix"), 0644)
+	os.Chmod(chmodded, 0600)
+
+	got := map[string]string{}
+	for _, item := range FileDrift(files) {
+		got[filepath.Base(item.Target)] = item.Kind
+	}
+	want := map[string]string{"edited": "file", "chmodded": "mode", "gone": "missing"}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s: got %q, want %q", k, got[k], v)
+		}
+	}
+}
+
+func TestDeployedFilesRestore(t *testing.T) {
+	releasesDir = t.TempDir()
+	t.Cleanup(func() { releasesDir = rollbackDir })
+	dest := filepath.Join(t.TempDir(), "a")
+
+	first := []api.FileEntry{{Dest: dest, Hash: "1", ArchivePath: "files/a"}}
+	second := []api.FileEntry{{Dest: dest, Hash: "2"}, {Dest: "/b", Hash: "3"}}
+	if err := SaveDeployedFiles("app", first); err != nil {
+		t.Fatal(err)
+	}
+	if err := BackupFiles("app", []string{dest}); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveDeployedFiles("app", second); err != nil {
+		t.Fatal(err)
+	}
+	// A failed deploy retakes the snapshot without saving new state.
+	if err := BackupFiles("app", []string{dest}); err != nil {
+		t.Fatal(err)
+	}
+	if err := RestoreBackup("app", io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	files, err := LoadDeployedFiles("app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || files[0].Hash != "2" {
+		t.Fatalf("after rolling back a failed deploy got %+v", files)
+	}
+
+	// Rolling back the first deploy leaves nothing deployed.
+	releasesDir = t.TempDir()
+	if err := BackupFiles("app", []string{dest}); err != nil {
+		t.Fatal(err)
+	}
+	SaveDeployedFiles("app", first)
+	if files, _ := LoadDeployedFiles("app"); len(files) != 1 || files[0].ArchivePath != "" {
+		t.Fatalf("saved %+v", files)
+	}
+	if err := RestoreBackup("app", io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if files, _ := LoadDeployedFiles("app"); files != nil {
+		t.Fatalf("after rolling back the first deploy got %+v", files)
+	}
+}
@@ -6,6 +6,9 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+
+	"github.com/flo-mic/eacd/internal/api"
+	"github.com/flo-mic/eacd/internal/events"
 )
 
 // PlaceFile copies a file from src to dest with the given octal mode string (e.g. "0755").
@@ -35,8 +38,12 @@ func PlaceFile(src, dest, modeStr string, log io.Writer) error {
 	if _, err := io.Copy(out, in); err != nil {
 		return fmt.Errorf("copy to %s: %w", dest, err)
 	}
+	// OpenFile only applies the mode to new files (and through the umask).
+	if err := out.Chmod(mode); err != nil {
+		return fmt.Errorf("chmod %s: %w", dest, err)
+	}
 
-	fmt.Fprintf(log, "[eacd] Placed %s (mode %s)\n", dest, modeStr)
+	events.Emit(log, api.Event{Type: api.EventFile, Path: dest, Mode: modeStr})
 	return nil
 }
 
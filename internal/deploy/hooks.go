@@ -4,15 +4,21 @@ import (
 	"fmt"
 	"io"
 	"os/exec"
+	"path/filepath"
+
+	"github.com/flo-mic/eacd/internal/events"
 )
 
 // RunHook executes a shell command via /bin/sh -c.
-// Output is written to log. Returns an error if the command exits non-zero.
+// Output is written to log, line by line as hook_output events if log is an
+// events.Sink. Returns an error if the command exits non-zero.
 func RunHook(cmd string, log io.Writer) error {
 	fmt.Fprintf(log, "[eacd] Running hook: %s\n", cmd)
+	out := events.HookOutput(log, filepath.Base(cmd))
+	defer out.Close()
 	c := exec.Command("/bin/sh", "-c", cmd)
-	c.Stdout = log
-	c.Stderr = log
+	c.Stdout = out
+	c.Stderr = out
 	c.Dir = "/"
 	if err := c.Run(); err != nil {
 		return fmt.Errorf("hook %q failed: %w", cmd, err)
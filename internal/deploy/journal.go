@@ -0,0 +1,64 @@
+package deploy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+)
+
+// FailureLogLines is how many journal lines are attached to the deploy
+// output when a unit fails to start.
+const FailureLogLines = 20
+
+// JournalArgs returns the journalctl arguments to show the logs of units.
+// lines <= 0 leaves journalctl's default; since is passed through unchanged
+// (e.g. "10 min ago" or "2026-10-18 14:00").
+func JournalArgs(units []string, since string, lines int, follow bool) []string {
+	args := []string{"--no-pager", "--output=short-iso"}
+	for _, u := range units {
+		args = append(args, "--unit="+u)
+	}
+	if since != "" {
+		args = append(args, "--since="+since)
+	}
+	if lines > 0 {
+		args = append(args, "--lines="+strconv.Itoa(lines))
+	}
+	if follow {
+		args = append(args, "--follow")
+	}
+	return args
+}
+
+// StreamJournal runs journalctl for units and copies its output to w until it
+// exits or ctx is cancelled.
+func StreamJournal(ctx context.Context, units []string, since string, lines int, follow bool, w io.Writer) error {
+	cmd := exec.CommandContext(ctx, "journalctl", JournalArgs(units, since, lines, follow)...)
+	cmd.Stdout = w
+	cmd.Stderr = w
+	err := cmd.Run()
+	if ctx.Err() != nil {
+		// Client disconnected from a followed stream.
+		return nil
+	}
+	return err
+}
+
+// WriteRecentLogs writes the last lines of unit's journal to log, so a
+// failed start can be diagnosed from the deploy output.
+func WriteRecentLogs(unit string, lines int, log io.Writer) {
+	out, err := exec.Command("journalctl", JournalArgs([]string{unit}, "", lines, false)...).Output()
+	if err != nil {
+		fmt.Fprintf(log, "[eacd] (could not read journal of %s: %v)\n", unit, err)
+		return
+	}
+	fmt.Fprintf(log, "[eacd] Last %d journal lines of %s:\n", lines, unit)
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		fmt.Fprintf(log, "[eacd]   %s\n", sc.Text())
+	}
+}
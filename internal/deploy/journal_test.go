@@ -0,0 +1,17 @@
+package deploy
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestJournalArgs(t *testing.T) {
+	got := strings.Join(JournalArgs([]string{"my-api.service", "nginx"}, "10 min ago", 50, true), " ")
+	want := "--no-pager --output=short-iso --unit=my-api.service --unit=nginx --since=10 min ago --lines=50 --follow"
+	if got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+	if got := JournalArgs([]string{"nginx"}, "", 0, false); len(got) != 3 {
+		t.Errorf("defaults: got %v", got)
+	}
+}
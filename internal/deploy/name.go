@@ -0,0 +1,35 @@
+package deploy
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// projectNameRe matches the project names eacdd accepts. A name becomes a
+// directory under the state dir, so it must be a single path segment. Names
+// starting with a dot are the daemon's own, such as .global and .transcripts.
+var projectNameRe = regexp.MustCompile(`^[A-Za-z0-9_-][A-Za-z0-9._-]*$`)
+
+// CheckProjectName fails for names that could leave the state dir, such as
+// "../etc", clash with the daemon's own state, such as ".global", or are not
+// a plain file name. Names from before this rule, such as "my app", are
+// still accepted if the project already has state.
+func CheckProjectName(name string) error {
+	if projectNameRe.MatchString(name) || isLegacyProject(name) {
+		return nil
+	}
+	return fmt.Errorf("invalid project name %q (use letters, digits, '.', '_' and '-', not starting with '.')", name)
+}
+
+// isLegacyProject reports whether name is a single path segment that does
+// not start with a dot and already has a directory in the state dir.
+func isLegacyProject(name string) bool {
+	if name == "" || strings.HasPrefix(name, ".") || strings.ContainsAny(name, "/\\\x00") {
+		return false
+	}
+	info, err := os.Stat(filepath.Join(StateDir(), name))
+	return err == nil && info.IsDir()
+}
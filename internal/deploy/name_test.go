@@ -0,0 +1,36 @@
+package deploy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckProjectName(t *testing.T) {
+	for _, name := range []string{"app", "my-api", "web_v2", "site.example.com"} {
+		if err := CheckProjectName(name); err != nil {
+			t.Errorf("%q: %v", name, err)
+		}
+	}
+	for _, name := range []string{"", ".", "..", ".global", ".transcripts", "../etc", "a/b", `a\b`, "my app", "app\x00"} {
+		if err := CheckProjectName(name); err == nil {
+			t.Errorf("%q accepted", name)
+		}
+	}
+}
+
+func TestCheckProjectNameLegacy(t *testing.T) {
+	releasesDir = t.TempDir()
+	t.Cleanup(func() { releasesDir = rollbackDir })
+	os.MkdirAll(filepath.Join(releasesDir, "my app"), 0755)
+	os.MkdirAll(filepath.Join(releasesDir, ".global"), 0755)
+
+	if err := CheckProjectName("my app"); err != nil {
+		t.Errorf("existing project rejected: %v", err)
+	}
+	for _, name := range []string{"new app", ".global", "..", "../etc"} {
+		if err := CheckProjectName(name); err == nil {
+			t.Errorf("%q accepted", name)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package deploy
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/flo-mic/eacd/internal/api"
+	"github.com/flo-mic/eacd/internal/disk"
+)
+
+// statDisk is disk.Stat; tests replace it.
+var statDisk = disk.Stat
+
+// spaceNeed is what a deploy writes to one filesystem.
+type spaceNeed struct {
+	usage  disk.Usage
+	bytes  uint64
+	inodes uint64
+	uses   []string // what is written there, for the error message
+}
+
+// Preflight checks that the filesystems of tmpDir (the extracted archive), the
+// state dir (the rollback backup) and the destinations have enough free space
+// and inodes for m, so a full disk does not stop the deploy halfway. Manifests
+// of older clients carry no sizes and are not checked.
+func Preflight(m *api.Manifest, tmpDir string) error {
+	if m.Size == nil {
+		return nil
+	}
+	needs := map[uint64]*spaceNeed{}
+	var order []uint64
+	add := func(path, use string, bytes, inodes uint64) error {
+		u, err := statDisk(path)
+		if err != nil {
+			return err
+		}
+		n, ok := needs[u.Dev]
+		if !ok {
+			n = &spaceNeed{usage: u}
+			needs[u.Dev] = n
+			order = append(order, u.Dev)
+		}
+		n.bytes += bytes
+		n.inodes += inodes
+		if !slices.Contains(n.uses, use) {
+			n.uses = append(n.uses, use)
+		}
+		return nil
+	}
+
+	if err := add(tmpDir, "upload", uint64(max(m.Size.Uncompressed, 0)), uint64(max(m.Size.Entries, 0))); err != nil {
+		return err
+	}
+
+	// The backup copies the destinations that exist, so their size on disk
+	// is exact.
+	var backup int64
+	var backupFiles uint64
+	for _, f := range m.Files {
+		if fi, err := os.Stat(f.Dest); err == nil && fi.Mode().IsRegular() {
+			backup += fi.Size()
+			backupFiles++
+		}
+	}
+	if err := add(rollbackBase(m.Name), "backup", uint64(backup), backupFiles); err != nil {
+		return err
+	}
+
+	type dirNeed struct{ bytes, files int64 }
+	dirs := map[string]*dirNeed{}
+	var dirOrder []string
+	for _, f := range m.Files {
+		if f.ArchivePath == "" {
+			continue
+		}
+		dir := filepath.Dir(f.Dest)
+		if dirs[dir] == nil {
+			dirs[dir] = &dirNeed{}
+			dirOrder = append(dirOrder, dir)
+		}
+		dirs[dir].bytes += max(f.Size, 0)
+		dirs[dir].files++
+	}
+	sort.Strings(dirOrder)
+	for _, dir := range dirOrder {
+		if err := add(dir, "files", uint64(dirs[dir].bytes), uint64(dirs[dir].files)); err != nil {
+			return err
+		}
+	}
+
+	var problems []string
+	for _, dev := range order {
+		n := needs[dev]
+		if n.bytes > n.usage.Free {
+			problems = append(problems, fmt.Sprintf("%s needs %s for %s, %s free",
+				n.usage.Path, disk.FormatBytes(n.bytes), strings.Join(n.uses, " and "), disk.FormatBytes(n.usage.Free)))
+		}
+		if n.usage.Inodes > 0 && n.inodes > n.usage.FreeInodes {
+			problems = append(problems, fmt.Sprintf("%s needs %d inodes for %s, %d free",
+				n.usage.Path, n.inodes, strings.Join(n.uses, " and "), n.usage.FreeInodes))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("not enough disk space: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package deploy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/flo-mic/eacd/internal/api"
+	"github.com/flo-mic/eacd/internal/disk"
+)
+
+func TestPreflight(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "srv", "app.conf")
+	os.MkdirAll(filepath.Dir(existing), 0755)
+	os.WriteFile(existing, make([]byte, 4000), 0644)
+
+	// Two filesystems: the destinations under dir and everything else.
+	free := map[bool]disk.Usage{
+		true:  {Dev: 1, Free: 10000, Inodes: 100, FreeInodes: 10},
+		false: {Dev: 2, Free: 20000, Inodes: 100, FreeInodes: 10},
+	}
+	statDisk = func(path string) (disk.Usage, error) {
+		u := free[strings.HasPrefix(path, dir)]
+		u.Path = path
+		return u, nil
+	}
+	t.Cleanup(func() { statDisk = disk.Stat })
+
+	m := &api.Manifest{
+		Name: "app",
+		Files: []api.FileEntry{
+			{ArchivePath: "files/0", Dest: existing, Size: 3000},
+			{ArchivePath: "files/1", Dest: filepath.Join(dir, "srv", "new.conf"), Size: 2000},
+			{Dest: filepath.Join(dir, "srv", "unchanged.conf"), Size: 1000},
+		},
+		Size: &api.DeploySize{Uncompressed: 5000, Entries: 2},
+	}
+	if err := Preflight(m, "/tmp"); err != nil {
+		t.Fatalf("enough space: %v", err)
+	}
+
+	// Upload (5000) and backup (4000, the existing file) share a filesystem.
+	free[false] = disk.Usage{Dev: 2, Free: 8000, Inodes: 100, FreeInodes: 10}
+	err := Preflight(m, "/tmp")
+	if err == nil || !strings.Contains(err.Error(), "needs 8.8 KiB for upload and backup, 7.8 KiB free") {
+		t.Errorf("temp and state dir full: %v", err)
+	}
+
+	free[false] = disk.Usage{Dev: 2, Free: 1 << 20, Inodes: 100, FreeInodes: 10}
+	free[true] = disk.Usage{Dev: 1, Free: 1 << 20, Inodes: 100, FreeInodes: 1}
+	err = Preflight(m, "/tmp")
+	if err == nil || !strings.Contains(err.Error(), "needs 2 inodes for files, 1 free") {
+		t.Errorf("no inodes at the destination: %v", err)
+	}
+
+	m.Size = nil
+	if err := Preflight(m, "/tmp"); err != nil {
+		t.Errorf("manifest without sizes: %v", err)
+	}
+}
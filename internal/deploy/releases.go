@@ -0,0 +1,92 @@
+package deploy
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/flo-mic/eacd/internal/api"
+)
+
+// maxReleases is how many releases are kept per project.
+const maxReleases = 100
+
+// releasesDir is the state directory holding <project>/releases.json.
+// It is a variable so tests can redirect it.
+var releasesDir = rollbackDir
+
+func releasesPath(project string) string {
+	return filepath.Join(releasesDir, project, "releases.json")
+}
+
+// LoadReleases returns the recorded releases of a project, oldest first.
+// A project that was never deployed has no releases.
+func LoadReleases(project string) ([]api.Release, error) {
+	data, err := os.ReadFile(releasesPath(project))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var releases []api.Release
+	if err := json.Unmarshal(data, &releases); err != nil {
+		return nil, err
+	}
+	return releases, nil
+}
+
+// RecordRelease appends rel to the project's history, assigning the next ID
+// and the current time. Only the newest maxReleases are kept.
+func RecordRelease(project string, rel api.Release) (api.Release, error) {
+	releases, err := LoadReleases(project)
+	if err != nil {
+		return rel, err
+	}
+	rel.ID = 1
+	if len(releases) > 0 {
+		rel.ID = releases[len(releases)-1].ID + 1
+	}
+	if rel.Time.IsZero() {
+		rel.Time = time.Now().UTC()
+	}
+	releases = append(releases, rel)
+	if len(releases) > maxReleases {
+		releases = releases[len(releases)-maxReleases:]
+	}
+
+	path := releasesPath(project)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return rel, err
+	}
+	data, err := json.MarshalIndent(releases, "", "  ")
+	if err != nil {
+		return rel, err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return rel, err
+	}
+	return rel, os.Rename(tmp, path)
+}
+
+// CurrentRelease returns the last successful release, or nil.
+func CurrentRelease(releases []api.Release) *api.Release {
+	for i := len(releases) - 1; i >= 0; i-- {
+		if releases[i].Result == "ok" {
+			return &releases[i]
+		}
+	}
+	return nil
+}
+
+// FindRelease returns the release with the given ID, or nil.
+func FindRelease(releases []api.Release, id int) *api.Release {
+	for i := range releases {
+		if releases[i].ID == id {
+			return &releases[i]
+		}
+	}
+	return nil
+}
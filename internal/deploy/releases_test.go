@@ -0,0 +1,71 @@
+package deploy
+
+import (
+	"testing"
+
+	"github.com/flo-mic/eacd/internal/api"
+)
+
+func TestRecordRelease(t *testing.T) {
+	releasesDir = t.TempDir()
+	t.Cleanup(func() { releasesDir = rollbackDir })
+
+	for _, result := range []string{"ok", "ok", "fail"} {
+		if _, err := RecordRelease("app", api.Release{Action: "deploy", Result: result}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	releases, err := LoadReleases("app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(releases) != 3 {
+		t.Fatalf("got %d releases, want 3", len(releases))
+	}
+	for i, r := range releases {
+		if r.ID != i+1 {
+			t.Errorf("release %d has ID %d", i, r.ID)
+		}
+		if r.Time.IsZero() {
+			t.Errorf("release %d has no time", r.ID)
+		}
+	}
+	if cur := CurrentRelease(releases); cur == nil || cur.ID != 2 {
+		t.Errorf("current = %+v, want release 2", cur)
+	}
+	if r := FindRelease(releases, 3); r == nil || r.Result != "fail" {
+		t.Errorf("release 3 = %+v", r)
+	}
+}
+
+func TestRecordReleaseKeepsNewest(t *testing.T) {
+	releasesDir = t.TempDir()
+	t.Cleanup(func() { releasesDir = rollbackDir })
+
+	for i := 0; i < maxReleases+5; i++ {
+		if _, err := RecordRelease("app", api.Release{Result: "ok"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	releases, err := LoadReleases("app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(releases) != maxReleases {
+		t.Fatalf("got %d releases, want %d", len(releases), maxReleases)
+	}
+	if releases[0].ID != 6 || releases[len(releases)-1].ID != maxReleases+5 {
+		t.Errorf("kept IDs %d..%d", releases[0].ID, releases[len(releases)-1].ID)
+	}
+}
+
+func TestLoadReleasesMissing(t *testing.T) {
+	releasesDir = t.TempDir()
+	t.Cleanup(func() { releasesDir = rollbackDir })
+
+	releases, err := LoadReleases("never-deployed")
+	if err != nil || releases != nil {
+		t.Fatalf("got %v, %v", releases, err)
+	}
+}
@@ -0,0 +1,48 @@
+package deploy
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// StateDir returns the directory holding the state of all projects.
+func StateDir() string {
+	return releasesDir
+}
+
+// CheckState checks that the state dir is writable, reads the JSON state
+// files of every project and of .global and returns one error per problem. A
+// state dir that does not exist yet has no problems.
+func CheckState() []error {
+	if fi, err := os.Stat(releasesDir); os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return []error{err}
+	} else if !fi.IsDir() {
+		return []error{fmt.Errorf("%s is not a directory", releasesDir)}
+	}
+	var problems []error
+	if f, err := os.CreateTemp(releasesDir, ".write-check-*"); err != nil {
+		problems = append(problems, fmt.Errorf("state dir is not writable: %w", err))
+	} else {
+		f.Close()
+		os.Remove(f.Name())
+	}
+	files, err := filepath.Glob(filepath.Join(releasesDir, "*", "*.json"))
+	if err != nil {
+		return append(problems, err)
+	}
+	for _, path := range files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			problems = append(problems, err)
+			continue
+		}
+		if !json.Valid(data) {
+			problems = append(problems, fmt.Errorf("%s: invalid JSON", path))
+		}
+	}
+	return problems
+}
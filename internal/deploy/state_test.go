@@ -0,0 +1,39 @@
+package deploy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/flo-mic/eacd/internal/api"
+)
+
+func TestCheckState(t *testing.T) {
+	releasesDir = filepath.Join(t.TempDir(), "state")
+	t.Cleanup(func() { releasesDir = rollbackDir })
+
+	if problems := CheckState(); len(problems) != 0 {
+		t.Errorf("missing state dir: %v", problems)
+	}
+
+	if _, err := RecordRelease("app", api.Release{Action: "deploy", Result: "ok"}); err != nil {
+		t.Fatal(err)
+	}
+	if problems := CheckState(); len(problems) != 0 {
+		t.Errorf("valid state: %v", problems)
+	}
+
+	os.WriteFile(filepath.Join(releasesDir, "app", "deployed.json"), []byte("{truncated"), 0644)
+	problems := CheckState()
+	if len(problems) != 1 || !strings.Contains(problems[0].Error(), "deployed.json") {
+		t.Errorf("corrupt state: %v", problems)
+	}
+
+	os.RemoveAll(releasesDir)
+	os.WriteFile(releasesDir, nil, 0644)
+	problems = CheckState()
+	if len(problems) != 1 || !strings.Contains(problems[0].Error(), "not a directory") {
+		t.Errorf("state dir is a file: %v", problems)
+	}
+}
@@ -26,6 +26,7 @@ func InstallUnit(srcPath, unitDest string, enable, restart bool, log io.Writer)
 	}
 	if restart {
 		if err := runSystemctl(log, "restart", unitName); err != nil {
+			WriteRecentLogs(unitName, FailureLogLines, log)
 			return err
 		}
 	}
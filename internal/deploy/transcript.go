@@ -0,0 +1,126 @@
+package deploy
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// LogRetention limits the transcripts kept per project.
+type LogRetention struct {
+	MaxSize  int64 // bytes per transcript; later output is not saved
+	MaxTotal int64 // bytes per project; the oldest transcripts are deleted
+	Keep     int   // number of transcripts per project
+}
+
+// Transcript records the streamed output of a deploy or rollback. It is
+// written to a temporary file until Save moves it next to the release.
+type Transcript struct {
+	f         *os.File
+	max       int64
+	written   int64
+	truncated bool
+}
+
+// NewTranscript starts a transcript that keeps at most maxSize bytes.
+func NewTranscript(maxSize int64) (*Transcript, error) {
+	dir := filepath.Join(releasesDir, ".transcripts")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	f, err := os.CreateTemp(dir, "transcript-*.log")
+	if err != nil {
+		return nil, err
+	}
+	return &Transcript{f: f, max: maxSize}, nil
+}
+
+// Write saves p until the size limit is reached. It never fails, so it can
+// sit behind the client stream without breaking it.
+func (t *Transcript) Write(p []byte) (int, error) {
+	if t.truncated {
+		return len(p), nil
+	}
+	if t.max > 0 && t.written+int64(len(p)) > t.max {
+		t.truncated = true
+		fmt.Fprintf(t.f, "\n[eacd] (transcript truncated at %d bytes)\n", t.max)
+		return len(p), nil
+	}
+	n, _ := t.f.Write(p)
+	t.written += int64(n)
+	return len(p), nil
+}
+
+// Save stores the transcript as the log of release id and applies retention.
+func (t *Transcript) Save(project string, id int, keep LogRetention) error {
+	if err := t.f.Close(); err != nil {
+		os.Remove(t.f.Name())
+		return err
+	}
+	dir := transcriptDir(project)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		os.Remove(t.f.Name())
+		return err
+	}
+	if err := os.Rename(t.f.Name(), TranscriptPath(project, id)); err != nil {
+		os.Remove(t.f.Name())
+		return err
+	}
+	return pruneTranscripts(dir, keep)
+}
+
+// Discard removes a transcript that belongs to no release.
+func (t *Transcript) Discard() {
+	t.f.Close()
+	os.Remove(t.f.Name())
+}
+
+func transcriptDir(project string) string {
+	return filepath.Join(releasesDir, project, "logs")
+}
+
+// TranscriptPath is the saved transcript of release id.
+func TranscriptPath(project string, id int) string {
+	return filepath.Join(transcriptDir(project), strconv.Itoa(id)+".log")
+}
+
+// pruneTranscripts deletes the oldest transcripts until at most keep.Keep
+// remain and together they are no larger than keep.MaxTotal. The newest is
+// always kept.
+func pruneTranscripts(dir string, keep LogRetention) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	type logFile struct {
+		id   int
+		size int64
+	}
+	var logs []logFile
+	var total int64
+	for _, e := range entries {
+		id, err := strconv.Atoi(strings.TrimSuffix(e.Name(), ".log"))
+		if err != nil || !strings.HasSuffix(e.Name(), ".log") {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		logs = append(logs, logFile{id, info.Size()})
+		total += info.Size()
+	}
+	sort.Slice(logs, func(i, j int) bool { return logs[i].id < logs[j].id })
+
+	for len(logs) > 1 && ((keep.Keep > 0 && len(logs) > keep.Keep) || (keep.MaxTotal > 0 && total > keep.MaxTotal)) {
+		if err := os.Remove(filepath.Join(dir, strconv.Itoa(logs[0].id)+".log")); err != nil {
+			return err
+		}
+		total -= logs[0].size
+		logs = logs[1:]
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package deploy
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestTranscriptSaveAndTruncate(t *testing.T) {
+	releasesDir = t.TempDir()
+	t.Cleanup(func() { releasesDir = rollbackDir })
+
+	tr, err := NewTranscript(32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprintf(tr, "[eacd] Starting deployment\n")
+	fmt.Fprintf(tr, "[eacd] this line does not fit any more\n")
+	fmt.Fprintf(tr, "[eacd] STATUS:OK\n")
+	if err := tr.Save("app", 7, LogRetention{}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(TranscriptPath("app", 7))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := string(data)
+	if !strings.HasPrefix(s, "[eacd] Starting deployment\n") || !strings.Contains(s, "truncated at 32 bytes") {
+		t.Errorf("unexpected transcript:\n%s", s)
+	}
+	if strings.Contains(s, "STATUS") {
+		t.Errorf("output past the limit was saved:\n%s", s)
+	}
+}
+
+func TestPruneTranscripts(t *testing.T) {
+	releasesDir = t.TempDir()
+	t.Cleanup(func() { releasesDir = rollbackDir })
+
+	save := func(id int, size int, keep LogRetention) {
+		tr, err := NewTranscript(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tr.Write([]byte(strings.Repeat("x", size)))
+		if err := tr.Save("app", id, keep); err != nil {
+			t.Fatal(err)
+		}
+	}
+	exists := func(id int) bool {
+		_, err := os.Stat(TranscriptPath("app", id))
+		return err == nil
+	}
+
+	for id := 1; id <= 5; id++ {
+		save(id, 10, LogRetention{Keep: 3})
+	}
+	if exists(2) || !exists(3) || !exists(5) {
+		t.Error("keep: expected only releases 3-5 to remain")
+	}
+
+	// 3 × 10 bytes + 25 bytes exceeds 50: the oldest goes.
+	save(6, 25, LogRetention{MaxTotal: 50})
+	if exists(3) || !exists(4) || !exists(6) {
+		t.Error("max_total: expected releases 4-6 to remain")
+	}
+
+	// The newest transcript is kept even when it alone is too large.
+	save(7, 100, LogRetention{MaxTotal: 50})
+	if !exists(7) || exists(6) {
+		t.Error("max_total: newest transcript must be kept")
+	}
+}
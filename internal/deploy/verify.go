@@ -0,0 +1,65 @@
+package deploy
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/flo-mic/eacd/internal/api"
+	"github.com/flo-mic/eacd/internal/delta"
+)
+
+// VerifyArchive checks every file the manifest takes from the archive
+// extracted to dir against its manifest hash, so that tampered or corrupted
+// uploads are rejected before anything is placed. With requireHashes, hook
+// scripts and the systemd unit must carry a hash too, as required for
+// signed manifests.
+func VerifyArchive(dir string, m *api.Manifest, requireHashes bool) error {
+	for _, f := range m.Files {
+		if f.ArchivePath == "" {
+			continue
+		}
+		if err := verifyFile(dir, f.ArchivePath, f.Hash, true); err != nil {
+			return fmt.Errorf("%s: %w", f.Dest, err)
+		}
+	}
+	if h := m.Hooks; h != nil {
+		if h.ServerPre != "" {
+			if err := verifyFile(dir, h.ServerPre, h.ServerPreHash, requireHashes); err != nil {
+				return fmt.Errorf("server_pre hook: %w", err)
+			}
+		}
+		if h.ServerPost != "" {
+			if err := verifyFile(dir, h.ServerPost, h.ServerPostHash, requireHashes); err != nil {
+				return fmt.Errorf("server_post hook: %w", err)
+			}
+		}
+	}
+	if s := m.Systemd; s != nil && s.UnitArchivePath != "" {
+		if err := verifyFile(dir, s.UnitArchivePath, s.UnitHash, requireHashes); err != nil {
+			return fmt.Errorf("systemd unit: %w", err)
+		}
+	}
+	return nil
+}
+
+// verifyFile checks the file at archivePath below dir against want. An
+// empty want is only accepted if the hash is not required.
+func verifyFile(dir, archivePath, want string, required bool) error {
+	if !filepath.IsLocal(archivePath) {
+		return fmt.Errorf("archive path %q leaves the archive", archivePath)
+	}
+	if want == "" {
+		if required {
+			return fmt.Errorf("no hash in the manifest")
+		}
+		return nil
+	}
+	got, err := delta.HashFile(filepath.Join(dir, archivePath))
+	if err != nil {
+		return fmt.Errorf("missing from the archive: %w", err)
+	}
+	if got != want {
+		return fmt.Errorf("content does not match the manifest hash (got %s, want %s)", got, want)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package deploy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/flo-mic/eacd/internal/api"
+	"github.com/flo-mic/eacd/internal/delta"
+)
+
+func TestVerifyArchive(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "files", "0"), 0755)
+	os.MkdirAll(filepath.Join(dir, "scripts"), 0755)
+	os.WriteFile(filepath.Join(dir, "files", "0", "app.conf"), []byte("port=80\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "scripts", "pre-deploy.sh"), []byte("#!/bin/sh\n"), 0755)
+	fileHash, _ := delta.HashFile(filepath.Join(dir, "files", "0", "app.conf"))
+	hookHash, _ := delta.HashFile(filepath.Join(dir, "scripts", "pre-deploy.sh"))
+
+	manifest := func() *api.Manifest {
+		return &api.Manifest{
+			Name: "app",
+			Files: []api.FileEntry{
+				{ArchivePath: "files/0/app.conf", Dest: "/etc/app.conf", Hash: fileHash},
+				{Dest: "/etc/unchanged.conf", Hash: "sha256:00"},
+			},
+			Hooks: &api.HooksEntry{ServerPre: "scripts/pre-deploy.sh", ServerPreHash: hookHash},
+		}
+	}
+
+	if err := VerifyArchive(dir, manifest(), true); err != nil {
+		t.Fatalf("valid archive: %v", err)
+	}
+
+	m := manifest()
+	m.Files[0].Hash = hookHash
+	if err := VerifyArchive(dir, m, false); err == nil || !strings.Contains(err.Error(), "/etc/app.conf") {
+		t.Errorf("tampered file: got %v", err)
+	}
+
+	m = manifest()
+	m.Hooks.ServerPreHash = ""
+	if err := VerifyArchive(dir, m, false); err != nil {
+		t.Errorf("unhashed hook without signature: %v", err)
+	}
+	if err := VerifyArchive(dir, m, true); err == nil {
+		t.Error("unhashed hook accepted in a signed manifest")
+	}
+
+	m = manifest()
+	m.Files[0].ArchivePath = "../../etc/shadow"
+	if err := VerifyArchive(dir, m, false); err == nil {
+		t.Error("archive path outside the archive accepted")
+	}
+}
@@ -0,0 +1,75 @@
+// Package disk reports free space and inodes of filesystems.
+package disk
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// Usage is the capacity of the filesystem holding Path.
+type Usage struct {
+	Path       string // the path that was checked; it may not exist yet
+	Dev        uint64 // device of the filesystem, equal for paths on the same one
+	Total      uint64 // bytes
+	Free       uint64 // bytes available to unprivileged users
+	Inodes     uint64
+	FreeInodes uint64
+}
+
+// FreePercent returns the free share of the space in percent.
+func (u Usage) FreePercent() float64 {
+	if u.Total == 0 {
+		return 0
+	}
+	return float64(u.Free) / float64(u.Total) * 100
+}
+
+// Stat returns the usage of the filesystem that holds path. If path does not
+// exist yet, its nearest existing parent is checked, since that is where it
+// would be created.
+func Stat(path string) (Usage, error) {
+	u := Usage{Path: path}
+	dir, err := filepath.Abs(path)
+	if err != nil {
+		return u, err
+	}
+	var st syscall.Statfs_t
+	for {
+		err = syscall.Statfs(dir, &st)
+		if !errors.Is(err, fs.ErrNotExist) || filepath.Dir(dir) == dir {
+			break
+		}
+		dir = filepath.Dir(dir)
+	}
+	if err != nil {
+		return u, &os.PathError{Op: "statfs", Path: path, Err: err}
+	}
+	if fi, err := os.Stat(dir); err == nil {
+		if sys, ok := fi.Sys().(*syscall.Stat_t); ok {
+			u.Dev = uint64(sys.Dev)
+		}
+	}
+	u.Total = uint64(st.Blocks) * uint64(st.Bsize)
+	u.Free = uint64(st.Bavail) * uint64(st.Bsize)
+	u.Inodes = uint64(st.Files)
+	u.FreeInodes = uint64(st.Ffree)
+	return u, nil
+}
+
+// FormatBytes formats n with a binary unit, e.g. "1.5 GiB".
+func FormatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,42 @@
+package disk
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestStat(t *testing.T) {
+	dir := t.TempDir()
+	u, err := Stat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Total == 0 || u.Free > u.Total {
+		t.Errorf("usage = %+v", u)
+	}
+	if p := u.FreePercent(); p < 0 || p > 100 {
+		t.Errorf("free = %v%%", p)
+	}
+
+	missing, err := Stat(filepath.Join(dir, "not", "there"))
+	if err != nil {
+		t.Fatalf("missing path: %v", err)
+	}
+	if missing.Total != u.Total || missing.Dev != u.Dev || missing.Path != filepath.Join(dir, "not", "there") {
+		t.Errorf("missing path = %+v, want the usage of %s", missing, dir)
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	for n, want := range map[uint64]string{
+		512:           "512 B",
+		1536:          "1.5 KiB",
+		300 << 20:     "300.0 MiB",
+		5 << 30:       "5.0 GiB",
+		3<<40 + 1<<39: "3.5 TiB",
+	} {
+		if got := FormatBytes(n); got != want {
+			t.Errorf("FormatBytes(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+// Package events emits the typed deploy events of api.Event.
+//
+// Code in the deploy and inventory packages writes progress to a plain
+// io.Writer. Where an event carries more structure than a text line, it calls
+// Emit: if the writer is a Sink (the daemon's event stream) it receives the
+// event, otherwise the event's text form is written, so plain-text output is
+// unchanged.
+package events
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flo-mic/eacd/internal/api"
+)
+
+// Sink receives structured events.
+type Sink interface {
+	Event(e api.Event)
+}
+
+// Emit sends e to w if it is a Sink and writes its text form otherwise.
+func Emit(w io.Writer, e api.Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	if s, ok := w.(Sink); ok {
+		s.Event(e)
+		return
+	}
+	io.WriteString(w, Text(e))
+}
+
+// Text returns the plain-text form of e, as written by daemons before the
+// event stream existed. Phase events have no text form.
+func Text(e api.Event) string {
+	switch e.Type {
+	case api.EventFile:
+		return fmt.Sprintf("[eacd] Placed %s (mode %s)\n", e.Path, e.Mode)
+	case api.EventPackage:
+		switch e.Action {
+		case "install":
+			return fmt.Sprintf("[eacd] Installing packages: %v\n", e.Packages)
+		case "remove":
+			return fmt.Sprintf("[eacd] Removing package: %s\n", strings.Join(e.Packages, " "))
+		default:
+			return fmt.Sprintf("[eacd] Skipping removal of %s (%s)\n", strings.Join(e.Packages, " "), e.Message)
+		}
+	case api.EventHookOutput, api.EventOutput:
+		return e.Message + "\n"
+	case api.EventLog:
+		return "[eacd] " + e.Message + "\n"
+	case api.EventWarning:
+		return "[eacd] WARNING: " + e.Message + "\n"
+	case api.EventResult:
+		if e.OK {
+			return "[eacd] STATUS:OK\n"
+		}
+		return "[eacd] STATUS:FAIL\n"
+	}
+	return ""
+}
+
+// Phase emits the start of a phase and returns a function emitting its end
+// with the elapsed time.
+func Phase(w io.Writer, name string) (end func()) {
+	start := time.Now()
+	Emit(w, api.Event{Type: api.EventPhaseStart, Phase: name})
+	return func() {
+		Emit(w, api.Event{Type: api.EventPhaseEnd, Phase: name, DurationMS: time.Since(start).Milliseconds()})
+	}
+}
+
+// HookOutput returns the writer a hook's stdout and stderr should go to.
+// For a Sink every line becomes a hook_output event; Close flushes a final
+// line without newline. For other writers it is w itself.
+func HookOutput(w io.Writer, hook string) io.WriteCloser {
+	s, ok := w.(Sink)
+	if !ok {
+		return nopCloser{w}
+	}
+	return &lineWriter{fn: func(line string) {
+		Emit(w, api.Event{Type: api.EventHookOutput, Hook: hook, Message: line})
+	}, sink: s}
+}
+
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
+
+// lineWriter calls fn for every complete line written to it.
+type lineWriter struct {
+	mu   sync.Mutex
+	buf  bytes.Buffer
+	fn   func(line string)
+	sink Sink
+}
+
+func (lw *lineWriter) Write(p []byte) (int, error) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	lw.buf.Write(p)
+	for {
+		i := bytes.IndexByte(lw.buf.Bytes(), '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		line := string(lw.buf.Next(i + 1))
+		lw.fn(strings.TrimRight(line, "\r\n"))
+	}
+}
+
+func (lw *lineWriter) Close() error {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	if lw.buf.Len() > 0 {
+		lw.fn(lw.buf.String())
+		lw.buf.Reset()
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package events
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/flo-mic/eacd/internal/api"
+)
+
+type recorder struct{ events []api.Event }
+
+func (r *recorder) Write(p []byte) (int, error) { return len(p), nil }
+func (r *recorder) Event(e api.Event)           { r.events = append(r.events, e) }
+
+func TestEmitText(t *testing.T) {
+	var buf bytes.Buffer
+	Emit(&buf, api.Event{Type: api.EventFile, Path: "/opt/app/run.sh", Mode: "0755"})
+	Emit(&buf, api.Event{Type: api.EventPackage, Action: "keep", Packages: []string{"curl"}, Message: "still needed by: [web]"})
+	end := Phase(&buf, "files")
+	end()
+	want := "[eacd] Placed /opt/app/run.sh (mode 0755)\n[eacd] Skipping removal of curl (still needed by: [web])\n"
+	if buf.String() != want {
+		t.Errorf("text output:\n%q\nwant\n%q", buf.String(), want)
+	}
+}
+
+func TestEmitSink(t *testing.T) {
+	var rec recorder
+	end := Phase(&rec, "files")
+	Emit(&rec, api.Event{Type: api.EventFile, Path: "/a"})
+	end()
+	if len(rec.events) != 3 {
+		t.Fatalf("got %d events, want 3", len(rec.events))
+	}
+	if rec.events[0].Type != api.EventPhaseStart || rec.events[2].Type != api.EventPhaseEnd || rec.events[2].Phase != "files" {
+		t.Errorf("unexpected events %+v", rec.events)
+	}
+	if rec.events[1].Time.IsZero() {
+		t.Error("event time not set")
+	}
+}
+
+func TestHookOutput(t *testing.T) {
+	var rec recorder
+	w := HookOutput(&rec, "pre.sh")
+	fmt.Fprint(w, "one\ntw")
+	fmt.Fprint(w, "o\r\nthree")
+	w.Close()
+	var got []string
+	for _, e := range rec.events {
+		if e.Type != api.EventHookOutput || e.Hook != "pre.sh" {
+			t.Errorf("unexpected event %+v", e)
+		}
+		got = append(got, e.Message)
+	}
+	if fmt.Sprint(got) != "[one two three]" {
+		t.Errorf("lines = %q", got)
+	}
+
+	// Plain writers get the output unchanged.
+	var buf bytes.Buffer
+	w = HookOutput(&buf, "pre.sh")
+	fmt.Fprint(w, "raw\n")
+	w.Close()
+	if buf.String() != "raw\n" {
+		t.Errorf("plain output = %q", buf.String())
+	}
+}
@@ -0,0 +1,148 @@
+package inventory
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/flo-mic/eacd/internal/api"
+)
+
+// Drift compares the host with the project's last reconciled inventory:
+// packages that were uninstalled, services whose enabled or running state
+// changed, and env drop-ins that were edited or removed.
+func Drift(project string) ([]api.DriftItem, error) {
+	stored, err := loadStoredInventory(project)
+	if err != nil {
+		return nil, err
+	}
+
+	// A missing key leaves keyed hashes uncheckable, see dropinDrift.
+	key, err := readHashKey()
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	var items []api.DriftItem
+	if len(stored.Packages) > 0 {
+		pm, err := detectPackageManager()
+		if err != nil {
+			return nil, err
+		}
+		for _, pkg := range stored.Packages {
+			if !packageInstalled(pm, pkg) {
+				items = append(items, api.DriftItem{Kind: "package", Target: pkg, Detail: "no longer installed"})
+			}
+		}
+	}
+
+	for _, svc := range stored.Services {
+		if enabled, err := serviceIsEnabled(svc.Name); err == nil && enabled != svc.Enabled {
+			detail := "disabled, should be enabled"
+			if enabled {
+				detail = "enabled, should be disabled"
+			}
+			items = append(items, api.DriftItem{Kind: "service", Target: svc.Name, Detail: detail})
+		}
+		active, _ := serviceIsActive(svc.Name)
+		switch {
+		case svc.State == "started" && !active:
+			items = append(items, api.DriftItem{Kind: "service", Target: svc.Name, Detail: "not running, should be started"})
+		case svc.State == "stopped" && active:
+			items = append(items, api.DriftItem{Kind: "service", Target: svc.Name, Detail: "running, should be stopped"})
+		}
+		// State written before drop-in hashes were recorded cannot be checked.
+		if stored.DropinHashes == nil {
+			continue
+		}
+		if item, ok := dropinDrift(svc.Name, stored.DropinHashes[svc.Name], key); ok {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+// dropinDrift checks the env drop-in of a service against the hash recorded
+// when it was written, keyed with key. An empty hash means eacd wrote no
+// drop-in.
+func dropinDrift(service, wantHash string, key []byte) (api.DriftItem, bool) {
+	path := filepath.Join(dropinBaseDir, service+".service.d", "eacd-env.conf")
+	data, err := os.ReadFile(path)
+	switch {
+	case wantHash == "" && err == nil:
+		return api.DriftItem{Kind: "dropin", Target: path, Detail: "created outside of eacd"}, true
+	case wantHash == "":
+		return api.DriftItem{}, false
+	case os.IsNotExist(err):
+		return api.DriftItem{Kind: "dropin", Target: path, Detail: "removed"}, true
+	case err != nil:
+		return api.DriftItem{Kind: "dropin", Target: path, Detail: "cannot read: " + err.Error()}, true
+	case !strings.HasPrefix(wantHash, keyedHashPrefix):
+		// Recorded before hashes were keyed; replaced by the next deploy.
+		sum := sha256.Sum256(data)
+		if hex.EncodeToString(sum[:]) != wantHash {
+			return api.DriftItem{Kind: "dropin", Target: path, Detail: "edited since deploy"}, true
+		}
+	case key == nil:
+		return api.DriftItem{Kind: "dropin", Target: path, Detail: "cannot check: " + hashKeyPath + " is missing"}, true
+	case !hmac.Equal([]byte(contentHash(key, string(data))), []byte(wantHash)):
+		return api.DriftItem{Kind: "dropin", Target: path, Detail: "edited since deploy"}, true
+	}
+	return api.DriftItem{}, false
+}
+
+// keyedHashPrefix marks the drop-in hashes made by contentHash.
+const keyedHashPrefix = "hmac-sha256:"
+
+// hashKeyPath holds the key of the drop-in hashes. The drop-ins contain
+// secret values and inventory.json is world-readable, so a plain hash would
+// let anyone guess weak secrets offline.
+var hashKeyPath = filepath.Join(stateDir, ".global", "dropin-hash.key")
+
+// contentHash returns the hash of a drop-in recorded in inventory.json.
+func contentHash(key []byte, content string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(content))
+	return keyedHashPrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+func readHashKey() ([]byte, error) {
+	key, err := os.ReadFile(hashKeyPath)
+	if err == nil && len(key) == 0 {
+		return nil, errors.New(hashKeyPath + " is empty")
+	}
+	return key, err
+}
+
+// loadHashKey returns the key of the drop-in hashes, creating it readable
+// only by root on first use.
+func loadHashKey() ([]byte, error) {
+	if key, err := readHashKey(); !os.IsNotExist(err) {
+		return key, err
+	}
+	if err := os.MkdirAll(filepath.Dir(hashKeyPath), 0755); err != nil {
+		return nil, err
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(hashKeyPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if os.IsExist(err) {
+		return readHashKey()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Write(key); err != nil {
+		f.Close()
+		os.Remove(hashKeyPath)
+		return nil, err
+	}
+	return key, f.Close()
+}
@@ -0,0 +1,79 @@
+package inventory
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDropinDrift(t *testing.T) {
+	base := patchDropinBase(t)
+	dir := filepath.Join(base, "app.service.d")
+	os.MkdirAll(dir, 0755)
+	path := filepath.Join(dir, "eacd-env.conf")
+
+	content := buildDropinContent(map[string]string{"PORT": "8080"})
+	key := []byte("key")
+	hash := contentHash(key, content)
+	os.WriteFile(path, []byte(content), 0644)
+
+	if item, ok := dropinDrift("app", hash, key); ok {
+		t.Errorf("unchanged drop-in reported as drift: %+v", item)
+	}
+
+	os.WriteFile(path, []byte(content+"Environment=\"DEBUG=1\"\n"), 0644)
+	if item, ok := dropinDrift("app", hash, key); !ok || item.Detail != "edited since deploy" {
+		t.Errorf("edited drop-in: got %+v, %v", item, ok)
+	}
+	if item, ok := dropinDrift("app", hash, nil); !ok || !strings.HasPrefix(item.Detail, "cannot check") {
+		t.Errorf("missing key: got %+v, %v", item, ok)
+	}
+
+	if item, ok := dropinDrift("app", "", key); !ok || item.Detail != "created outside of eacd" {
+		t.Errorf("foreign drop-in: got %+v, %v", item, ok)
+	}
+
+	os.Remove(path)
+	if item, ok := dropinDrift("app", hash, key); !ok || item.Detail != "removed" {
+		t.Errorf("removed drop-in: got %+v, %v", item, ok)
+	}
+	if _, ok := dropinDrift("app", "", key); ok {
+		t.Error("service without drop-in reported as drift")
+	}
+}
+
+func TestDropinHashKeyed(t *testing.T) {
+	orig := hashKeyPath
+	hashKeyPath = filepath.Join(t.TempDir(), ".global", "dropin-hash.key")
+	t.Cleanup(func() { hashKeyPath = orig })
+
+	key, err := loadHashKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(hashKeyPath); err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("key file: %v, %v", info, err)
+	}
+	if again, err := loadHashKey(); err != nil || !bytes.Equal(again, key) {
+		t.Errorf("key changed on second load: %v", err)
+	}
+
+	// The recorded hash must not be a plain digest of the secret values.
+	content := buildDropinContent(map[string]string{"DB_PASSWORD": "hunter2"})
+	plain := sha256.Sum256([]byte(content))
+	if hash := contentHash(key, content); strings.Contains(hash, hex.EncodeToString(plain[:])) {
+		t.Errorf("hash %s is the plain sha256 of the drop-in", hash)
+	}
+
+	// State recorded before hashes were keyed is still checked.
+	base := patchDropinBase(t)
+	os.MkdirAll(filepath.Join(base, "app.service.d"), 0755)
+	os.WriteFile(filepath.Join(base, "app.service.d", "eacd-env.conf"), []byte(content), 0644)
+	if item, ok := dropinDrift("app", hex.EncodeToString(plain[:]), key); ok {
+		t.Errorf("unchanged drop-in with a legacy hash reported as drift: %+v", item)
+	}
+}
@@ -4,20 +4,35 @@ import (
 	"fmt"
 	"io"
 	"os/exec"
+	"strings"
 )
 
 type packageManager struct {
 	name    string
 	install []string // args for install, package names appended
 	remove  []string // args for remove, package names appended
+	query   []string // args to check whether a package is installed, package name appended
+	// installed, if set, is the output query must print for an installed
+	// package; otherwise its exit status alone decides.
+	installed string
+}
+
+// PackageManager returns the name of the package manager packages are
+// installed with, or "" if there is none.
+func PackageManager() string {
+	pm, err := detectPackageManager()
+	if err != nil {
+		return ""
+	}
+	return pm.name
 }
 
 func detectPackageManager() (*packageManager, error) {
 	candidates := []packageManager{
-		{name: "apt-get", install: []string{"apt-get", "install", "-y"}, remove: []string{"apt-get", "remove", "-y"}},
-		{name: "dnf", install: []string{"dnf", "install", "-y"}, remove: []string{"dnf", "remove", "-y"}},
-		{name: "yum", install: []string{"yum", "install", "-y"}, remove: []string{"yum", "remove", "-y"}},
-		{name: "pacman", install: []string{"pacman", "-S", "--noconfirm"}, remove: []string{"pacman", "-R", "--noconfirm"}},
+		{name: "apt-get", install: []string{"apt-get", "install", "-y"}, remove: []string{"apt-get", "remove", "-y"}, query: []string{"dpkg-query", "-W", "-f=${Status}"}, installed: "install ok installed"},
+		{name: "dnf", install: []string{"dnf", "install", "-y"}, remove: []string{"dnf", "remove", "-y"}, query: []string{"rpm", "-q"}},
+		{name: "yum", install: []string{"yum", "install", "-y"}, remove: []string{"yum", "remove", "-y"}, query: []string{"rpm", "-q"}},
+		{name: "pacman", install: []string{"pacman", "-S", "--noconfirm"}, remove: []string{"pacman", "-R", "--noconfirm"}, query: []string{"pacman", "-Q"}},
 	}
 	for _, pm := range candidates {
 		if _, err := exec.LookPath(pm.name); err == nil {
@@ -41,7 +56,7 @@ func updatePackageIndex(pm *packageManager, log io.Writer) error {
 
 func installPackages(pm *packageManager, pkgs []string, log io.Writer) error {
 	if err := updatePackageIndex(pm, log); err != nil {
-		fmt.Fprintf(log, "[eacd] warning: package index update failed: %v\n", err)
+		fmt.Fprintf(log, "[eacd] WARNING: package index update failed: %v\n", err)
 	}
 	args := append(append([]string{}, pm.install...), pkgs...)
 	return runCmd(log, args[0], args[1:]...)
@@ -52,6 +67,17 @@ func removePackage(pm *packageManager, pkg string, log io.Writer) error {
 	return runCmd(log, args[0], args[1:]...)
 }
 
+// packageInstalled reports whether pkg is currently installed. Packages
+// that were removed but whose config files remain do not count.
+func packageInstalled(pm *packageManager, pkg string) bool {
+	args := append(append([]string{}, pm.query...), pkg)
+	out, err := exec.Command(args[0], args[1:]...).Output()
+	if err != nil {
+		return false
+	}
+	return pm.installed == "" || strings.TrimSpace(string(out)) == pm.installed
+}
+
 func runCmd(log io.Writer, name string, args ...string) error {
 	fmt.Fprintf(log, "[eacd] $ %s %v\n", name, args)
 	cmd := exec.Command(name, args...)
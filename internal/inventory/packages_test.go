@@ -0,0 +1,21 @@
+package inventory
+
+import "testing"
+
+func TestPackageInstalledStatus(t *testing.T) {
+	tests := []struct {
+		status string
+		want   bool
+	}{
+		{"install ok installed", true},
+		{"deinstall ok config-files", false},
+		{"install ok unpacked", false},
+	}
+	for _, tt := range tests {
+		// echo stands in for dpkg-query; the package name is appended to its output.
+		pm := &packageManager{query: []string{"echo", tt.status}, installed: "install ok installed pkg"}
+		if got := packageInstalled(pm, "pkg"); got != tt.want {
+			t.Errorf("%q: installed = %v, want %v", tt.status, got, tt.want)
+		}
+	}
+}
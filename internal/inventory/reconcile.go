@@ -5,12 +5,15 @@ import (
 	"io"
 
 	"github.com/flo-mic/eacd/internal/api"
+	"github.com/flo-mic/eacd/internal/events"
 )
 
 // Reconcile brings the system state in line with the desired inventory.
 // It installs/removes packages, manages services, and ensures users exist.
+// secrets holds the decrypted secrets.enc values referenced by services[].secrets;
+// they are only written to env drop-ins and never persisted in the state file.
 // State is persisted so subsequent deployments can diff correctly.
-func Reconcile(project string, desired *api.Inventory, log io.Writer) error {
+func Reconcile(project string, desired *api.Inventory, secrets map[string]string, log io.Writer) error {
 	stored, err := loadStoredInventory(project)
 	if err != nil {
 		return fmt.Errorf("loading stored inventory: %w", err)
@@ -29,7 +32,7 @@ func Reconcile(project string, desired *api.Inventory, log io.Writer) error {
 	toAdd, toRemove := diffStrings(desired.Packages, stored.Packages)
 
 	if len(toAdd) > 0 {
-		fmt.Fprintf(log, "[eacd] Installing packages: %v\n", toAdd)
+		events.Emit(log, api.Event{Type: api.EventPackage, Action: "install", Packages: toAdd})
 		if err := installPackages(pm, toAdd, log); err != nil {
 			return fmt.Errorf("installing packages: %w", err)
 		}
@@ -39,10 +42,10 @@ func Reconcile(project string, desired *api.Inventory, log io.Writer) error {
 	for _, pkg := range toRemove {
 		owners := gs.PackageOwners[pkg]
 		if len(owners) > 0 {
-			fmt.Fprintf(log, "[eacd] Skipping removal of %s (still needed by: %v)\n", pkg, owners)
+			events.Emit(log, api.Event{Type: api.EventPackage, Action: "keep", Packages: []string{pkg}, Message: fmt.Sprintf("still needed by: %v", owners)})
 			continue
 		}
-		fmt.Fprintf(log, "[eacd] Removing package: %s\n", pkg)
+		events.Emit(log, api.Event{Type: api.EventPackage, Action: "remove", Packages: []string{pkg}})
 		if err := removePackage(pm, pkg, log); err != nil {
 			// Non-fatal: log and continue
 			fmt.Fprintf(log, "[eacd] WARNING: could not remove %s: %v\n", pkg, err)
@@ -51,10 +54,24 @@ func Reconcile(project string, desired *api.Inventory, log io.Writer) error {
 	}
 
 	// --- Services ---
+	dropinHashes := make(map[string]string)
+	var hashKey []byte
 	for _, svc := range desired.Services {
+		svc, err := withSecrets(svc, secrets)
+		if err != nil {
+			return fmt.Errorf("reconciling service %s: %w", svc.Name, err)
+		}
 		if err := reconcileService(svc, log); err != nil {
 			return fmt.Errorf("reconciling service %s: %w", svc.Name, err)
 		}
+		if len(svc.Env) > 0 {
+			if hashKey == nil {
+				if hashKey, err = loadHashKey(); err != nil {
+					return fmt.Errorf("loading drop-in hash key: %w", err)
+				}
+			}
+			dropinHashes[svc.Name] = contentHash(hashKey, buildDropinContent(svc.Env))
+		}
 	}
 
 	// --- Users ---
@@ -68,6 +85,7 @@ func Reconcile(project string, desired *api.Inventory, log io.Writer) error {
 	stored.Packages = desired.Packages
 	stored.Services = desired.Services
 	stored.Users = desired.Users
+	stored.DropinHashes = dropinHashes
 
 	if err := saveStoredInventory(project, stored); err != nil {
 		return fmt.Errorf("saving inventory state: %w", err)
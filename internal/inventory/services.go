@@ -10,6 +10,7 @@ import (
 	"strings"
 
 	"github.com/flo-mic/eacd/internal/api"
+	"github.com/flo-mic/eacd/internal/deploy"
 )
 
 // dropinBaseDir is the base directory for systemd drop-ins.
@@ -54,11 +55,11 @@ func reconcileService(svc api.InventoryService, log io.Writer) error {
 		isRunning, _ := serviceIsActive(svc.Name)
 		if !isRunning {
 			fmt.Fprintf(log, "[eacd] Starting service: %s\n", svc.Name)
-			return runCmd(log, "systemctl", "start", svc.Name)
+			return startService(log, "start", svc.Name)
 		}
 		if envChanged {
 			fmt.Fprintf(log, "[eacd] Restarting service (env changed): %s\n", svc.Name)
-			return runCmd(log, "systemctl", "restart", svc.Name)
+			return startService(log, "restart", svc.Name)
 		}
 	case "stopped":
 		isRunning, _ := serviceIsActive(svc.Name)
@@ -71,6 +72,16 @@ func reconcileService(svc api.InventoryService, log io.Writer) error {
 	return nil
 }
 
+// startService starts or restarts a service and attaches its recent journal
+// to the log if that fails.
+func startService(log io.Writer, action, name string) error {
+	if err := runCmd(log, "systemctl", action, name); err != nil {
+		deploy.WriteRecentLogs(name, deploy.FailureLogLines, log)
+		return err
+	}
+	return nil
+}
+
 // reconcileServiceEnv writes or removes the systemd drop-in for env vars.
 // Returns true if the drop-in was created, updated, or deleted.
 func reconcileServiceEnv(svc api.InventoryService, log io.Writer) (bool, error) {
@@ -93,8 +104,17 @@ func reconcileServiceEnv(svc api.InventoryService, log io.Writer) (bool, error)
 
 	content := buildDropinContent(svc.Env)
 
+	// Drop-ins carrying secret values must not be world-readable.
+	var mode os.FileMode = 0644
+	if len(svc.Secrets) > 0 {
+		mode = 0600
+	}
+
 	// Skip write if content unchanged.
 	if existing, err := os.ReadFile(dropinFile); err == nil && string(existing) == content {
+		if err := os.Chmod(dropinFile, mode); err != nil {
+			return false, fmt.Errorf("setting drop-in mode: %w", err)
+		}
 		return false, nil
 	}
 
@@ -102,7 +122,7 @@ func reconcileServiceEnv(svc api.InventoryService, log io.Writer) (bool, error)
 	if err := os.MkdirAll(dropinDir, 0755); err != nil {
 		return false, fmt.Errorf("creating drop-in dir: %w", err)
 	}
-	if err := os.WriteFile(dropinFile, []byte(content), 0644); err != nil {
+	if err := writeDropin(dropinFile, content, mode); err != nil {
 		return false, fmt.Errorf("writing drop-in: %w", err)
 	}
 	if err := daemonReload(log); err != nil {
@@ -111,6 +131,51 @@ func reconcileServiceEnv(svc api.InventoryService, log io.Writer) (bool, error)
 	return true, nil
 }
 
+// writeDropin replaces path with content. The content goes to a temp file
+// in the same directory, created 0600 and given mode before it is written,
+// and is renamed into place, so secret values are never readable with the
+// mode of an older drop-in.
+func writeDropin(path, content string, mode os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.WriteString(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// withSecrets returns a copy of svc whose Env also contains the values of the
+// secrets it references. Values are never logged.
+func withSecrets(svc api.InventoryService, secrets map[string]string) (api.InventoryService, error) {
+	if len(svc.Secrets) == 0 {
+		return svc, nil
+	}
+	env := make(map[string]string, len(svc.Env)+len(svc.Secrets))
+	for k, v := range svc.Env {
+		env[k] = v
+	}
+	for envName, secretName := range svc.Secrets {
+		v, ok := secrets[secretName]
+		if !ok {
+			return svc, fmt.Errorf("secret %q (for %s) not found in secrets file", secretName, envName)
+		}
+		env[envName] = v
+	}
+	svc.Env = env
+	return svc, nil
+}
+
 // buildDropinContent builds the systemd drop-in file content for the given env map.
 // Keys are sorted for stable output.
 func buildDropinContent(env map[string]string) string {
@@ -147,3 +212,33 @@ func serviceIsActive(name string) (bool, error) {
 	}
 	return false, nil
 }
+
+// ServiceNames returns the services in the project's stored inventory.
+func ServiceNames(project string) ([]string, error) {
+	stored, err := loadStoredInventory(project)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(stored.Services))
+	for i, svc := range stored.Services {
+		names[i] = svc.Name
+	}
+	return names, nil
+}
+
+// ServiceStates returns the live state of every service in the project's
+// stored inventory, i.e. as of its last successful reconciliation.
+func ServiceStates(project string) ([]api.ServiceStatus, error) {
+	stored, err := loadStoredInventory(project)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]api.ServiceStatus, 0, len(stored.Services))
+	for _, svc := range stored.Services {
+		st := api.ServiceStatus{Name: svc.Name, Desired: svc.State}
+		st.Active, _ = serviceIsActive(svc.Name)
+		st.Enabled, _ = serviceIsEnabled(svc.Name)
+		out = append(out, st)
+	}
+	return out, nil
+}
@@ -185,3 +185,87 @@ func TestReconcileServiceEnv_NoopWhenEmptyAndNoDropin(t *testing.T) {
 		t.Error("expected changed=false when env is empty and no drop-in exists")
 	}
 }
+
+// --- secrets ---
+
+func TestWithSecrets_MergesIntoEnv(t *testing.T) {
+	svc := api.InventoryService{
+		Name:    "my-api",
+		Env:     map[string]string{"PORT": "8080"},
+		Secrets: map[string]string{"DB_PASSWORD": "db_password"},
+	}
+	got, err := withSecrets(svc, map[string]string{"db_password": "hunter2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Env["DB_PASSWORD"] != "hunter2" || got.Env["PORT"] != "8080" {
+		t.Errorf("Env = %v", got.Env)
+	}
+	if _, ok := svc.Env["DB_PASSWORD"]; ok {
+		t.Error("original service env must not be modified")
+	}
+}
+
+func TestWithSecrets_MissingSecret(t *testing.T) {
+	svc := api.InventoryService{Name: "my-api", Secrets: map[string]string{"DB_PASSWORD": "db_password"}}
+	if _, err := withSecrets(svc, nil); err == nil {
+		t.Error("expected error for missing secret")
+	}
+}
+
+func TestReconcileServiceEnv_SecretsDropinIsPrivate(t *testing.T) {
+	base := patchDropinBase(t)
+	patchDaemonReload(t)
+
+	svc, _ := withSecrets(api.InventoryService{
+		Name:    "my-api",
+		Secrets: map[string]string{"DB_PASSWORD": "db_password"},
+	}, map[string]string{"db_password": "hunter2"})
+
+	var log strings.Builder
+	if _, err := reconcileServiceEnv(svc, &log); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(filepath.Join(base, "my-api.service.d", "eacd-env.conf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("drop-in mode = %v, want 0600", info.Mode().Perm())
+	}
+	if strings.Contains(log.String(), "hunter2") {
+		t.Error("secret value must not be logged")
+	}
+}
+
+func TestReconcileServiceEnv_SecretsReplacePublicDropin(t *testing.T) {
+	base := patchDropinBase(t)
+	patchDaemonReload(t)
+
+	// A drop-in written before the service referenced secrets.
+	path := filepath.Join(base, "my-api.service.d", "eacd-env.conf")
+	os.MkdirAll(filepath.Dir(path), 0755)
+	os.WriteFile(path, []byte("[Service]\nEnvironment=\"PORT=8080\"\n"), 0644)
+
+	svc, _ := withSecrets(api.InventoryService{
+		Name:    "my-api",
+		Env:     map[string]string{"PORT": "8080"},
+		Secrets: map[string]string{"DB_PASSWORD": "db_password"},
+	}, map[string]string{"db_password": "hunter2"})
+	if _, err := reconcileServiceEnv(svc, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("drop-in mode = %v, want 0600", info.Mode().Perm())
+	}
+	if data, _ := os.ReadFile(path); !strings.Contains(string(data), "hunter2") {
+		t.Errorf("drop-in not replaced:\n%s", data)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Errorf("temp file left behind: %v", entries)
+	}
+}
@@ -4,9 +4,13 @@ import "github.com/flo-mic/eacd/internal/api"
 
 // storedInventory is persisted per project at /var/lib/eacd/<project>/inventory.json
 type storedInventory struct {
-	Packages []string              `json:"packages"`
+	Packages []string               `json:"packages"`
 	Services []api.InventoryService `json:"services"`
-	Users    []api.InventoryUser   `json:"users"`
+	Users    []api.InventoryUser    `json:"users"`
+
+	// DropinHashes maps service name → keyed hash of the env drop-in eacd
+	// wrote, so edits can be detected without storing secret values.
+	DropinHashes map[string]string `json:"dropin_hashes"`
 }
 
 // globalState is persisted at /var/lib/eacd/.global/package-owners.json
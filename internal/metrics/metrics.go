@@ -0,0 +1,222 @@
+// Package metrics keeps counters, gauges and histograms and writes them in
+// the Prometheus text exposition format, for eacdd's /metrics endpoint.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the media type of Write's output.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Registry holds metrics in the order they were registered.
+type Registry struct {
+	mu      sync.Mutex
+	metrics []*metric
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+type metric struct {
+	name    string
+	help    string
+	kind    string // counter, gauge or histogram
+	labels  []string
+	buckets []float64 // upper bounds, histograms only
+	series  map[string]*series
+}
+
+// series is one combination of label values.
+type series struct {
+	values []string
+	value  float64  // counters and gauges
+	counts []uint64 // per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+func (r *Registry) add(m *metric) *metric {
+	m.series = make(map[string]*series)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(m.labels) == 0 {
+		m.get(nil) // report 0 until the first update
+	}
+	r.metrics = append(r.metrics, m)
+	return m
+}
+
+// get returns the series of values, creating it. r.mu must be held.
+func (m *metric) get(values []string) *series {
+	if len(values) != len(m.labels) {
+		panic(fmt.Sprintf("metrics: %s: got %d label values, want %d", m.name, len(values), len(m.labels)))
+	}
+	key := strings.Join(values, "\xff")
+	s, ok := m.series[key]
+	if !ok {
+		s = &series{values: append([]string(nil), values...)}
+		if m.kind == "histogram" {
+			s.counts = make([]uint64, len(m.buckets))
+		}
+		m.series[key] = s
+	}
+	return s
+}
+
+// Counter is a value that only goes up.
+type Counter struct {
+	r *Registry
+	m *metric
+}
+
+// Counter registers a counter with the given label names.
+func (r *Registry) Counter(name, help string, labels ...string) *Counter {
+	return &Counter{r, r.add(&metric{name: name, help: help, kind: "counter", labels: labels})}
+}
+
+// Inc adds 1 to the series of the label values.
+func (c *Counter) Inc(values ...string) { c.Add(1, values...) }
+
+// Add adds v, which must not be negative, to the series of the label values.
+func (c *Counter) Add(v float64, values ...string) {
+	if v < 0 {
+		panic("metrics: " + c.m.name + ": counter decreased")
+	}
+	c.r.mu.Lock()
+	defer c.r.mu.Unlock()
+	c.m.get(values).value += v
+}
+
+// Gauge is a value that goes up and down.
+type Gauge struct {
+	r *Registry
+	m *metric
+}
+
+// Gauge registers a gauge with the given label names.
+func (r *Registry) Gauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{r, r.add(&metric{name: name, help: help, kind: "gauge", labels: labels})}
+}
+
+// Set sets the series of the label values to v.
+func (g *Gauge) Set(v float64, values ...string) {
+	g.r.mu.Lock()
+	defer g.r.mu.Unlock()
+	g.m.get(values).value = v
+}
+
+// Add adds v to the series of the label values.
+func (g *Gauge) Add(v float64, values ...string) {
+	g.r.mu.Lock()
+	defer g.r.mu.Unlock()
+	g.m.get(values).value += v
+}
+
+// Histogram counts observations in buckets.
+type Histogram struct {
+	r *Registry
+	m *metric
+}
+
+// Histogram registers a histogram with the given bucket upper bounds, in
+// increasing order, and label names. The +Inf bucket is implicit.
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	return &Histogram{r, r.add(&metric{name: name, help: help, kind: "histogram", labels: labels, buckets: buckets})}
+}
+
+// Observe records v in the series of the label values.
+func (h *Histogram) Observe(v float64, values ...string) {
+	h.r.mu.Lock()
+	defer h.r.mu.Unlock()
+	s := h.m.get(values)
+	if i := sort.SearchFloat64s(h.m.buckets, v); i < len(s.counts) {
+		s.counts[i]++
+	}
+	s.count++
+	s.sum += v
+}
+
+// Write writes all metrics in the Prometheus text format. Series are sorted
+// by their label values; labeled metrics without series only get their HELP
+// and TYPE lines.
+func (r *Registry) Write(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	bw := bufio.NewWriter(w)
+	for _, m := range r.metrics {
+		fmt.Fprintf(bw, "# HELP %s %s\n", m.name, escapeHelp(m.help))
+		fmt.Fprintf(bw, "# TYPE %s %s\n", m.name, m.kind)
+		keys := make([]string, 0, len(m.series))
+		for k := range m.series {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			s := m.series[k]
+			if m.kind != "histogram" {
+				fmt.Fprintf(bw, "%s%s %s\n", m.name, labelString(m.labels, s.values, "", ""), formatFloat(s.value))
+				continue
+			}
+			var cumulative uint64
+			for i, le := range m.buckets {
+				cumulative += s.counts[i]
+				fmt.Fprintf(bw, "%s_bucket%s %d\n", m.name, labelString(m.labels, s.values, "le", formatFloat(le)), cumulative)
+			}
+			fmt.Fprintf(bw, "%s_bucket%s %d\n", m.name, labelString(m.labels, s.values, "le", "+Inf"), s.count)
+			fmt.Fprintf(bw, "%s_sum%s %s\n", m.name, labelString(m.labels, s.values, "", ""), formatFloat(s.sum))
+			fmt.Fprintf(bw, "%s_count%s %d\n", m.name, labelString(m.labels, s.values, "", ""), s.count)
+		}
+	}
+	return bw.Flush()
+}
+
+// labelString formats {name="value",...}, with extra appended if set.
+func labelString(names, values []string, extra, extraValue string) string {
+	if len(names) == 0 && extra == "" {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, n := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=\"%s\"", n, escapeLabel(values[i]))
+	}
+	if extra != "" {
+		if len(names) > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=\"%s\"", extra, extraValue)
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
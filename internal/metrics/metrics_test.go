@@ -0,0 +1,61 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	r := NewRegistry()
+	deploys := r.Counter("eacdd_deploys_total", "Deploys by project and result.", "project", "result")
+	queue := r.Gauge("eacdd_deploy_queue_depth", "Deploys running.")
+	phases := r.Histogram("eacdd_phase_duration_seconds", "Phase durations.", []float64{1, 5}, "phase")
+	r.Counter("eacdd_unused_total", "Never incremented.")
+	r.Counter("eacdd_unused_by_group_total", "Never incremented.", "group")
+
+	deploys.Inc("web", "ok")
+	deploys.Inc("web", "ok")
+	deploys.Inc("api\"x", "fail")
+	queue.Add(1)
+	queue.Add(-1)
+	phases.Observe(0.5, "files")
+	phases.Observe(3, "files")
+	phases.Observe(10, "files")
+
+	var b strings.Builder
+	if err := r.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP eacdd_deploys_total Deploys by project and result.
+# TYPE eacdd_deploys_total counter
+eacdd_deploys_total{project="api\"x",result="fail"} 1
+eacdd_deploys_total{project="web",result="ok"} 2
+# HELP eacdd_deploy_queue_depth Deploys running.
+# TYPE eacdd_deploy_queue_depth gauge
+eacdd_deploy_queue_depth 0
+# HELP eacdd_phase_duration_seconds Phase durations.
+# TYPE eacdd_phase_duration_seconds histogram
+eacdd_phase_duration_seconds_bucket{phase="files",le="1"} 1
+eacdd_phase_duration_seconds_bucket{phase="files",le="5"} 2
+eacdd_phase_duration_seconds_bucket{phase="files",le="+Inf"} 3
+eacdd_phase_duration_seconds_sum{phase="files"} 13.5
+eacdd_phase_duration_seconds_count{phase="files"} 3
+# HELP eacdd_unused_total Never incremented.
+# TYPE eacdd_unused_total counter
+eacdd_unused_total 0
+# HELP eacdd_unused_by_group_total Never incremented.
+# TYPE eacdd_unused_by_group_total counter
+`
+	if b.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", b.String(), want)
+	}
+}
+
+func TestLabelCount(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("no panic for missing label value")
+		}
+	}()
+	NewRegistry().Counter("c", "", "project").Inc()
+}
@@ -0,0 +1,63 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"text/template"
+)
+
+// Data is what a templated file sees as its dot value.
+type Data struct {
+	Project     string            // project name from config.yaml
+	Environment string            // selected environment, empty for top level
+	Vars        map[string]string // merged vars: inventory < config < environment
+
+	// Secret looks up a value from the encrypted secrets file; nil if the
+	// project has none. Exposed to templates as the secret function.
+	Secret func(name string) (string, error)
+}
+
+// File renders the template at path with Go text/template and returns the result.
+// name is used in error messages, so it should be the project-relative path;
+// parse and execution errors then read "template: <name>:<line>: ...".
+// Missing keys in .Vars are an error rather than "<no value>".
+func File(path, name string, data Data) ([]byte, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	funcs := template.FuncMap{
+		"env": env,
+		"secret": func(name string) (string, error) {
+			if data.Secret == nil {
+				return "", fmt.Errorf("secret %q: no secrets file", name)
+			}
+			return data.Secret(name)
+		},
+	}
+
+	t, err := template.New(name).Option("missingkey=error").Funcs(funcs).Parse(string(src))
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// env returns the value of a local environment variable. With a second
+// argument it is used as default; without one an unset variable is an error.
+func env(name string, def ...string) (string, error) {
+	if v, ok := os.LookupEnv(name); ok {
+		return v, nil
+	}
+	if len(def) > 0 {
+		return def[0], nil
+	}
+	return "", fmt.Errorf("environment variable %s is not set", name)
+}
@@ -0,0 +1,82 @@
+package render
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTemplate(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "app.conf")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestFile_Vars(t *testing.T) {
+	path := writeTemplate(t, "name={{ .Project }}\nport={{ .Vars.port }}\n")
+	out, err := File(path, "dist/app.conf", Data{Project: "api", Vars: map[string]string{"port": "8080"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "name=api\nport=8080\n" {
+		t.Errorf("got %q", out)
+	}
+}
+
+func TestFile_Env(t *testing.T) {
+	t.Setenv("EACD_TEST_DB", "postgres://db/app")
+	path := writeTemplate(t, `db={{ env "EACD_TEST_DB" }} mode={{ env "EACD_TEST_UNSET" "dev" }}`)
+	out, err := File(path, "app.conf", Data{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "db=postgres://db/app mode=dev" {
+		t.Errorf("got %q", out)
+	}
+}
+
+func TestFile_MissingVarPointsToLine(t *testing.T) {
+	path := writeTemplate(t, "a=1\nb={{ .Vars.missing }}\n")
+	_, err := File(path, "dist/app.conf", Data{Vars: map[string]string{}})
+	if err == nil {
+		t.Fatal("expected error for missing var")
+	}
+	if !strings.Contains(err.Error(), "dist/app.conf:2") {
+		t.Errorf("error should name file and line, got %v", err)
+	}
+}
+
+func TestFile_UnsetEnvIsError(t *testing.T) {
+	path := writeTemplate(t, `{{ env "EACD_TEST_SURELY_UNSET" }}`)
+	if _, err := File(path, "app.conf", Data{}); err == nil {
+		t.Error("expected error for unset environment variable without default")
+	}
+}
+
+func TestFile_ParseErrorPointsToLine(t *testing.T) {
+	path := writeTemplate(t, "ok\n{{ .Vars.port \n")
+	_, err := File(path, "dist/app.conf", Data{})
+	if err == nil || !strings.Contains(err.Error(), "dist/app.conf:2") {
+		t.Errorf("expected parse error with file and line, got %v", err)
+	}
+}
+
+func TestFile_Secret(t *testing.T) {
+	path := writeTemplate(t, `password={{ secret "db_password" }}`)
+	data := Data{Secret: func(name string) (string, error) { return "hunter2", nil }}
+	out, err := File(path, "app.conf", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "password=hunter2" {
+		t.Errorf("got %q", out)
+	}
+
+	if _, err := File(path, "app.conf", Data{}); err == nil {
+		t.Error("expected error when no secrets are available")
+	}
+}
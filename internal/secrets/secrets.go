@@ -0,0 +1,329 @@
+// Package secrets implements the encrypted .eacd/secrets.enc file.
+//
+// Values are encrypted once with a random AES-256-GCM data key. The data key
+// is wrapped for every recipient (each daemon plus the developer's own key)
+// using an ephemeral X25519 exchange, so only holders of a recipient private
+// key can decrypt and the file itself is safe to commit.
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const fileVersion = 1
+
+// File is the on-disk format of secrets.enc.
+type File struct {
+	Version    int         `json:"version"`
+	Recipients []Recipient `json:"recipients"`
+	Nonce      string      `json:"nonce"` // base64
+	Data       string      `json:"data"`  // base64 AES-GCM ciphertext of the JSON values
+}
+
+// Recipient holds the data key wrapped for one public key.
+type Recipient struct {
+	Name       string `json:"name"`        // e.g. the server host or "local"
+	PublicKey  string `json:"public_key"`  // base64 X25519 public key
+	WrappedKey string `json:"wrapped_key"` // base64 ephemeral pub || nonce || ciphertext
+}
+
+// ErrNotRecipient is returned by Open when the key is not among the recipients.
+var ErrNotRecipient = errors.New("key is not a recipient of this secrets file")
+
+// GenerateKey returns a new X25519 private key.
+func GenerateKey() (*ecdh.PrivateKey, error) {
+	return ecdh.X25519().GenerateKey(rand.Reader)
+}
+
+// EncodePublicKey returns the base64 form of a public key.
+func EncodePublicKey(pub *ecdh.PublicKey) string {
+	return base64.StdEncoding.EncodeToString(pub.Bytes())
+}
+
+// Fingerprint returns "SHA256:" and the unpadded base64 SHA-256 of pub, for
+// comparing a key fetched from a server with the one it holds.
+func Fingerprint(pub *ecdh.PublicKey) string {
+	sum := sha256.Sum256(pub.Bytes())
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
+
+// ParsePublicKey parses the base64 form produced by EncodePublicKey.
+func ParsePublicKey(s string) (*ecdh.PublicKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %w", err)
+	}
+	return ecdh.X25519().NewPublicKey(raw)
+}
+
+// EncodePrivateKey returns the base64 form of a private key.
+func EncodePrivateKey(key *ecdh.PrivateKey) string {
+	return base64.StdEncoding.EncodeToString(key.Bytes())
+}
+
+// ParsePrivateKey parses the base64 form produced by EncodePrivateKey.
+func ParsePrivateKey(s string) (*ecdh.PrivateKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key: %w", err)
+	}
+	return ecdh.X25519().NewPrivateKey(raw)
+}
+
+// LoadKey reads a base64 private key from path.
+func LoadKey(path string) (*ecdh.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePrivateKey(string(data))
+}
+
+// LoadOrCreateKey reads the private key at path, generating and saving a new
+// one with 0600 permissions if the file does not exist.
+func LoadOrCreateKey(path string) (*ecdh.PrivateKey, error) {
+	key, err := LoadKey(path)
+	if err == nil || !os.IsNotExist(err) {
+		return key, err
+	}
+
+	key, err = GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, []byte(EncodePrivateKey(key)+"\n"), 0600); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// Seal encrypts values for the given recipients (name → public key).
+func Seal(values map[string]string, recipients map[string]*ecdh.PublicKey) (*File, error) {
+	if len(recipients) == 0 {
+		return nil, fmt.Errorf("at least one recipient is required")
+	}
+
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+
+	plaintext, err := json.Marshal(values)
+	if err != nil {
+		return nil, err
+	}
+	nonce, ciphertext, err := encrypt(dataKey, plaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &File{
+		Version: fileVersion,
+		Nonce:   base64.StdEncoding.EncodeToString(nonce),
+		Data:    base64.StdEncoding.EncodeToString(ciphertext),
+	}
+	for _, name := range sortedNames(recipients) {
+		wrapped, err := wrapKey(dataKey, recipients[name])
+		if err != nil {
+			return nil, fmt.Errorf("wrapping key for %s: %w", name, err)
+		}
+		f.Recipients = append(f.Recipients, Recipient{
+			Name:       name,
+			PublicKey:  EncodePublicKey(recipients[name]),
+			WrappedKey: base64.StdEncoding.EncodeToString(wrapped),
+		})
+	}
+	return f, nil
+}
+
+// Open decrypts the values with the given private key.
+func (f *File) Open(key *ecdh.PrivateKey) (map[string]string, error) {
+	if f.Version != fileVersion {
+		return nil, fmt.Errorf("unsupported secrets file version %d", f.Version)
+	}
+
+	pub := EncodePublicKey(key.PublicKey())
+	var dataKey []byte
+	for _, r := range f.Recipients {
+		if r.PublicKey != pub {
+			continue
+		}
+		wrapped, err := base64.StdEncoding.DecodeString(r.WrappedKey)
+		if err != nil {
+			return nil, fmt.Errorf("recipient %s: %w", r.Name, err)
+		}
+		if dataKey, err = unwrapKey(wrapped, key); err != nil {
+			return nil, fmt.Errorf("recipient %s: %w", r.Name, err)
+		}
+		break
+	}
+	if dataKey == nil {
+		return nil, ErrNotRecipient
+	}
+
+	nonce, err := base64.StdEncoding.DecodeString(f.Nonce)
+	if err != nil {
+		return nil, err
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(f.Data)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := decrypt(dataKey, nonce, ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting secrets: %w", err)
+	}
+
+	values := map[string]string{}
+	if err := json.Unmarshal(plaintext, &values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// RecipientKeys returns the public keys the file is currently sealed for.
+func (f *File) RecipientKeys() (map[string]*ecdh.PublicKey, error) {
+	out := make(map[string]*ecdh.PublicKey, len(f.Recipients))
+	for _, r := range f.Recipients {
+		pub, err := ParsePublicKey(r.PublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("recipient %s: %w", r.Name, err)
+		}
+		out[r.Name] = pub
+	}
+	return out, nil
+}
+
+// Parse decodes a secrets file.
+func Parse(data []byte) (*File, error) {
+	var f File
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("parsing secrets file: %w", err)
+	}
+	return &f, nil
+}
+
+// ReadFile reads and parses the secrets file at path.
+func ReadFile(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// WriteFile writes f to path atomically.
+func WriteFile(path string, f *File) error {
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// wrapKey encrypts dataKey for pub: a fresh ephemeral key pair is combined
+// with pub via X25519 and the shared secret, hashed with both public keys,
+// is used as the AES-GCM key.
+func wrapKey(dataKey []byte, pub *ecdh.PublicKey) ([]byte, error) {
+	eph, err := GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+	shared, err := eph.ECDH(pub)
+	if err != nil {
+		return nil, err
+	}
+	kek := deriveKey(shared, eph.PublicKey().Bytes(), pub.Bytes())
+	nonce, ciphertext, err := encrypt(kek, dataKey)
+	if err != nil {
+		return nil, err
+	}
+	out := append([]byte{}, eph.PublicKey().Bytes()...)
+	out = append(out, nonce...)
+	return append(out, ciphertext...), nil
+}
+
+func unwrapKey(wrapped []byte, key *ecdh.PrivateKey) ([]byte, error) {
+	const pubLen, nonceLen = 32, 12
+	if len(wrapped) < pubLen+nonceLen {
+		return nil, fmt.Errorf("wrapped key too short")
+	}
+	ephPub, err := ecdh.X25519().NewPublicKey(wrapped[:pubLen])
+	if err != nil {
+		return nil, err
+	}
+	shared, err := key.ECDH(ephPub)
+	if err != nil {
+		return nil, err
+	}
+	kek := deriveKey(shared, ephPub.Bytes(), key.PublicKey().Bytes())
+	return decrypt(kek, wrapped[pubLen:pubLen+nonceLen], wrapped[pubLen+nonceLen:])
+}
+
+func deriveKey(shared, ephPub, recipientPub []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte("eacd-secrets-v1"))
+	h.Write(shared)
+	h.Write(ephPub)
+	h.Write(recipientPub)
+	return h.Sum(nil)
+}
+
+func encrypt(key, plaintext []byte) (nonce, ciphertext []byte, err error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, nil, err
+	}
+	return nonce, gcm.Seal(nil, nonce, plaintext, nil), nil
+}
+
+func decrypt(key, nonce, ciphertext []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != gcm.NonceSize() {
+		return nil, fmt.Errorf("invalid nonce length")
+	}
+	return gcm.Open(nil, nonce, ciphertext, nil)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func sortedNames(m map[string]*ecdh.PublicKey) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,103 @@
+package secrets
+
+import (
+	"crypto/ecdh"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func mustKey(t *testing.T) *ecdh.PrivateKey {
+	t.Helper()
+	k, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func TestSealOpen_AllRecipients(t *testing.T) {
+	daemon, local := mustKey(t), mustKey(t)
+	values := map[string]string{"db_password": "hunter2"}
+
+	f, err := Seal(values, map[string]*ecdh.PublicKey{
+		"192.168.1.50:8765": daemon.PublicKey(),
+		"local":             local.PublicKey(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []*ecdh.PrivateKey{daemon, local} {
+		got, err := f.Open(key)
+		if err != nil {
+			t.Fatalf("Open: %v", err)
+		}
+		if got["db_password"] != "hunter2" {
+			t.Errorf("got %v", got)
+		}
+	}
+}
+
+func TestOpen_NotRecipient(t *testing.T) {
+	f, err := Seal(map[string]string{"a": "b"}, map[string]*ecdh.PublicKey{"local": mustKey(t).PublicKey()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Open(mustKey(t)); !errors.Is(err, ErrNotRecipient) {
+		t.Errorf("expected ErrNotRecipient, got %v", err)
+	}
+}
+
+func TestOpen_TamperedData(t *testing.T) {
+	key := mustKey(t)
+	f, _ := Seal(map[string]string{"a": "b"}, map[string]*ecdh.PublicKey{"local": key.PublicKey()})
+	f.Data = f.Data[:len(f.Data)-4] + "AAAA"
+	if _, err := f.Open(key); err == nil {
+		t.Error("expected error for tampered ciphertext")
+	}
+}
+
+func TestWriteReadFile(t *testing.T) {
+	key := mustKey(t)
+	f, _ := Seal(map[string]string{"a": "b"}, map[string]*ecdh.PublicKey{"local": key.PublicKey()})
+	path := filepath.Join(t.TempDir(), "secrets.enc")
+	if err := WriteFile(path, f); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, err := got.Open(key)
+	if err != nil || values["a"] != "b" {
+		t.Errorf("round trip failed: %v %v", values, err)
+	}
+	keys, err := got.RecipientKeys()
+	if err != nil || len(keys) != 1 {
+		t.Errorf("RecipientKeys = %v, %v", keys, err)
+	}
+}
+
+func TestLoadOrCreateKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "etc", "secrets.key")
+	k1, err := LoadOrCreateKey(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("key file mode = %v, want 0600", info.Mode().Perm())
+	}
+	k2, err := LoadOrCreateKey(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !k1.Equal(k2) {
+		t.Error("second call should load the existing key")
+	}
+}
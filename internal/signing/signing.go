@@ -0,0 +1,123 @@
+// Package signing creates and checks the ed25519 signatures of deploy
+// manifests.
+//
+// Private keys are PKCS#8 PEM files, as written by eacd keygen or
+// "openssl genpkey -algorithm ed25519". Public keys are the base64 raw
+// 32-byte keys listed under trusted_keys in server.yaml.
+package signing
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ErrUntrusted is returned by Verify if no trusted key made the signature.
+var ErrUntrusted = errors.New("signature does not verify against any trusted key")
+
+// GenerateKey writes a new private key to path, which must not exist yet,
+// and returns its public key.
+func GenerateKey(path string) (ed25519.PublicKey, error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := pem.Encode(f, &pem.Block{Type: "PRIVATE KEY", Bytes: der}); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return pub, f.Close()
+}
+
+// ParsePrivateKey parses a PKCS#8 PEM ed25519 private key.
+func ParsePrivateKey(data []byte) (ed25519.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM private key found")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("not an ed25519 key (%T)", key)
+	}
+	return priv, nil
+}
+
+// LoadPrivateKey reads a private key file.
+func LoadPrivateKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	priv, err := ParsePrivateKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return priv, nil
+}
+
+// EncodePublicKey returns the base64 form of pub used in trusted_keys.
+func EncodePublicKey(pub ed25519.PublicKey) string {
+	return base64.StdEncoding.EncodeToString(pub)
+}
+
+// ParsePublicKey parses a base64 ed25519 public key.
+func ParsePublicKey(s string) (ed25519.PublicKey, error) {
+	key, err := base64.StdEncoding.DecodeString(s)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("%q is not a base64 ed25519 public key", s)
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// KeyID returns a short, non-secret fingerprint of pub for logs,
+// e.g. "key:3fa81c09".
+func KeyID(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return "key:" + hex.EncodeToString(sum[:4])
+}
+
+// Sign returns the base64 signature of data.
+func Sign(priv ed25519.PrivateKey, data []byte) string {
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(priv, data))
+}
+
+// Verify checks the base64 signature of data against the trusted keys and
+// returns the key that made it.
+func Verify(trusted []ed25519.PublicKey, data []byte, signature string) (ed25519.PublicKey, error) {
+	if signature == "" {
+		return nil, errors.New("the manifest is not signed")
+	}
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return nil, errors.New("malformed signature")
+	}
+	for _, pub := range trusted {
+		if ed25519.Verify(pub, data, sig) {
+			return pub, nil
+		}
+	}
+	return nil, ErrUntrusted
+}
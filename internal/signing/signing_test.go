@@ -0,0 +1,46 @@
+package signing
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestSignVerify(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "signing.key")
+	pub, err := GenerateKey(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GenerateKey(path); err == nil {
+		t.Error("existing key overwritten")
+	}
+	priv, err := LoadPrivateKey(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParsePublicKey(EncodePublicKey(pub))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, _, _ := ed25519.GenerateKey(rand.Reader)
+	data := []byte(`{"name":"app"}`)
+	sig := Sign(priv, data)
+
+	signer, err := Verify([]ed25519.PublicKey{other, parsed}, data, sig)
+	if err != nil || KeyID(signer) != KeyID(pub) {
+		t.Errorf("Verify = %v, %v", signer, err)
+	}
+	if _, err := Verify([]ed25519.PublicKey{other}, data, sig); !errors.Is(err, ErrUntrusted) {
+		t.Errorf("untrusted key: got %v", err)
+	}
+	if _, err := Verify([]ed25519.PublicKey{parsed}, []byte(`{"name":"evil"}`), sig); !errors.Is(err, ErrUntrusted) {
+		t.Errorf("changed manifest: got %v", err)
+	}
+	if _, err := Verify([]ed25519.PublicKey{parsed}, data, ""); err == nil {
+		t.Error("unsigned manifest accepted")
+	}
+}
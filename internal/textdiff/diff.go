@@ -0,0 +1,224 @@
+// Package textdiff produces line-based unified diffs using Myers' algorithm.
+package textdiff
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Limits on the inputs to Unified. The edit search keeps O(D²) ints of
+// history for an edit distance D and takes O((n+m)·D) steps, so files that
+// are very long or very different are refused rather than diffed.
+const (
+	maxLines = 100000
+	maxEdits = 2000
+)
+
+// ErrTooLarge is returned by Unified when the inputs exceed its limits.
+var ErrTooLarge = errors.New("too large to diff")
+
+type opKind int
+
+const (
+	opEqual opKind = iota
+	opDelete
+	opInsert
+)
+
+type edit struct {
+	kind opKind
+	line string
+	a, b int // 0-based line index in a and b before this edit
+}
+
+// Unified returns a unified diff of a and b with the given number of context
+// lines, or "" if they are equal. It returns ErrTooLarge when the inputs
+// have too many lines or differ in too many of them.
+func Unified(aName, bName, a, b string, context int) (string, error) {
+	if a == b {
+		return "", nil
+	}
+	al, bl := splitLines(a), splitLines(b)
+	if len(al)+len(bl) > maxLines {
+		return "", ErrTooLarge
+	}
+	edits, ok := diffLines(al, bl, maxEdits)
+	if !ok {
+		return "", ErrTooLarge
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", aName, bName)
+	for _, h := range hunks(edits, context) {
+		writeHunk(&out, edits[h[0]:h[1]])
+	}
+	return out.String(), nil
+}
+
+// splitLines splits s after every newline; a final line without newline is kept.
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines returns the shortest edit script turning a into b, or false if
+// it needs more than maxD inserts and deletes.
+func diffLines(a, b []string, maxD int) ([]edit, bool) {
+	n, m := len(a), len(b)
+	max := n + m
+	off := max + 1
+	v := make([]int, 2*max+3)
+	// trace[d] holds the diagonals -d..d of v as they were before step d;
+	// the backtrack only reads the ones step d-1 wrote.
+	var trace [][]int
+
+	d := 0
+search:
+	for ; d <= max; d++ {
+		if d > maxD {
+			return nil, false
+		}
+		trace = append(trace, append([]int(nil), v[off-d:off+d+1]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[off+k-1] < v[off+k+1]) {
+				x = v[off+k+1]
+			} else {
+				x = v[off+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[off+k] = x
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	var rev []edit
+	x, y := n, m
+	for ; d > 0; d-- {
+		v := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[d+k-1] < v[d+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[d+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x, y = x-1, y-1
+			rev = append(rev, edit{opEqual, a[x], x, y})
+		}
+		if x == prevX {
+			rev = append(rev, edit{opInsert, b[prevY], x, prevY})
+		} else {
+			rev = append(rev, edit{opDelete, a[prevX], prevX, y})
+		}
+		x, y = prevX, prevY
+	}
+	for x > 0 && y > 0 {
+		x, y = x-1, y-1
+		rev = append(rev, edit{opEqual, a[x], x, y})
+	}
+
+	edits := make([]edit, len(rev))
+	for i, e := range rev {
+		edits[len(rev)-1-i] = e
+	}
+	return edits, true
+}
+
+// hunks groups changed edits with up to context equal lines around them.
+// Each hunk is a [start, end) range of edits.
+func hunks(edits []edit, context int) [][2]int {
+	var out [][2]int
+	for i := 0; i < len(edits); {
+		if edits[i].kind == opEqual {
+			i++
+			continue
+		}
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for end < len(edits) {
+			if edits[end].kind != opEqual {
+				end++
+				continue
+			}
+			// Count the run of equal lines; a short run joins two changes.
+			run := end
+			for run < len(edits) && edits[run].kind == opEqual {
+				run++
+			}
+			if run < len(edits) && run-end <= 2*context {
+				end = run
+				continue
+			}
+			end += context
+			if end > run {
+				end = run
+			}
+			break
+		}
+		out = append(out, [2]int{start, end})
+		i = end
+	}
+	return out
+}
+
+func writeHunk(out *strings.Builder, edits []edit) {
+	aStart, bStart := edits[0].a, edits[0].b
+	var aLen, bLen int
+	for _, e := range edits {
+		switch e.kind {
+		case opEqual:
+			aLen++
+			bLen++
+		case opDelete:
+			aLen++
+		case opInsert:
+			bLen++
+		}
+	}
+	fmt.Fprintf(out, "@@ -%s +%s @@\n", hunkRange(aStart, aLen), hunkRange(bStart, bLen))
+	for _, e := range edits {
+		prefix := " "
+		switch e.kind {
+		case opDelete:
+			prefix = "-"
+		case opInsert:
+			prefix = "+"
+		}
+		out.WriteString(prefix + e.line)
+		if !strings.HasSuffix(e.line, "\n") {
+			out.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+// hunkRange formats a 0-based start and length as "start,len" in the
+// 1-based form of unified diffs; an empty range names the line before it.
+func hunkRange(start, n int) string {
+	if n == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if n == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, n)
+}
@@ -0,0 +1,69 @@
+package textdiff
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestUnifiedEqual(t *testing.T) {
+	if d, _ := Unified("a", "b", "same\n", "same\n", 3); d != "" {
+		t.Errorf("expected no diff, got:\n%s", d)
+	}
+}
+
+func TestUnifiedChange(t *testing.T) {
+	a := "one\ntwo\nthree\nfour\nfive\n"
+	b := "one\ntwo\n3\nfour\nfive\nsix\n"
+	want := `--- remote
++++ local
+@@ -1,5 +1,6 @@
+ one
+ two
+-three
++3
+ four
+ five
++six
+`
+	if got, _ := Unified("remote", "local", a, b, 3); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestUnifiedSeparateHunks(t *testing.T) {
+	var a, b []string
+	for i := 0; i < 20; i++ {
+		line := strings.Repeat("x", i+1)
+		a = append(a, line)
+		b = append(b, line)
+	}
+	a[2], a[17] = "old-top", "old-bottom"
+	b[2], b[17] = "new-top", "new-bottom"
+
+	got, _ := Unified("a", "b", strings.Join(a, "\n")+"\n", strings.Join(b, "\n")+"\n", 1)
+	if n := strings.Count(got, "@@ -"); n != 2 {
+		t.Fatalf("expected 2 hunks, got %d:\n%s", n, got)
+	}
+	if !strings.Contains(got, "@@ -2,3 +2,3 @@") || !strings.Contains(got, "@@ -17,3 +17,3 @@") {
+		t.Errorf("unexpected hunk headers:\n%s", got)
+	}
+}
+
+func TestUnifiedAddToEmpty(t *testing.T) {
+	want := "--- a\n+++ b\n@@ -0,0 +1,2 @@\n+hello\n+world\n\\ No newline at end of file\n"
+	if got, _ := Unified("a", "b", "", "hello\nworld", 3); got != want {
+		t.Errorf("got:\n%q\nwant:\n%q", got, want)
+	}
+}
+
+func TestUnifiedTooManyEdits(t *testing.T) {
+	var a, b strings.Builder
+	for i := 0; i < maxEdits; i++ {
+		fmt.Fprintf(&a, "a%d\n", i)
+		fmt.Fprintf(&b, "b%d\n", i)
+	}
+	if _, err := Unified("a", "b", a.String(), b.String(), 3); err != ErrTooLarge {
+		t.Errorf("expected ErrTooLarge, got %v", err)
+	}
+}
@@ -0,0 +1,159 @@
+// Package upgrade replaces the running eacdd binary with a new one.
+//
+// Install stages and verifies the new binary next to the current one, keeps
+// the current binary as <exe>.prev and swaps the new one in with a rename.
+// Restore swaps the previous binary back if the new one does not come up.
+package upgrade
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/flo-mic/eacd/internal/api"
+)
+
+// Status is the state of the last upgrade, as reported by GET /admin/upgrade.
+type Status = api.UpgradeStatus
+
+// Upgrade states.
+const (
+	StatePending    = "pending"     // new binary installed, waiting for it to come up
+	StateOK         = "ok"          // new binary is running
+	StateRolledBack = "rolled_back" // new binary failed its health probe; previous one restored
+)
+
+// PrevSuffix is appended to the executable path for the kept previous binary.
+const PrevSuffix = ".prev"
+
+// versionCommand runs a staged binary with -version; replaced in tests.
+var versionCommand = func(ctx context.Context, path string) ([]byte, error) {
+	return exec.CommandContext(ctx, path, "-version").Output()
+}
+
+// Install writes the new binary from r next to exe, checks its SHA-256
+// against checksum (hex) and, if pub is set, its ed25519 signature, and makes
+// sure it runs. It then keeps exe as exe.prev and renames the new
+// binary over exe. It returns the version the new binary reports.
+func Install(exe string, r io.Reader, checksum string, signature []byte, pub ed25519.PublicKey) (string, error) {
+	if checksum == "" {
+		return "", errors.New("missing checksum")
+	}
+	if pub != nil && len(signature) == 0 {
+		return "", errors.New("this daemon requires a signed binary")
+	}
+
+	// The binary is streamed to disk and hashed on the way, so the upload is
+	// never held in memory.
+	staged := exe + ".new"
+	f, err := os.OpenFile(staged, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0755)
+	if err != nil {
+		return "", err
+	}
+	ok := false
+	defer func() {
+		if !ok {
+			os.Remove(staged)
+		}
+	}()
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(f, h), r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", fmt.Errorf("receiving binary: %w", err)
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(got, checksum) {
+		return "", fmt.Errorf("checksum mismatch: got %s, want %s", got, checksum)
+	}
+	if pub != nil {
+		// ed25519 signs the whole message, so only a signed binary is read
+		// back, once its checksum has matched.
+		data, err := os.ReadFile(staged)
+		if err != nil {
+			return "", err
+		}
+		if !ed25519.Verify(pub, data, signature) {
+			return "", errors.New("signature does not verify against upgrade_public_key")
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	out, err := versionCommand(ctx, staged)
+	if err != nil {
+		return "", fmt.Errorf("new binary does not run: %w", err)
+	}
+	version := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(string(out)), "eacdd"))
+	if version == "" {
+		return "", fmt.Errorf("new binary printed no version")
+	}
+
+	// exe.prev becomes a second link to the running binary, so exe is never
+	// missing: the rename below replaces it atomically.
+	os.Remove(exe + PrevSuffix)
+	if err := os.Link(exe, exe+PrevSuffix); err != nil {
+		return "", fmt.Errorf("keeping previous binary: %w", err)
+	}
+	if err := os.Rename(staged, exe); err != nil {
+		return "", fmt.Errorf("installing new binary: %w", err)
+	}
+	ok = true
+	return version, nil
+}
+
+// Restore puts exe.prev back in place of exe.
+func Restore(exe string) error {
+	tmp := exe + ".restore"
+	os.Remove(tmp)
+	if err := os.Link(exe+PrevSuffix, tmp); err != nil {
+		return err
+	}
+	return os.Rename(tmp, exe)
+}
+
+// LoadStatus reads the status file at path. A missing file returns nil.
+func LoadStatus(path string) (*Status, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var s Status
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &s, nil
+}
+
+// SaveStatus writes s to path atomically.
+func SaveStatus(path string, s Status) error {
+	if s.Time.IsZero() {
+		s.Time = time.Now().UTC()
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
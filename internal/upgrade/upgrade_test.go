@@ -0,0 +1,102 @@
+package upgrade
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func fakeVersion(t *testing.T, out string) {
+	orig := versionCommand
+	versionCommand = func(ctx context.Context, path string) ([]byte, error) { return []byte(out), nil }
+	t.Cleanup(func() { versionCommand = orig })
+}
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestInstallAndRestore(t *testing.T) {
+	fakeVersion(t, "eacdd v1.5.0\n")
+	exe := filepath.Join(t.TempDir(), "eacdd")
+	os.WriteFile(exe, []byte("old"), 0755)
+
+	v, err := Install(exe, strings.NewReader("new"), checksum([]byte("new")), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != "v1.5.0" {
+		t.Errorf("version = %q", v)
+	}
+	if got, _ := os.ReadFile(exe); string(got) != "new" {
+		t.Errorf("exe = %q, want new binary", got)
+	}
+	if got, _ := os.ReadFile(exe + PrevSuffix); string(got) != "old" {
+		t.Errorf("prev = %q, want old binary", got)
+	}
+
+	if err := Restore(exe); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(exe); string(got) != "old" {
+		t.Errorf("after restore exe = %q", got)
+	}
+}
+
+func TestInstallRejects(t *testing.T) {
+	fakeVersion(t, "eacdd v1.5.0\n")
+	exe := filepath.Join(t.TempDir(), "eacdd")
+	os.WriteFile(exe, []byte("old"), 0755)
+
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	data := []byte("new")
+	tests := []struct {
+		name     string
+		checksum string
+		sig      []byte
+		pub      ed25519.PublicKey
+		want     string
+	}{
+		{"no checksum", "", nil, nil, "missing checksum"},
+		{"wrong checksum", checksum([]byte("other")), nil, nil, "checksum mismatch"},
+		{"unsigned", checksum(data), nil, pub, "requires a signed binary"},
+		{"bad signature", checksum(data), ed25519.Sign(priv, []byte("other")), pub, "does not verify"},
+	}
+	for _, tt := range tests {
+		_, err := Install(exe, bytes.NewReader(data), tt.checksum, tt.sig, tt.pub)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got %v, want %q", tt.name, err, tt.want)
+		}
+	}
+	if got, _ := os.ReadFile(exe); string(got) != "old" {
+		t.Errorf("rejected upgrade replaced the binary")
+	}
+	if _, err := os.Stat(exe + ".new"); !os.IsNotExist(err) {
+		t.Errorf("staged binary left behind")
+	}
+
+	if _, err := Install(exe, bytes.NewReader(data), checksum(data), ed25519.Sign(priv, data), pub); err != nil {
+		t.Errorf("signed binary rejected: %v", err)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "upgrade.json")
+	if s, err := LoadStatus(path); s != nil || err != nil {
+		t.Fatalf("missing file: %v, %v", s, err)
+	}
+	if err := SaveStatus(path, Status{State: StateRolledBack, From: "v1", To: "v2", Error: "timeout"}); err != nil {
+		t.Fatal(err)
+	}
+	s, err := LoadStatus(path)
+	if err != nil || s.State != StateRolledBack || s.To != "v2" || s.Time.IsZero() {
+		t.Errorf("loaded %+v, %v", s, err)
+	}
+}
@@ -0,0 +1,21 @@
+// Package version holds the version eacd and eacdd were built as.
+package version
+
+import "runtime/debug"
+
+// Version is set at build time:
+//
+//	go build -ldflags "-X github.com/flo-mic/eacd/internal/version.Version=v1.4.0"
+var Version = ""
+
+// String returns Version, falling back to the module version recorded by
+// "go install" and finally to "dev".
+func String() string {
+	if Version != "" {
+		return Version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	return "dev"
+}
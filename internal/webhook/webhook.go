@@ -0,0 +1,313 @@
+// Package webhook posts deploy and rollback events to webhook URLs, as
+// generic JSON or in the formats of Slack/Mattermost and ntfy/Gotify.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/flo-mic/eacd/internal/api"
+)
+
+// Headers of every request.
+const (
+	EventHeader     = "X-Eacd-Event"
+	SignatureHeader = "X-Eacd-Signature" // "sha256=<hex HMAC-SHA256 of the body>", if the hook has a secret
+)
+
+// DefaultTimeout is the timeout per attempt of hooks without one.
+const DefaultTimeout = 10 * time.Second
+
+// Backoff is the wait before the first retry; it doubles with each retry
+// up to MaxBackoff. They are variables so tests can shorten them.
+var (
+	Backoff    = time.Second
+	MaxBackoff = 30 * time.Second
+)
+
+// Hook is a webhook URL and how to deliver to it.
+type Hook struct {
+	URL     string
+	Format  string   // "json" (default), "slack", "mattermost", "ntfy" or "gotify"
+	Secret  string   // if set, the body is signed, see SignatureHeader
+	Events  []string // empty: all events
+	Timeout time.Duration
+	Retries int // attempts after the first one
+}
+
+// Wants reports whether h subscribes to event.
+func (h Hook) Wants(event string) bool {
+	return len(h.Events) == 0 || slices.Contains(h.Events, event)
+}
+
+// Event is what happened. It is the body of the json format.
+type Event struct {
+	Event    string          `json:"event"` // see api.WebhookDeployStarted and the following
+	Project  string          `json:"project"`
+	Host     string          `json:"host"` // the server's hostname
+	Time     time.Time       `json:"time"`
+	Release  int             `json:"release,omitempty"`
+	Detail   string          `json:"detail,omitempty"`
+	Code     string          `json:"code,omitempty"` // error code of a failure
+	Error    string          `json:"error,omitempty"`
+	Identity string          `json:"identity,omitempty"` // token that started it
+	Meta     *api.DeployMeta `json:"meta,omitempty"`
+}
+
+// Message returns a one-line description of e for chat formats.
+func Message(e Event) string {
+	var msg string
+	switch e.Event {
+	case api.WebhookDeployStarted:
+		msg = fmt.Sprintf("Deploying %s to %s", e.Project, e.Host)
+	case api.WebhookDeploySucceeded:
+		msg = fmt.Sprintf("Deployed %s to %s", e.Project, e.Host)
+	case api.WebhookDeployFailed:
+		msg = fmt.Sprintf("Deploy of %s to %s failed", e.Project, e.Host)
+	case api.WebhookRolledBack:
+		msg = fmt.Sprintf("Rolled back %s on %s", e.Project, e.Host)
+	case api.WebhookRollbackFailed:
+		msg = fmt.Sprintf("Rollback of %s on %s failed", e.Project, e.Host)
+	default:
+		msg = fmt.Sprintf("%s: %s on %s", e.Event, e.Project, e.Host)
+	}
+	if e.Release > 0 {
+		msg += fmt.Sprintf(" (release #%d)", e.Release)
+	}
+	if e.Error != "" {
+		msg += ": " + e.Error
+	} else if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+	if m := e.Meta; m != nil {
+		if m.GitCommit != "" {
+			commit := m.GitCommit
+			if len(commit) > 7 {
+				commit = commit[:7]
+			}
+			msg += " — " + commit
+			if m.GitDirty {
+				msg += " (dirty)"
+			}
+		}
+		if m.User != "" {
+			msg += " by " + m.User
+		}
+		if m.Message != "" {
+			msg += ": " + m.Message
+		}
+	}
+	return msg
+}
+
+func failed(event string) bool {
+	return event == api.WebhookDeployFailed || event == api.WebhookRollbackFailed
+}
+
+// Payload returns the request body of e in format, its content type and
+// extra headers.
+func Payload(format string, e Event) (body []byte, contentType string, header http.Header, err error) {
+	header = http.Header{}
+	switch format {
+	case "", "json":
+		body, err = json.Marshal(e)
+		return body, "application/json", header, err
+	case "slack", "mattermost":
+		body, err = json.Marshal(map[string]string{"text": Message(e)})
+		return body, "application/json", header, err
+	case "ntfy":
+		header.Set("Title", "eacd: "+e.Project)
+		switch {
+		case failed(e.Event):
+			header.Set("Tags", "x")
+			header.Set("Priority", "high")
+		case e.Event == api.WebhookDeployStarted:
+			header.Set("Tags", "rocket")
+		case e.Event == api.WebhookRolledBack:
+			header.Set("Tags", "rewind")
+		default:
+			header.Set("Tags", "white_check_mark")
+		}
+		return []byte(Message(e)), "text/plain; charset=utf-8", header, nil
+	case "gotify":
+		priority := 5
+		if failed(e.Event) {
+			priority = 8
+		}
+		body, err = json.Marshal(map[string]any{"title": "eacd: " + e.Project, "message": Message(e), "priority": priority})
+		return body, "application/json", header, err
+	}
+	return nil, "", nil, fmt.Errorf("unknown webhook format %q", format)
+}
+
+// Sign returns the SignatureHeader value for body.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Send posts e to h, retrying failed attempts with exponential backoff
+// capped at MaxBackoff. A response other than 2xx counts as a failure.
+func Send(ctx context.Context, client *http.Client, h Hook, e Event) error {
+	body, contentType, header, err := Payload(h.Format, e)
+	if err != nil {
+		return err
+	}
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	wait := Backoff
+	for attempt := 0; ; attempt++ {
+		err = post(ctx, client, h, e.Event, body, contentType, header, timeout)
+		if err == nil || attempt >= h.Retries {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return errors.Join(err, ctx.Err())
+		case <-time.After(wait):
+		}
+		wait = min(wait*2, MaxBackoff)
+	}
+}
+
+func post(ctx context.Context, client *http.Client, h Hook, event string, body []byte, contentType string, header http.Header, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header = header.Clone()
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set(EventHeader, event)
+	if h.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(h.Secret, body))
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s: %s", h.URL, resp.Status)
+	}
+	return nil
+}
+
+// Notifier delivers events in the background, so a slow webhook does not
+// hold up a deploy. Each URL has its own queue, delivered one at a time and
+// in order, so a slow receiver does not hold up the others either.
+type Notifier struct {
+	client *http.Client
+	size   int
+	wg     sync.WaitGroup
+
+	mu     sync.Mutex
+	queues map[string]chan delivery // by URL, while it has a worker
+	closed bool
+}
+
+type delivery struct {
+	hook  Hook
+	event Event
+}
+
+// NewNotifier returns a notifier that queues up to size deliveries per URL.
+func NewNotifier(client *http.Client, size int) *Notifier {
+	return &Notifier{client: client, size: size, queues: make(map[string]chan delivery)}
+}
+
+// run delivers the queue of url until it is empty or closed.
+func (n *Notifier) run(url string, queue chan delivery) {
+	defer n.wg.Done()
+	for {
+		select {
+		case d, ok := <-queue:
+			if !ok {
+				return
+			}
+			if err := Send(context.Background(), n.client, d.hook, d.event); err != nil {
+				slog.Error("webhook failed", "event", d.event.Event, "project", d.event.Project, "err", err)
+			}
+		default:
+			// Notify queues under mu, so an empty queue stays empty here.
+			n.mu.Lock()
+			if len(queue) == 0 {
+				if !n.closed {
+					delete(n.queues, url)
+				}
+				n.mu.Unlock()
+				return
+			}
+			n.mu.Unlock()
+		}
+	}
+}
+
+// Notify queues e for every hook that wants it. If a URL's queue is full
+// the event is dropped for it and logged.
+func (n *Notifier) Notify(hooks []Hook, e Event) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.closed {
+		return
+	}
+	for _, h := range hooks {
+		if !h.Wants(e.Event) {
+			continue
+		}
+		queue, ok := n.queues[h.URL]
+		if !ok {
+			queue = make(chan delivery, n.size)
+			n.queues[h.URL] = queue
+			n.wg.Add(1)
+			go n.run(h.URL, queue)
+		}
+		select {
+		case queue <- delivery{h, e}:
+		default:
+			slog.Warn("webhook queue full, dropping event", "event", e.Event, "project", e.Project, "url", h.URL)
+		}
+	}
+}
+
+// Close stops accepting events and waits until the queued ones are
+// delivered or ctx is done.
+func (n *Notifier) Close(ctx context.Context) error {
+	n.mu.Lock()
+	if !n.closed {
+		n.closed = true
+		for _, queue := range n.queues {
+			close(queue)
+		}
+	}
+	n.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		n.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,179 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/flo-mic/eacd/internal/api"
+)
+
+type received struct {
+	header http.Header
+	body   string
+}
+
+// standIn records the requests it receives and answers the first fail of
+// them with 503.
+func standIn(t *testing.T, fail int) (*httptest.Server, func() []received) {
+	var mu sync.Mutex
+	var got []received
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, received{r.Header.Clone(), string(body)})
+		if len(got) <= fail {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []received {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]received(nil), got...)
+	}
+}
+
+var testEvent = Event{
+	Event:   api.WebhookDeploySucceeded,
+	Project: "my-api",
+	Host:    "ct-101",
+	Release: 13,
+	Meta:    &api.DeployMeta{GitCommit: "a1b2c3d4e5f6", User: "flo"},
+}
+
+func TestSendJSONSigned(t *testing.T) {
+	srv, got := standIn(t, 0)
+	if err := Send(context.Background(), srv.Client(), Hook{URL: srv.URL, Secret: "s3cret"}, testEvent); err != nil {
+		t.Fatal(err)
+	}
+	reqs := got()
+	if len(reqs) != 1 {
+		t.Fatalf("got %d requests", len(reqs))
+	}
+	r := reqs[0]
+	var e Event
+	if err := json.Unmarshal([]byte(r.body), &e); err != nil || e.Project != "my-api" || e.Release != 13 {
+		t.Errorf("body = %s (%v)", r.body, err)
+	}
+	if r.header.Get(EventHeader) != api.WebhookDeploySucceeded {
+		t.Errorf("event header = %q", r.header.Get(EventHeader))
+	}
+	if sig := r.header.Get(SignatureHeader); sig != Sign("s3cret", []byte(r.body)) {
+		t.Errorf("signature = %q", sig)
+	}
+}
+
+func TestPayloadFormats(t *testing.T) {
+	failed := testEvent
+	failed.Event, failed.Error = api.WebhookDeployFailed, "systemd: exit status 1"
+
+	body, _, _, err := Payload("slack", testEvent)
+	if err != nil || string(body) != `{"text":"Deployed my-api to ct-101 (release #13) — a1b2c3d by flo"}` {
+		t.Errorf("slack = %s (%v)", body, err)
+	}
+	body, ct, header, _ := Payload("ntfy", failed)
+	if !strings.HasPrefix(ct, "text/plain") || header.Get("Priority") != "high" || !strings.Contains(string(body), "failed (release #13): systemd: exit status 1") {
+		t.Errorf("ntfy = %s %s %v", ct, body, header)
+	}
+	body, _, _, _ = Payload("gotify", failed)
+	if !strings.Contains(string(body), `"priority":8`) || !strings.Contains(string(body), `"title":"eacd: my-api"`) {
+		t.Errorf("gotify = %s", body)
+	}
+	if _, _, _, err := Payload("teams", testEvent); err == nil {
+		t.Error("unknown format accepted")
+	}
+}
+
+func TestSendRetries(t *testing.T) {
+	Backoff = time.Millisecond
+	t.Cleanup(func() { Backoff = time.Second })
+
+	srv, got := standIn(t, 2)
+	if err := Send(context.Background(), srv.Client(), Hook{URL: srv.URL, Retries: 2}, testEvent); err != nil {
+		t.Fatalf("third attempt should succeed: %v", err)
+	}
+	if n := len(got()); n != 3 {
+		t.Errorf("got %d attempts, want 3", n)
+	}
+
+	srv, got = standIn(t, 5)
+	if err := Send(context.Background(), srv.Client(), Hook{URL: srv.URL, Retries: 1}, testEvent); err == nil || !strings.Contains(err.Error(), "503") {
+		t.Errorf("err = %v, want 503", err)
+	}
+	if n := len(got()); n != 2 {
+		t.Errorf("got %d attempts, want 2", n)
+	}
+}
+
+func TestSendTimeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	start := time.Now()
+	err := Send(context.Background(), srv.Client(), Hook{URL: srv.URL, Timeout: 50 * time.Millisecond}, testEvent)
+	if err == nil || time.Since(start) > 2*time.Second {
+		t.Errorf("err = %v after %v", err, time.Since(start))
+	}
+}
+
+func TestNotifier(t *testing.T) {
+	srv, got := standIn(t, 0)
+	n := NewNotifier(srv.Client(), 10)
+	hooks := []Hook{
+		{URL: srv.URL},
+		{URL: srv.URL, Events: []string{api.WebhookDeployFailed}},
+	}
+	started := testEvent
+	started.Event = api.WebhookDeployStarted
+	n.Notify(hooks, started)
+	n.Notify(hooks, testEvent)
+	if err := n.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	n.Notify(hooks, testEvent) // after Close: dropped
+
+	reqs := got()
+	if len(reqs) != 2 {
+		t.Fatalf("got %d requests, want 2", len(reqs))
+	}
+	if reqs[0].header.Get(EventHeader) != api.WebhookDeployStarted || reqs[1].header.Get(EventHeader) != api.WebhookDeploySucceeded {
+		t.Errorf("events out of order: %s, %s", reqs[0].header.Get(EventHeader), reqs[1].header.Get(EventHeader))
+	}
+}
+
+func TestNotifierQueuePerURL(t *testing.T) {
+	Backoff, MaxBackoff = time.Millisecond, time.Millisecond
+	t.Cleanup(func() { Backoff, MaxBackoff = time.Second, 30*time.Second })
+
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer slow.Close()
+	defer close(release)
+	fast, got := standIn(t, 0)
+
+	n := NewNotifier(fast.Client(), 10)
+	n.Notify([]Hook{{URL: slow.URL, Timeout: time.Minute}}, testEvent)
+	n.Notify([]Hook{{URL: fast.URL}}, testEvent)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(got()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(got()) != 1 {
+		t.Fatal("delivery to a fast URL waited for a slow one")
+	}
+}